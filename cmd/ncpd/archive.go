@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"ncpd/internal/archive"
+	"ncpd/internal/client"
+)
+
+var (
+	ledgersMu sync.Mutex
+	ledgers   = make(map[string]*archive.Ledger) // 按频道保存目录缓存已读取的账本
+)
+
+// channelLedger 返回频道保存目录中的账本，同一个目录只读取一次
+func channelLedger(baseSaveDir string) (*archive.Ledger, error) {
+	ledgersMu.Lock()
+	defer ledgersMu.Unlock()
+
+	if ledger, ok := ledgers[baseSaveDir]; ok {
+		return ledger, nil
+	}
+	ledger, err := archive.Open(baseSaveDir)
+	if err != nil {
+		return nil, err
+	}
+	ledgers[baseSaveDir] = ledger
+	return ledger, nil
+}
+
+// archiveKey 返回当前平台上内容的账本 Key
+func archiveKey(fcSiteID int, code string, kind archive.Kind) archive.Key {
+	return archive.Key{Platform: client.CurrentPlatform.Key, FcSiteID: fcSiteID, Code: code, Kind: kind}
+}
+
+// isArchived 判断内容是否已经保存为 paths
+// 账本中从来没有记录但文件都已存在时（使用账本之前下载的内容）补充记录，同样视为已经保存
+func isArchived(baseSaveDir string, key archive.Key, releasedAt string, paths ...string) bool {
+	ledger, err := channelLedger(baseSaveDir)
+	if err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+		return false
+	}
+	if ledger.Has(key, paths...) {
+		return true
+	}
+
+	if len(paths) == 0 || ledger.Seen(key) {
+		return false
+	}
+	for _, path := range paths {
+		if !fileExists(path) {
+			return false
+		}
+	}
+	if _, err := ledger.Record(key, releasedAt, paths...); err != nil {
+		fmt.Printf("⚠️  记录到账本失败: %v\n", err)
+	}
+	return true
+}
+
+// recordArchive 将保存的内容记录到频道的账本，失败时只打印警告，内容已经保存
+func recordArchive(baseSaveDir string, key archive.Key, releasedAt string, paths ...string) {
+	ledger, err := channelLedger(baseSaveDir)
+	if err == nil {
+		_, err = ledger.Record(key, releasedAt, paths...)
+	}
+	if err != nil {
+		fmt.Printf("⚠️  记录到账本失败: %v\n", err)
+	}
+}
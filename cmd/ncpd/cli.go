@@ -0,0 +1,943 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ncpd/config"
+	"ncpd/internal/archive"
+	"ncpd/internal/auth"
+	"ncpd/internal/channel"
+	"ncpd/internal/client"
+	"ncpd/internal/danmaku"
+	"ncpd/internal/hls"
+	"ncpd/internal/news"
+	"ncpd/internal/video"
+)
+
+// 命令行模式的退出码
+const (
+	exitOK      = 0
+	exitFailure = 1 // 部分或全部任务失败
+	exitUsage   = 2 // 参数错误
+
+	exitInterrupted = 130 // 被 Ctrl+C 或 SIGTERM 中断
+)
+
+// command 描述一个子命令
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) int
+}
+
+var commands = []command{
+	{name: "channels", summary: "列出频道", run: runChannels},
+	{name: "videos", summary: "列出频道的视频", run: runVideos},
+	{name: "download", summary: "下载视频及相关内容", run: runDownload},
+	{name: "news", summary: "下载或列出频道新闻", run: runNews},
+	{name: "sync", summary: "增量同步频道，只获取上次同步之后的新内容和变化", run: runSync},
+	{name: "watch", summary: "定期检查关注的频道，自动下载新内容并录制生放送", run: runWatch},
+	{name: "live", summary: "等待生放送开始并录制直播", run: runLive},
+	{name: "live-chat", summary: "实时录制正在进行的生放送的弹幕", run: runLiveChat},
+	{name: "gallery", summary: "将已经下载的频道目录生成为可以离线浏览的静态网站", run: runGallery},
+	{name: "login", summary: "在浏览器中登录并保存 refresh token", run: runLogin},
+}
+
+// runCommand 执行命令行模式的子命令，返回进程退出码，ctx 取消时中止正在执行的任务
+func runCommand(ctx context.Context, args []string) int {
+	switch args[0] {
+	case "help", "-h", "--help":
+		printUsage()
+		return exitOK
+	}
+
+	// 直接粘贴频道或视频链接时，跳过平台和频道的选择
+	if len(args) == 1 && channel.IsLink(args[0]) {
+		return runLink(ctx, args[0])
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "❌ 未知命令: %s\n\n", args[0])
+	printUsage()
+	return exitUsage
+}
+
+// printUsage 打印所有子命令的用法
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法: ncpd [命令] [参数]")
+	fmt.Fprintln(os.Stderr, "       ncpd <频道或视频链接>")
+	fmt.Fprintln(os.Stderr, "不带任何参数运行时进入交互模式")
+	fmt.Fprintln(os.Stderr, "\n命令:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\n<频道> 可以是频道 ID（如 123）、频道名（如 abcdef，即 https://nicochannel.jp/abcdef）、")
+	fmt.Fprintln(os.Stderr, "频道链接或视频链接（如 https://nicochannel.jp/abcdef/video/smXXXX），使用链接时 --platform 无效")
+	fmt.Fprintln(os.Stderr, "使用 \"ncpd <命令> --help\" 查看命令的参数")
+	fmt.Fprintln(os.Stderr, "\n所有命令和交互模式都可以使用:")
+	fmt.Fprintln(os.Stderr, "  --record <目录>  将 API 请求和响应录制到目录中，token 等敏感信息会被替换，可以附在问题报告中")
+	fmt.Fprintln(os.Stderr, "  --replay <目录>  使用录制的响应代替访问 API，不会读取或修改保存的登录信息")
+}
+
+// parseGlobalArgs 取出所有命令共用的 --record、--replay 参数，返回剩余的参数
+func parseGlobalArgs(args []string) (rest []string, record string, replay string, err error) {
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || (name != "record" && name != "replay") {
+			rest = append(rest, args[i])
+			continue
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, "", "", fmt.Errorf("--%s 需要指定目录", name)
+			}
+			i++
+			value = args[i]
+		}
+		if name == "record" {
+			record = value
+		} else {
+			replay = value
+		}
+	}
+
+	if record != "" && replay != "" {
+		return nil, "", "", fmt.Errorf("--record 和 --replay 不能同时使用")
+	}
+	return rest, record, replay, nil
+}
+
+// setupCassette 开启录制或回放，返回退出前需要调用的清理函数
+func setupCassette(record string, replay string) (func(), error) {
+	if record != "" {
+		if err := client.Record(record); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "🎙️  API 请求将录制到 %s\n", record)
+		return func() {}, nil
+	}
+
+	if replay == "" {
+		return func() {}, nil
+	}
+	if err := client.Replay(replay); err != nil {
+		return nil, fmt.Errorf("读取录制的请求失败: %w", err)
+	}
+
+	// 录制中的 token 已被替换，回放时使用临时目录保存 token，不读取也不覆盖真实的登录信息
+	dir, err := os.MkdirTemp("", "ncpd-replay-")
+	if err != nil {
+		return nil, err
+	}
+	os.Setenv("CREDENTIALS_DIR", dir)
+	os.Setenv("NICO_REFRESH_TOKEN", client.Redacted)
+	if os.Getenv("NICO_CLIENT_ID") == "" {
+		os.Setenv("NICO_CLIENT_ID", client.Redacted)
+	}
+	fmt.Fprintf(os.Stderr, "📼 使用 %s 中录制的响应，不会访问 API\n", replay)
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// newFlagSet 创建子命令的参数集合
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "用法: ncpd %s\n\n参数:\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs 解析参数，允许参数和位置参数交替出现，返回位置参数
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usageError 打印参数错误并返回对应的退出码
+func usageError(fs *flag.FlagSet, err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n\n", err)
+		fs.Usage()
+	}
+	return exitUsage
+}
+
+// parseChannelArgs 解析只需要一个 <频道> 位置参数的子命令
+func parseChannelArgs(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		return "", fmt.Errorf("需要指定一个频道")
+	}
+	return positional[0], nil
+}
+
+// registerPlatformFlag 注册 --platform 参数，返回平台名称或域名
+func registerPlatformFlag(fs *flag.FlagSet) *string {
+	return fs.String("platform", "nicochannel", "平台名称或域名，如 nicochannel、qlover")
+}
+
+// registerAccountFlag 注册 --account 参数，返回使用的账号
+func registerAccountFlag(fs *flag.FlagSet) *string {
+	return fs.String("account", "", "使用的账号，对应 NICO_REFRESH_TOKEN_<平台>_<账号> 等配置，默认使用不带账号后缀的配置")
+}
+
+// registerASSFlags 注册生成 ASS 弹幕的参数，返回 --ass-resolution 的值
+func registerASSFlags(fs *flag.FlagSet, options *danmaku.ASSOptions) *string {
+	resolution := fs.String("ass-resolution", "", "ASS 弹幕的分辨率，如 1920x1080（默认使用视频最高画质的分辨率）")
+	fs.StringVar(&options.FontName, "ass-font", "", "ASS 弹幕的字体（默认 sans-serif）")
+	fs.IntVar(&options.FontSize, "ass-font-size", 0, "ASS 弹幕的字号（默认为视频高度的 1/20）")
+	fs.Float64Var(&options.Opacity, "ass-opacity", 0, "ASS 弹幕的不透明度，0 到 1（默认 0.8）")
+	fs.DurationVar(&options.ScrollDuration, "ass-duration", 0, "滚动弹幕经过屏幕的时间，越短越快（默认 8s）")
+	fs.Float64Var(&options.ScrollArea, "ass-area", 0, "滚动弹幕占屏幕高度的比例，0 到 1（默认 1）")
+	fs.IntVar(&options.MaxOnScreen, "ass-max", 0, "同时显示的滚动弹幕最多条数，超出的弹幕不显示（默认只受行数限制）")
+	return resolution
+}
+
+// setupPlatform 根据名称选择平台并初始化客户端
+func setupPlatform(ctx context.Context, name string) error {
+	platform, err := client.FindPlatform(name)
+	if err != nil {
+		return err
+	}
+
+	if err := client.InitClientWithPlatform(ctx, platform); err != nil {
+		return fmt.Errorf("初始化客户端失败: %w", err)
+	}
+	return nil
+}
+
+// target 命令行指定的频道或单个视频
+type target struct {
+	fcSiteID    int
+	contentCode string // 使用视频链接时不为空
+}
+
+// resolveTarget 初始化客户端并解析 <频道> 参数，参数为链接时使用链接所属的平台
+func resolveTarget(ctx context.Context, arg string, platformName string) (*target, error) {
+	if channel.IsLink(arg) {
+		link, err := channel.ParseLink(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := client.InitClientWithPlatform(ctx, link.Platform); err != nil {
+			return nil, fmt.Errorf("初始化客户端失败: %w", err)
+		}
+
+		fcSiteID, err := channel.ResolveLink(ctx, link)
+		if err != nil {
+			return nil, fmt.Errorf("获取频道失败: %w", err)
+		}
+		return &target{fcSiteID: fcSiteID, contentCode: link.ContentCode}, nil
+	}
+
+	if err := setupPlatform(ctx, platformName); err != nil {
+		return nil, err
+	}
+
+	fcSiteID, err := resolveChannel(ctx, arg)
+	if err != nil {
+		return nil, err
+	}
+	return &target{fcSiteID: fcSiteID}, nil
+}
+
+// resolveVideoTarget 解析只针对单个视频的子命令的 <频道> 参数，使用频道时由 code 指定视频代码
+func resolveVideoTarget(ctx context.Context, arg string, code string, platformName string) (*target, error) {
+	t, err := resolveTarget(ctx, arg, platformName)
+	if err != nil {
+		return nil, err
+	}
+	if code != "" {
+		t.contentCode = code
+	}
+	if t.contentCode == "" {
+		return nil, fmt.Errorf("需要指定视频链接或 --code")
+	}
+	return t, nil
+}
+
+// resolveChannel 将频道 ID 或频道名解析为 fanclub site ID
+func resolveChannel(ctx context.Context, arg string) (int, error) {
+	if id, err := strconv.Atoi(arg); err == nil {
+		return id, nil
+	}
+
+	channels, err := channel.GetChannelList(ctx)
+	if err != nil {
+		return -1, fmt.Errorf("获取频道列表失败: %w", err)
+	}
+
+	domain := fmt.Sprintf("https://%s/%s", client.CurrentPlatform.Domain, strings.Trim(arg, "/"))
+	for _, ch := range channels {
+		if ch.Domain == domain {
+			return ch.FanclubSite.ID, nil
+		}
+	}
+
+	return -1, fmt.Errorf("未找到频道: %s", arg)
+}
+
+// targetVideos 返回链接指定的单个视频，或频道中符合筛选条件的视频
+func targetVideos(ctx context.Context, t *target, filter *videoFilter) ([]video.VideoDetails, error) {
+	if t.contentCode != "" {
+		return getSingleVideo(ctx, t.fcSiteID, t.contentCode)
+	}
+
+	videoList, err := video.GetVideoList(ctx, t.fcSiteID)
+	if err != nil {
+		return nil, fmt.Errorf("获取视频列表失败: %w", err)
+	}
+	return filter.apply(videoList)
+}
+
+// videoFilter 命令行的视频筛选条件
+type videoFilter struct {
+	codes     string
+	title     string
+	videoType string
+	since     string
+	until     string
+	latest    int
+}
+
+// register 注册筛选参数
+func (f *videoFilter) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.codes, "code", "", "只选择指定的视频代码，多个用逗号分隔")
+	fs.StringVar(&f.title, "title", "", "只选择标题匹配该正则表达式的视频")
+	fs.StringVar(&f.videoType, "type", "all", "视频类型: video（普通视频）、live（生放送）、all")
+	fs.StringVar(&f.since, "since", "", "只选择该日期及之后发布的视频，格式 2006-01-02")
+	fs.StringVar(&f.until, "until", "", "只选择该日期及之前发布的视频，格式 2006-01-02")
+	fs.IntVar(&f.latest, "latest", 0, "只选择最新的 N 个视频")
+}
+
+// validate 检查筛选条件是否有效
+func (f *videoFilter) validate() error {
+	if _, err := regexp.Compile(f.title); err != nil {
+		return fmt.Errorf("无效的 --title: %w", err)
+	}
+
+	for _, date := range []string{f.since, f.until} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("无效的日期 %s，格式应为 2006-01-02", date)
+		}
+	}
+
+	switch f.videoType {
+	case "all", "video", "live":
+	default:
+		return fmt.Errorf("无效的 --type: %s", f.videoType)
+	}
+
+	return nil
+}
+
+// apply 按筛选条件过滤视频
+func (f *videoFilter) apply(videos []video.VideoDetails) ([]video.VideoDetails, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	var titleRegexp *regexp.Regexp
+	if f.title != "" {
+		titleRegexp = regexp.MustCompile(f.title)
+	}
+
+	codes := make(map[string]bool)
+	for _, code := range strings.Split(f.codes, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes[code] = true
+		}
+	}
+
+	var selected []video.VideoDetails
+	for _, v := range videos {
+		if len(codes) > 0 && !codes[v.ContentCode] {
+			continue
+		}
+		if titleRegexp != nil && !titleRegexp.MatchString(v.Title) {
+			continue
+		}
+		if f.videoType == "video" && isLiveArchive(v) || f.videoType == "live" && !isLiveArchive(v) {
+			continue
+		}
+		// display_date 形如 "2024-01-02 20:00:00"，只比较日期部分
+		date := v.DisplayDate
+		if len(date) > 10 {
+			date = date[:10]
+		}
+		if f.since != "" && date < f.since || f.until != "" && date > f.until {
+			continue
+		}
+		selected = append(selected, v)
+	}
+
+	if f.latest > 0 && len(selected) > f.latest {
+		sort.SliceStable(selected, func(i, j int) bool {
+			return selected[i].DisplayDate > selected[j].DisplayDate
+		})
+		selected = selected[:f.latest]
+	}
+
+	return selected, nil
+}
+
+// videoType 返回视频类型的名称
+func videoType(v video.VideoDetails) string {
+	if isLiveArchive(v) {
+		return "live"
+	}
+	return "video"
+}
+
+// runChannels 列出当前平台的频道
+func runChannels(ctx context.Context, args []string) int {
+	fs := newFlagSet("channels", "channels [--platform 平台] [--search 关键字]")
+	platform := registerPlatformFlag(fs)
+	search := fs.String("search", "", "只列出域名包含该关键字的频道")
+	if _, err := parseArgs(fs, args); err != nil {
+		return usageError(fs, err)
+	}
+
+	if err := setupPlatform(ctx, *platform); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	channels, err := channel.GetChannelList(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 获取频道列表失败: %v\n", err)
+		return exitFailure
+	}
+
+	for _, ch := range channels {
+		if strings.Contains(strings.ToLower(ch.Domain), strings.ToLower(*search)) {
+			fmt.Printf("%d\t%s\n", ch.FanclubSite.ID, ch.Domain)
+		}
+	}
+	return exitOK
+}
+
+// runVideos 列出频道中符合条件的视频，或视频链接指定的视频
+func runVideos(ctx context.Context, args []string) int {
+	fs := newFlagSet("videos", "videos <频道> [参数]")
+	platform := registerPlatformFlag(fs)
+	var filter videoFilter
+	filter.register(fs)
+	channelArg, err := parseChannelArgs(fs, args)
+	if err == nil {
+		err = filter.validate()
+	}
+	if err != nil {
+		return usageError(fs, err)
+	}
+
+	t, err := resolveTarget(ctx, channelArg, *platform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	selected, err := targetVideos(ctx, t, &filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	for _, v := range selected {
+		fmt.Printf("%s\t%s\t%s\t%s\n", v.ContentCode, v.DisplayDate, videoType(v), v.Title)
+	}
+	return exitOK
+}
+
+// runDownload 下载频道中符合条件的视频，或视频链接指定的视频，以及相关内容
+func runDownload(ctx context.Context, args []string) int {
+	fs := newFlagSet("download", "download <频道> [--video] [--danmaku] [--thumbnail] [--details] [--news] [--nfo] [参数]")
+	platform := registerPlatformFlag(fs)
+	account := registerAccountFlag(fs)
+	outDir := fs.String("out", defaultOutDir, "输出目录")
+	downloader := fs.String("downloader", "", "视频下载器: native、N_m3u8DL-RE、auto（默认使用 .env 中的 DOWNLOADER）")
+	var options DownloadOptions
+	fs.BoolVar(&options.Video, "video", false, "下载视频")
+	fs.BoolVar(&options.Danmaku, "danmaku", false, "下载弹幕")
+	danmakuFormat := fs.String("danmaku-format", "", "弹幕格式，多个格式用逗号分隔: json、xml、ass（默认使用 .env 中的 DANMAKU_FORMAT）")
+	assResolution := registerASSFlags(fs, &options.ASS)
+	fs.BoolVar(&options.Thumbnail, "thumbnail", false, "下载缩略图")
+	fs.BoolVar(&options.VideoDetails, "details", false, "保存视频详情")
+	fs.BoolVar(&options.News, "news", false, "下载新闻")
+	fs.BoolVar(&options.NFO, "nfo", false, "生成 Kodi、Jellyfin 等媒体库使用的 NFO、海报和缩略图")
+	var filter videoFilter
+	filter.register(fs)
+	channelArg, err := parseChannelArgs(fs, args)
+	if err == nil {
+		err = filter.validate()
+	}
+	if err != nil {
+		return usageError(fs, err)
+	}
+	if !options.HasAnySelection() {
+		return usageError(fs, fmt.Errorf("至少需要指定 --video、--danmaku、--thumbnail、--details、--news、--nfo 中的一项"))
+	}
+	if *downloader == "" {
+		*downloader = config.Load().Downloader
+	}
+	if *downloader, err = config.ParseDownloader(*downloader); err != nil {
+		return usageError(fs, err)
+	}
+	if *danmakuFormat == "" {
+		*danmakuFormat = config.Load().DanmakuFormat
+	}
+	if options.DanmakuFormats, err = danmaku.ParseFormats(*danmakuFormat); err != nil {
+		return usageError(fs, err)
+	}
+	if *assResolution != "" {
+		if options.ASS.Width, options.ASS.Height, err = danmaku.ParseResolution(*assResolution); err != nil {
+			return usageError(fs, err)
+		}
+	}
+
+	auth.SetAccount(*account)
+	t, err := resolveTarget(ctx, channelArg, *platform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	channelInfo, baseSaveDir, err := prepareChannel(ctx, t.fcSiteID, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 获取频道信息失败: %v\n", err)
+		return exitFailure
+	}
+
+	var failCount int
+	if options.News {
+		failCount += downloadNews(ctx, baseSaveDir, t.fcSiteID, channelInfo.ThumbnailImageURL)
+	}
+
+	if options.HasVideoSelection() {
+		selectedVideos, err := targetVideos(ctx, t, &filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitFailure
+		}
+
+		if len(selectedVideos) == 0 {
+			fmt.Println("⚠️  没有符合条件的视频")
+		} else {
+			fmt.Printf("✅ 共选择 %d 个视频\n", len(selectedVideos))
+			failCount += downloadVideoContents(ctx, baseSaveDir, t.fcSiteID, channelInfo, &options, selectedVideos, *downloader)
+		}
+	}
+
+	if failCount > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runNews 下载或列出频道新闻
+func runNews(ctx context.Context, args []string) int {
+	fs := newFlagSet("news", "news <频道> [--list] [参数]")
+	platform := registerPlatformFlag(fs)
+	account := registerAccountFlag(fs)
+	outDir := fs.String("out", defaultOutDir, "输出目录")
+	list := fs.Bool("list", false, "只列出文章，不下载")
+	channelArg, err := parseChannelArgs(fs, args)
+	if err != nil {
+		return usageError(fs, err)
+	}
+
+	auth.SetAccount(*account)
+	t, err := resolveTarget(ctx, channelArg, *platform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	if *list {
+		articles, err := news.GetArticleList(ctx, t.fcSiteID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 获取文章列表失败: %v\n", err)
+			return exitFailure
+		}
+		for _, article := range articles {
+			fmt.Printf("%s\t%s\t%s\n", article.ArticleCode, article.PublishAt, article.ArticelTitle)
+		}
+		return exitOK
+	}
+
+	channelInfo, baseSaveDir, err := prepareChannel(ctx, t.fcSiteID, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 获取频道信息失败: %v\n", err)
+		return exitFailure
+	}
+
+	if downloadNews(ctx, baseSaveDir, t.fcSiteID, channelInfo.ThumbnailImageURL) > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runLive 等待生放送开始，录制直播直到结束，可以同时录制弹幕
+func runLive(ctx context.Context, args []string) int {
+	fs := newFlagSet("live", "live <视频链接> [--chat] [参数]")
+	platform := registerPlatformFlag(fs)
+	account := registerAccountFlag(fs)
+	outDir := fs.String("out", defaultOutDir, "输出目录")
+	code := fs.String("code", "", "生放送的视频代码，<频道> 不是视频链接时需要指定")
+	var options liveOptions
+	fs.BoolVar(&options.chat, "chat", false, "同时录制弹幕到 live_chat.jsonl")
+	fs.DurationVar(&options.poll, "poll", 30*time.Second, "等待直播开始时检查的间隔")
+	channelArg, err := parseChannelArgs(fs, args)
+	if err == nil && *code == "" && !channel.IsLink(channelArg) {
+		err = fmt.Errorf("需要指定视频链接或 --code")
+	}
+	if err != nil {
+		return usageError(fs, err)
+	}
+
+	auth.SetAccount(*account)
+	t, err := resolveVideoTarget(ctx, channelArg, *code, *platform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	_, baseSaveDir, err := prepareChannel(ctx, t.fcSiteID, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 获取频道信息失败: %v\n", err)
+		return exitFailure
+	}
+
+	err = recordLive(ctx, auth.DefaultClient(), t.fcSiteID, t.contentCode, baseSaveDir, options)
+	if errors.Is(err, video.ErrLiveFinished) {
+		fmt.Fprintf(os.Stderr, "❌ 生放送已经结束，请使用 download 下载アーカイブ\n")
+		return exitFailure
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		}
+		return exitFailure
+	}
+	return exitOK
+}
+
+// liveOptions 录制生放送的选项
+type liveOptions struct {
+	poll  time.Duration // 等待直播开始时检查的间隔
+	chat  bool          // 同时录制弹幕
+	quiet bool          // 不打印录制进度，在后台录制时使用
+}
+
+// recordLive 等待生放送开始并录制直到直播结束，保存到视频的目录中
+// 使用 c 访问 API 而不是当前平台的全局客户端，切换平台后也可以继续在后台录制
+func recordLive(ctx context.Context, c *client.Client, fcSiteID int, contentCode string, baseSaveDir string, options liveOptions) error {
+	videoClient := video.NewClient(c)
+
+	waiting := false
+	details, err := videoClient.WaitLiveStart(ctx, fcSiteID, contentCode, options.poll, func(d *video.VideoDetails) {
+		if !waiting {
+			waiting = true
+			fmt.Printf("⏳ %s 预定于 %s 开始，等待直播开始...\n", d.Title, *d.LiveScheduledStartAt)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔴 直播已开始: %s\n", details.Title)
+
+	// 路径模板使用分辨率时使用 c 获取，后台录制其它平台的直播时不能使用当前平台的全局客户端
+	paths, err := getVideoPaths(ctx, c, *details, baseSaveDir)
+	if err != nil {
+		return err
+	}
+	saveDir, saveName := paths.VideoDir()
+	if err := os.MkdirAll(saveDir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	// 有录制进度的输出文件是未完成的录制，其它的检查账本中是否已经录制完成
+	outputFile := filepath.Join(saveDir, saveName+".ts")
+	chatFile := filepath.Join(saveDir, "live_chat.jsonl")
+	videoKey := archive.Key{Platform: c.Platform.Key, FcSiteID: fcSiteID, Code: contentCode, Kind: archive.KindVideo}
+	if _, err := os.Stat(hls.LiveStatePath(saveDir, saveName)); err == nil {
+		fmt.Printf("   检测到未完成的录制，继续录制: %s\n", details.Title)
+	} else if isArchived(baseSaveDir, videoKey, details.ReleasedAt, outputFile) {
+		fmt.Printf("   已录制，跳过: %s\n", outputFile)
+		return nil
+	}
+
+	// 录制失败时同时停止录制弹幕
+	chatCtx, stopChat := context.WithCancel(ctx)
+	defer stopChat()
+	var chatDone chan error
+	var chatRecorded int
+	if options.chat {
+		chatDone = make(chan error, 1)
+		go func() {
+			var err error
+			chatRecorded, err = videoClient.RecordLiveChat(chatCtx, fcSiteID, contentCode, chatFile, video.LiveChatOptions{})
+			chatDone <- err
+		}()
+	}
+
+	// 播放列表使用录制的平台的客户端获取，与其它请求共享重试和限速设置
+	d := hls.New()
+	d.Client = c.HTTP
+	if !options.quiet {
+		d.OnLiveSegment = func(count int, bytes int64) {
+			fmt.Printf("\r   已录制 %d 个分片，%.1f MB", count, float64(bytes)/1024/1024)
+		}
+	}
+	d.OnLiveGap = func(missed int) {
+		fmt.Printf("\n   ⚠️  %s: %d 个分片在录制前已离开播放列表\n", details.Title, missed)
+	}
+	fmt.Printf("   保存到 %s，直播结束后自动停止\n", outputFile)
+	err = d.RecordLive(ctx, hls.LiveSource{
+		// session 过期时重新获取 sessionID，token 由 c.Tokens 自动刷新
+		PlaylistURL: func(ctx context.Context) (string, error) {
+			stream, err := bestStream(ctx, c, contentCode)
+			if err != nil {
+				return "", err
+			}
+			return stream.URL, nil
+		},
+		Finished: func(ctx context.Context) (bool, error) {
+			details, err := videoClient.GetVideoDetails(ctx, fcSiteID, contentCode)
+			if err != nil {
+				return false, err
+			}
+			return !details.IsLive(), nil
+		},
+	}, saveDir, saveName)
+	if !options.quiet {
+		fmt.Println()
+	}
+	if err != nil {
+		stopChat()
+		err = fmt.Errorf("录制 %s 失败: %w", details.Title, err)
+	} else {
+		fmt.Printf("✅ 直播已结束，已保存: %s\n", outputFile)
+		recordArchive(baseSaveDir, videoKey, details.ReleasedAt, outputFile)
+	}
+
+	if chatDone != nil {
+		chatErr := <-chatDone
+		if chatErr != nil && chatCtx.Err() == nil && err == nil {
+			err = fmt.Errorf("录制 %s 的弹幕失败: %w", details.Title, chatErr)
+		}
+		fmt.Printf("💬 %s: 共录制 %d 条弹幕\n", details.Title, chatRecorded)
+		if chatErr == nil {
+			chatKey := videoKey
+			chatKey.Kind = archive.KindLiveChat
+			recordArchive(baseSaveDir, chatKey, details.ReleasedAt, chatFile)
+		}
+	}
+	return err
+}
+
+// runLiveChat 录制生放送的弹幕直到直播结束，弹幕追加到视频目录中的 live_chat.jsonl
+func runLiveChat(ctx context.Context, args []string) int {
+	fs := newFlagSet("live-chat", "live-chat <视频链接> [参数]")
+	platform := registerPlatformFlag(fs)
+	account := registerAccountFlag(fs)
+	outDir := fs.String("out", defaultOutDir, "输出目录")
+	code := fs.String("code", "", "生放送的视频代码，<频道> 不是视频链接时需要指定")
+	interval := fs.Duration("interval", 5*time.Second, "获取新弹幕的间隔")
+	quiet := fs.Bool("quiet", false, "不打印录制到的弹幕")
+	channelArg, err := parseChannelArgs(fs, args)
+	if err == nil && *code == "" && !channel.IsLink(channelArg) {
+		err = fmt.Errorf("需要指定视频链接或 --code")
+	}
+	if err != nil {
+		return usageError(fs, err)
+	}
+
+	auth.SetAccount(*account)
+	t, err := resolveVideoTarget(ctx, channelArg, *code, *platform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	_, baseSaveDir, err := prepareChannel(ctx, t.fcSiteID, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 获取频道信息失败: %v\n", err)
+		return exitFailure
+	}
+	videos, err := getSingleVideo(ctx, t.fcSiteID, t.contentCode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	paths, err := getVideoPaths(ctx, auth.DefaultClient(), videos[0], baseSaveDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+	saveDir, _ := paths.VideoDir()
+	if err := os.MkdirAll(saveDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 创建目录失败: %v\n", err)
+		return exitFailure
+	}
+	path := filepath.Join(saveDir, "live_chat.jsonl")
+
+	options := video.LiveChatOptions{PollInterval: *interval}
+	if !*quiet {
+		options.OnMessage = func(m video.Message) {
+			fmt.Printf("  [%s] %s\n", formatPlaybackTime(m.PlaybackTime), m.Message)
+		}
+	}
+
+	fmt.Printf("🔴 开始录制弹幕: %s，直播结束后自动停止，按 Ctrl+C 中止\n", path)
+	recorded, err := video.RecordLiveChat(ctx, t.fcSiteID, t.contentCode, path, options)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "❌ 录制弹幕失败: %v\n", err)
+		}
+		fmt.Printf("本次共记录 %d 条弹幕\n", recorded)
+		return exitFailure
+	}
+
+	fmt.Printf("✅ 直播已结束，本次共记录 %d 条弹幕\n", recorded)
+	return exitOK
+}
+
+// formatPlaybackTime 将弹幕的时间点格式化为 h:mm:ss
+func formatPlaybackTime(seconds int) string {
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// runLogin 通过浏览器登录，获取并保存 refresh token
+func runLogin(ctx context.Context, args []string) int {
+	fs := newFlagSet("login", "login [--platform 平台] [--account 账号] [--loopback] [--port 端口]")
+	platformName := registerPlatformFlag(fs)
+	account := registerAccountFlag(fs)
+	loopback := fs.Bool("loopback", false, "在本机监听登录回调，需要授权服务器允许 http://127.0.0.1 回调地址")
+	port := fs.Int("port", 0, "--loopback 监听的端口，0 表示随机端口")
+	timeout := fs.Duration("timeout", 5*time.Minute, "--loopback 等待登录的时间")
+	if _, err := parseArgs(fs, args); err != nil {
+		return usageError(fs, err)
+	}
+
+	platform, err := client.FindPlatform(*platformName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	cfg := config.Load()
+
+	var listener net.Listener
+	var redirectURI string
+	if *loopback {
+		if listener, redirectURI, err = auth.ListenLoopback(*port); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitFailure
+		}
+		defer listener.Close()
+	}
+
+	clientID := cfg.ClientID(platform.Key, *account)
+	if clientID == "" {
+		fmt.Fprintf(os.Stderr, "❌ 请设置环境变量 %s 或 NICO_CLIENT_ID\n", config.AccountEnvName("NICO_CLIENT_ID", platform.Key, *account))
+		return exitUsage
+	}
+
+	flow, err := auth.NewLoginFlow(platform, clientID, redirectURI)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 创建登录流程失败: %v\n", err)
+		return exitFailure
+	}
+
+	loginURL := flow.AuthCodeURL()
+	fmt.Printf("🔑 请在浏览器中登录 %s:\n\n%s\n\n", platform.Name, loginURL)
+	openBrowser(loginURL)
+
+	var code string
+	if *loopback {
+		fmt.Println("⏳ 等待浏览器登录...")
+		code, err = flow.WaitForCallback(ctx, listener, *timeout)
+	} else {
+		fmt.Println("登录后浏览器会跳转到新的页面，请复制地址栏中的完整地址并粘贴到这里:")
+		var redirectURL string
+		if redirectURL, err = bufio.NewReader(os.Stdin).ReadString('\n'); err == nil || redirectURL != "" {
+			code, err = flow.CodeFromRedirect(strings.TrimSpace(redirectURL))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	credentials, err := flow.Exchange(ctx, code)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	path, err := auth.SaveLogin(cfg.CredentialsDir, platform, *account, credentials)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Printf("✅ 登录成功，token 已保存到 %s\n", path)
+	return exitOK
+}
+
+// openBrowser 尝试使用系统默认浏览器打开地址，失败时由用户手动打开
+func openBrowser(url string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	_ = cmd.Start()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"ncpd/internal/video"
+)
+
+func TestParseArgs(t *testing.T) {
+	fs := newFlagSet("download", "download <频道>")
+	out := fs.String("out", defaultOutDir, "")
+	videoFlag := fs.Bool("video", false, "")
+
+	positional, err := parseArgs(fs, []string{"--video", "abc", "--out", "/tmp/out"})
+	if err != nil {
+		t.Fatalf("解析参数失败: %v", err)
+	}
+	if !reflect.DeepEqual(positional, []string{"abc"}) {
+		t.Errorf("位置参数错误: %v", positional)
+	}
+	if !*videoFlag || *out != "/tmp/out" {
+		t.Errorf("参数解析错误: video=%v out=%s", *videoFlag, *out)
+	}
+}
+
+func TestParseGlobalArgs(t *testing.T) {
+	args, record, replay, err := parseGlobalArgs([]string{"download", "--record", "/tmp/cassette", "abc", "--video"})
+	if err != nil {
+		t.Fatalf("解析参数失败: %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"download", "abc", "--video"}) || record != "/tmp/cassette" || replay != "" {
+		t.Errorf("参数解析错误: args=%v record=%s replay=%s", args, record, replay)
+	}
+
+	if _, _, replay, _ := parseGlobalArgs([]string{"--replay=/tmp/cassette"}); replay != "/tmp/cassette" {
+		t.Errorf("--replay= 解析错误: %s", replay)
+	}
+
+	for _, args := range [][]string{{"--record"}, {"--record", "a", "--replay", "b"}} {
+		if _, _, _, err := parseGlobalArgs(args); err == nil {
+			t.Errorf("%v 应返回错误", args)
+		}
+	}
+}
+
+func TestVideoFilter(t *testing.T) {
+	started := "2024-02-01 20:00:00"
+	videos := []video.VideoDetails{
+		{ContentCode: "sm1", Title: "第1回 配信", DisplayDate: "2024-01-01 20:00:00"},
+		{ContentCode: "sm2", Title: "第2回 配信", DisplayDate: "2024-02-01 20:00:00", LiveStartedAt: &started},
+		{ContentCode: "sm3", Title: "特別編", DisplayDate: "2024-03-01 20:00:00"},
+	}
+
+	tests := []struct {
+		name   string
+		filter videoFilter
+		want   []string
+	}{
+		{"全部", videoFilter{videoType: "all"}, []string{"sm1", "sm2", "sm3"}},
+		{"视频代码", videoFilter{videoType: "all", codes: "sm1, sm3"}, []string{"sm1", "sm3"}},
+		{"标题", videoFilter{videoType: "all", title: "^第\\d回"}, []string{"sm1", "sm2"}},
+		{"生放送", videoFilter{videoType: "live"}, []string{"sm2"}},
+		{"普通视频", videoFilter{videoType: "video"}, []string{"sm1", "sm3"}},
+		{"日期范围", videoFilter{videoType: "all", since: "2024-02-01", until: "2024-02-01"}, []string{"sm2"}},
+		{"最新", videoFilter{videoType: "all", latest: 2}, []string{"sm3", "sm2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := tt.filter.apply(videos)
+			if err != nil {
+				t.Fatalf("筛选失败: %v", err)
+			}
+			var codes []string
+			for _, v := range selected {
+				codes = append(codes, v.ContentCode)
+			}
+			if !reflect.DeepEqual(codes, tt.want) {
+				t.Errorf("期望 %v，实际 %v", tt.want, codes)
+			}
+		})
+	}
+
+	for _, filter := range []videoFilter{
+		{videoType: "all", title: "("},
+		{videoType: "all", since: "2024/01/01"},
+		{videoType: "archive"},
+	} {
+		if _, err := filter.apply(videos); err == nil {
+			t.Errorf("期望筛选条件 %+v 返回错误", filter)
+		}
+	}
+}
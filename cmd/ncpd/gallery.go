@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ncpd/internal/client"
+	"ncpd/internal/gallery"
+)
+
+// defaultGalleryDir 静态网站默认保存在频道目录中的这个目录
+const defaultGalleryDir = "site"
+
+// runGallery 读取已经下载的频道目录，生成可以离线浏览的静态网站，不需要登录和访问平台
+func runGallery(ctx context.Context, args []string) int {
+	fs := newFlagSet("gallery", "gallery <频道目录> [--out 目录] [--platform 平台]")
+	outDir := fs.String("out", "", "网站的输出目录，默认为频道目录中的 "+defaultGalleryDir)
+	platformName := fs.String("platform", "", "使用哪个平台的样式，默认根据账本中的记录确定")
+	channelDir, err := parseChannelArgs(fs, args)
+	if err != nil {
+		return usageError(fs, err)
+	}
+	if info, err := os.Stat(channelDir); err != nil || !info.IsDir() {
+		return usageError(fs, fmt.Errorf("频道目录 %s 不存在", channelDir))
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join(channelDir, defaultGalleryDir)
+	}
+
+	fmt.Printf("🔍 正在读取频道目录: %s\n", channelDir)
+	ch, err := gallery.Scan(channelDir, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 读取频道目录失败: %v\n", err)
+		return exitFailure
+	}
+
+	// 没有指定平台且账本中没有记录时使用 nicochannel 的样式
+	name := *platformName
+	if name == "" {
+		name = ch.Platform
+	}
+	platform := client.CurrentPlatform
+	if name != "" {
+		if platform, err = client.FindPlatform(name); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitUsage
+		}
+	}
+	templateHTML, err := os.ReadFile(platform.GalleryTemplateFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 读取网站模板失败: %v\n", err)
+		return exitFailure
+	}
+
+	warnings, err := gallery.Generate(ch, string(templateHTML), *outDir)
+	for _, warning := range warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Printf("✅ 已生成 %d 个视频、%d 篇新闻: %s\n", len(ch.Videos), len(ch.Articles), filepath.Join(*outDir, gallery.IndexFile))
+	return exitOK
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"ncpd/config"
+	"ncpd/internal/archive"
+	"ncpd/internal/channel"
+	"ncpd/internal/client"
+	"ncpd/internal/layout"
+	"ncpd/internal/news"
+	"ncpd/internal/video"
+)
+
+// outputLayout 保存位置的模板，启动时从配置中读取
+var outputLayout *layout.Layout
+
+var (
+	channelsMu    sync.Mutex
+	channelValues = make(map[string]layout.Values)  // 频道目录 → 频道的模板字段
+	pathOwners    = make(map[string]*archive.Paths) // 频道目录 → 保存路径的所有者和视频的分辨率
+)
+
+// loadLayout 解析配置中的路径模板
+func loadLayout() error {
+	l, err := layout.Load(config.Load())
+	if err != nil {
+		return err
+	}
+	outputLayout = l
+	return nil
+}
+
+// videoPaths 视频及相关文件的保存位置，都不含扩展名
+type videoPaths struct {
+	Video     string // 视频保存为 Video.ts
+	Thumbnail string // 缩略图保存为 Thumbnail.jpg
+	Danmaku   string // 弹幕按每种格式保存为 Danmaku.<扩展名>
+	Details   string // 视频详情保存为 Details.json
+}
+
+// VideoDir 返回视频所在的目录和不含扩展名的文件名
+func (p videoPaths) VideoDir() (string, string) {
+	return filepath.Dir(p.Video), filepath.Base(p.Video)
+}
+
+// NFO 返回与视频同名的 NFO 和媒体库使用的缩略图
+func (p videoPaths) NFO() (string, string) {
+	return p.Video + ".nfo", p.Video + "-thumb.jpg"
+}
+
+// channelSaveDir 根据模板返回频道的保存目录，并记录频道的字段供视频和新闻的模板使用
+func channelSaveDir(channelInfo *channel.FanclubSiteInfo, fcSiteID int, outDir string) string {
+	values := layout.Values{
+		layout.FieldPlatform:  client.CurrentPlatform.Key,
+		layout.FieldChannel:   channelInfo.FanclubSiteName,
+		layout.FieldChannelID: strconv.Itoa(fcSiteID),
+	}
+	baseSaveDir := filepath.Join(outDir, filepath.FromSlash(outputLayout.Channel.Execute(values)))
+
+	channelsMu.Lock()
+	channelValues[baseSaveDir] = values
+	channelsMu.Unlock()
+	return baseSaveDir
+}
+
+// templateValues 返回包含频道字段的模板字段
+func templateValues(baseSaveDir string) layout.Values {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+
+	values := make(layout.Values)
+	for k, v := range channelValues[baseSaveDir] {
+		values[k] = v
+	}
+	return values
+}
+
+// getVideoPaths 根据模板确定视频及相关文件的保存位置
+// 模板使用分辨率时使用 paths.jsonl 中记录的分辨率，还没有记录时使用 c 获取视频最高画质的分辨率并记录，获取失败时返回错误
+func getVideoPaths(ctx context.Context, c *client.Client, v video.VideoDetails, baseSaveDir string) (videoPaths, error) {
+	var resolution string
+	if usesResolution() {
+		var err error
+		if resolution, err = videoResolution(ctx, c, baseSaveDir, v.ContentCode); err != nil {
+			return videoPaths{}, err
+		}
+	}
+	return renderVideoPaths(v, baseSaveDir, resolution), nil
+}
+
+// savedVideoPaths 与 getVideoPaths 相同但不访问网络，用于检查是否已经保存
+// 模板使用分辨率而还没有记录时返回 false，这时视频的内容还没有保存过
+func savedVideoPaths(v video.VideoDetails, baseSaveDir string) (videoPaths, bool) {
+	var resolution string
+	if usesResolution() {
+		owners := channelPaths(baseSaveDir)
+		if owners == nil {
+			return videoPaths{}, false
+		}
+		var ok bool
+		if resolution, ok = owners.Resolution(v.ContentCode); !ok {
+			return videoPaths{}, false
+		}
+	}
+	return renderVideoPaths(v, baseSaveDir, resolution), true
+}
+
+// renderVideoPaths 使用分辨率 resolution 执行视频相关的模板
+// 视频的路径已经属于其它视频时（如标题相同），在标题后加上视频代码
+func renderVideoPaths(v video.VideoDetails, baseSaveDir string, resolution string) videoPaths {
+	values := templateValues(baseSaveDir)
+	values[layout.FieldContentCode] = v.ContentCode
+	values[layout.FieldTitle] = v.Title
+	values[layout.FieldType] = "動画"
+	if isLiveArchive(v) {
+		values[layout.FieldType] = "生放送"
+	}
+	values[layout.FieldDisplayDate] = v.DisplayDate
+	values[layout.FieldReleasedAt] = v.ReleasedAt
+	values[layout.FieldResolution] = resolution
+
+	templates := []*layout.Template{outputLayout.Video, outputLayout.Thumbnail, outputLayout.Danmaku, outputLayout.Details}
+	rendered := make([]string, len(templates))
+	render := func(suffix string) {
+		for i, t := range templates {
+			rendered[i] = t.Execute(values) + suffix
+		}
+	}
+
+	render("")
+	if !claimPaths(baseSaveDir, v.ContentCode, rendered...) {
+		if outputLayout.Video.Uses(layout.FieldTitle) {
+			values[layout.FieldTitle] = fmt.Sprintf("%s [%s]", v.Title, v.ContentCode)
+			render("")
+		} else {
+			render(" [" + v.ContentCode + "]")
+		}
+		claimPaths(baseSaveDir, v.ContentCode, rendered...)
+	}
+
+	join := func(rel string) string {
+		return filepath.Join(baseSaveDir, filepath.FromSlash(rel))
+	}
+	return videoPaths{
+		Video:     join(rendered[0]),
+		Thumbnail: join(rendered[1]),
+		Danmaku:   join(rendered[2]),
+		Details:   join(rendered[3]),
+	}
+}
+
+// getArticlePath 根据模板返回文章的保存目录和 HTML 文件路径
+// 路径已经属于其它文章时，在标题后加上文章代码
+func getArticlePath(article news.Article, baseSaveDir string) (string, string) {
+	values := templateValues(baseSaveDir)
+	values[layout.FieldArticleCode] = article.ArticleCode
+	values[layout.FieldTitle] = article.ArticelTitle
+	values[layout.FieldType] = "NEWS"
+	values[layout.FieldPublishDate] = article.PublishAt
+
+	rel := outputLayout.News.Execute(values)
+	if !claimPaths(baseSaveDir, article.ArticleCode, rel) {
+		if outputLayout.News.Uses(layout.FieldTitle) {
+			values[layout.FieldTitle] = fmt.Sprintf("%s [%s]", article.ArticelTitle, article.ArticleCode)
+			rel = outputLayout.News.Execute(values)
+		} else {
+			rel += " [" + article.ArticleCode + "]"
+		}
+		claimPaths(baseSaveDir, article.ArticleCode, rel)
+	}
+
+	htmlFile := filepath.Join(baseSaveDir, filepath.FromSlash(rel)) + ".html"
+	return filepath.Dir(htmlFile), htmlFile
+}
+
+// claimPaths 将频道目录中的路径都分配给 code，有路径已经属于其它内容时不分配并返回 false
+// 无法读取或写入记录时只打印警告，按路径没有冲突处理
+func claimPaths(baseSaveDir string, code string, rels ...string) bool {
+	owners := channelPaths(baseSaveDir)
+	if owners == nil {
+		return true
+	}
+	for _, rel := range rels {
+		if !owners.Available(rel, code) {
+			return false
+		}
+	}
+	for _, rel := range rels {
+		if _, err := owners.Claim(rel, code); err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+			break
+		}
+	}
+	return true
+}
+
+// channelPaths 返回频道目录中的路径记录，无法读取时打印警告并返回 nil
+func channelPaths(baseSaveDir string) *archive.Paths {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+
+	owners, ok := pathOwners[baseSaveDir]
+	if !ok {
+		var err error
+		if owners, err = archive.OpenPaths(baseSaveDir); err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+			return nil
+		}
+		pathOwners[baseSaveDir] = owners
+	}
+	return owners
+}
+
+// usesResolution 判断视频相关的模板是否使用了分辨率
+func usesResolution() bool {
+	for _, t := range []*layout.Template{outputLayout.Video, outputLayout.Thumbnail, outputLayout.Danmaku, outputLayout.Details} {
+		if t.Uses(layout.FieldResolution) {
+			return true
+		}
+	}
+	return false
+}
+
+// videoResolution 返回路径中使用的视频分辨率，使用 paths.jsonl 中的记录，没有记录时使用 c 获取最高画质的分辨率并记录
+func videoResolution(ctx context.Context, c *client.Client, baseSaveDir string, contentCode string) (string, error) {
+	if owners := channelPaths(baseSaveDir); owners != nil {
+		if resolution, ok := owners.Resolution(contentCode); ok {
+			return resolution, nil
+		}
+	}
+
+	resolution, err := streamResolution(ctx, c, contentCode)
+	if err == nil && resolution == "" {
+		err = errors.New("没有分辨率信息")
+	}
+	if err != nil {
+		return "", fmt.Errorf("获取 %s 的分辨率失败: %w", contentCode, err)
+	}
+	setVideoResolution(baseSaveDir, contentCode, resolution)
+	return resolution, nil
+}
+
+// setVideoResolution 记录已经获取到的分辨率，已经记录过时保持不变
+func setVideoResolution(baseSaveDir string, contentCode string, resolution string) {
+	owners := channelPaths(baseSaveDir)
+	if owners == nil {
+		return
+	}
+	if err := owners.SetResolution(contentCode, resolution); err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+	}
+}
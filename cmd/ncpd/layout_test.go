@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"ncpd/config"
+	"ncpd/internal/channel"
+	"ncpd/internal/client"
+	"ncpd/internal/layout"
+	"ncpd/internal/news"
+	"ncpd/internal/video"
+)
+
+// setLayout 在测试中使用指定的模板，测试结束后恢复
+func setLayout(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	l, err := layout.Load(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := outputLayout
+	outputLayout = l
+	t.Cleanup(func() { outputLayout = previous })
+}
+
+// defaultLayoutConfig 与默认配置相同的路径模板
+func defaultLayoutConfig() *config.Config {
+	return &config.Config{
+		PathTemplateChannel:   "{platform}/{channel}",
+		PathTemplateVideo:     "{type}/{title}/{title}",
+		PathTemplateThumbnail: "{type}/{title}/thumbnail",
+		PathTemplateDanmaku:   "{type}/{title}/danmaku",
+		PathTemplateDetails:   "{type}/{title}/video_details",
+		PathTemplateNews:      "NEWS/[{publish_date:2006-01-02}] {title}/{title}",
+	}
+}
+
+func TestVideoPaths(t *testing.T) {
+	setLayout(t, defaultLayoutConfig())
+	client.CurrentPlatform = &client.Platform{Key: "nicochannel"}
+
+	outDir := t.TempDir()
+	baseSaveDir := channelSaveDir(&channel.FanclubSiteInfo{FanclubSiteName: "テスト:チャンネル"}, 387, outDir)
+	if want := filepath.Join(outDir, "nicochannel", "テスト_チャンネル"); baseSaveDir != want {
+		t.Errorf("频道目录错误: %s", baseSaveDir)
+	}
+
+	ctx := context.Background()
+	first, _ := getVideoPaths(ctx, nil, video.VideoDetails{ContentCode: "sm1", Title: "同じ"}, baseSaveDir)
+	if first.Video != filepath.Join(baseSaveDir, "動画", "同じ", "同じ") || first.Thumbnail != filepath.Join(baseSaveDir, "動画", "同じ", "thumbnail") {
+		t.Errorf("视频路径错误: %+v", first)
+	}
+
+	// 标题相同的视频在标题后加上视频代码，已经分配的路径不变
+	second, _ := getVideoPaths(ctx, nil, video.VideoDetails{ContentCode: "sm2", Title: "同じ"}, baseSaveDir)
+	if second.Video != filepath.Join(baseSaveDir, "動画", "同じ [sm2]", "同じ [sm2]") || second.Danmaku != filepath.Join(baseSaveDir, "動画", "同じ [sm2]", "danmaku") {
+		t.Errorf("标题相同的视频路径错误: %+v", second)
+	}
+	if again, _ := getVideoPaths(ctx, nil, video.VideoDetails{ContentCode: "sm1", Title: "同じ"}, baseSaveDir); again != first {
+		t.Errorf("同一个视频的路径应保持不变: %+v", again)
+	}
+
+	dir, htmlFile := getArticlePath(news.Article{ArticleCode: "ar1", ArticelTitle: "お知らせ", PublishAt: "2024-02-10 12:00:00"}, baseSaveDir)
+	if htmlFile != filepath.Join(baseSaveDir, "NEWS", "[2024-02-10] お知らせ", "お知らせ.html") || dir != filepath.Dir(htmlFile) {
+		t.Errorf("文章路径错误: %s", htmlFile)
+	}
+}
+
+// 路径中的分辨率记录在 paths.jsonl 中，检查是否已经保存时不访问网络
+func TestVideoPathsResolution(t *testing.T) {
+	cfg := defaultLayoutConfig()
+	cfg.PathTemplateVideo = "{type}/{title} [{resolution}]/{title}"
+	setLayout(t, cfg)
+	client.CurrentPlatform = &client.Platform{Key: "nicochannel"}
+	baseSaveDir := channelSaveDir(&channel.FanclubSiteInfo{FanclubSiteName: "分辨率"}, 1, t.TempDir())
+
+	v := video.VideoDetails{ContentCode: "sm1", Title: "高画質"}
+	if _, ok := savedVideoPaths(v, baseSaveDir); ok {
+		t.Error("还没有记录分辨率时不应返回路径")
+	}
+
+	setVideoResolution(baseSaveDir, "sm1", "1920x1080")
+	channelsMu.Lock()
+	delete(pathOwners, baseSaveDir)
+	channelsMu.Unlock()
+
+	saved, ok := savedVideoPaths(v, baseSaveDir)
+	if !ok || saved.Video != filepath.Join(baseSaveDir, "動画", "高画質 [1920x1080]", "高画質") {
+		t.Errorf("记录分辨率后的路径错误: %+v %v", saved, ok)
+	}
+	if paths, err := getVideoPaths(context.Background(), nil, v, baseSaveDir); err != nil || paths != saved {
+		t.Errorf("应使用记录的分辨率: %+v %v", paths, err)
+	}
+}
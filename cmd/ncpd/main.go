@@ -1,21 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"ncpd/config"
+	"ncpd/internal/archive"
 	"ncpd/internal/auth"
 	"ncpd/internal/channel"
 	"ncpd/internal/client"
+	"ncpd/internal/danmaku"
+	"ncpd/internal/hls"
 	"ncpd/internal/m3u8"
 	"ncpd/internal/news"
 	"ncpd/internal/video"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/huh"
@@ -23,19 +31,76 @@ import (
 
 // DownloadOptions 定义用户选择的下载选项
 type DownloadOptions struct {
-	Video        bool
-	VideoDetails bool
-	Thumbnail    bool
-	Danmaku      bool
-	News         bool
+	Video          bool
+	VideoDetails   bool
+	Thumbnail      bool
+	Danmaku        bool
+	News           bool
+	NFO            bool               // 媒体库（Kodi、Jellyfin）使用的 NFO 和图片
+	DanmakuFormats []danmaku.Format   // 弹幕保存的格式，每种格式保存一个文件
+	ASS            danmaku.ASSOptions // 生成 ASS 弹幕的参数，未指定分辨率时使用视频最高画质的分辨率
 }
 
 // HasAnySelection 检查是否有任何选择
 func (d *DownloadOptions) HasAnySelection() bool {
-	return d.Video || d.VideoDetails || d.Thumbnail || d.Danmaku || d.News
+	return d.HasVideoSelection() || d.News
 }
 
+// HasVideoSelection 检查是否选择了视频相关的内容
+func (d *DownloadOptions) HasVideoSelection() bool {
+	return d.Video || d.VideoDetails || d.Thumbnail || d.Danmaku || d.NFO
+}
+
+// defaultOutDir 默认的输出目录
+const defaultOutDir = "./out"
+
 func main() {
+	// 收到 Ctrl+C 或 SIGTERM 时取消 ctx，正在进行的下载保存进度后退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// 恢复默认的信号处理，再次按下 Ctrl+C 时立即退出
+		stop()
+	}()
+
+	args, record, replay, err := parseGlobalArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if err := loadLayout(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 路径模板无效: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if _, err := config.ParseDownloader(config.Load().Downloader); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ DOWNLOADER 无效: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	cleanup, err := setupCassette(record, replay)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(exitFailure)
+	}
+
+	// 带参数运行时使用命令行模式，否则进入交互模式
+	code := exitOK
+	if len(args) > 0 {
+		code = runCommand(ctx, args)
+	} else {
+		runInteractive(ctx)
+	}
+	cleanup()
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "\n⚠️  已中断，未完成的视频下载进度已保存，再次运行将从中断处继续")
+		code = exitInterrupted
+	}
+	os.Exit(code)
+}
+
+// runInteractive 通过表单让用户选择平台、频道、下载内容和视频
+func runInteractive(ctx context.Context) {
 	// 0. 用户选择平台和频道
 	selectedPlatform, err := selectPlatform()
 	if err != nil {
@@ -44,31 +109,24 @@ func main() {
 	}
 
 	// 初始化客户端
-	if err := client.InitClientWithPlatform(selectedPlatform); err != nil {
+	if err := client.InitClientWithPlatform(ctx, selectedPlatform); err != nil {
 		fmt.Printf("❌ 初始化客户端失败: %v\n", err)
 		return
 	}
 
 	// 用户输入关键词，搜索并选择要下载的频道
-	fcSiteID, err := selectChannelDomain()
+	fcSiteID, err := selectChannelDomain(ctx)
 	if err != nil {
 		fmt.Printf("❌ 选择频道失败: %v\n", err)
 		return
 	}
 
 	// 获取频道信息
-	fmt.Println("🔍 正在获取频道信息...")
-	channelInfo, err := channel.GetFanclubSiteInfo(fcSiteID)
+	channelInfo, baseSaveDir, err := prepareChannel(ctx, fcSiteID, defaultOutDir)
 	if err != nil {
 		fmt.Printf("❌ 获取频道信息失败: %v\n", err)
 		return
 	}
-	fmt.Printf("✅ 频道信息获取成功: %s\n", channelInfo.FanclubSiteName)
-
-	// 创建基础保存目录
-	channelName := sanitizeFilename(channelInfo.FanclubSiteName)
-	baseSaveDir := filepath.Join("./out", channelName)
-	fmt.Printf("📁 保存目录: %s\n", baseSaveDir)
 
 	// 1. 首先询问用户要下载什么类型的内容
 	downloadOptions := selectDownloadOptions()
@@ -79,24 +137,18 @@ func main() {
 
 	// 2. 根据选择的内容类型执行相应的操作
 
-	// 获取频道默认封面地址
-	defaultThumbnailURL := ""
-	if channelInfo != nil {
-		defaultThumbnailURL = channelInfo.ThumbnailImageURL
-	}
-
 	// 如果选择了新闻，先下载新闻
 	if downloadOptions.News {
 		if !confirmNewsDownload() {
 			fmt.Println("\n❌ 用户取消下载新闻，程序退出")
 			return
 		}
-		downloadNews(baseSaveDir, fcSiteID, defaultThumbnailURL)
+		downloadNews(ctx, baseSaveDir, fcSiteID, channelInfo.ThumbnailImageURL)
 	}
 
 	// 如果选择了视频相关的内容，需要获取视频列表
-	if downloadOptions.Video || downloadOptions.VideoDetails || downloadOptions.Thumbnail || downloadOptions.Danmaku {
-		videoList, _ := video.GetVideoList(fcSiteID)
+	if downloadOptions.HasVideoSelection() {
+		videoList, _ := video.GetVideoList(ctx, fcSiteID)
 		fmt.Printf("\n=== 数据获取完成 ===\n")
 		fmt.Printf("总共获取到 %d 个视频\n", len(videoList))
 
@@ -114,29 +166,135 @@ func main() {
 		}
 
 		// 根据选择执行相应的下载任务
-		if downloadOptions.Video {
-			downloadVideos(baseSaveDir, selectedVideos)
-		}
+		downloadVideoContents(ctx, baseSaveDir, fcSiteID, channelInfo, downloadOptions, selectedVideos, config.Load().Downloader)
+	}
 
-		if downloadOptions.VideoDetails {
-			saveVideoDetails(baseSaveDir, fcSiteID, selectedVideos)
-		}
+	// 刷新得到的 refresh_token 已自动保存，无需手动更新 .env；没有刷新过或保存失败时不提示
+	if path, err := auth.CredentialsPath(config.Load().CredentialsDir, client.CurrentPlatform.Domain, ""); err == nil && fileExists(path) {
+		fmt.Printf("\n🔑 最新的 refresh_token 已保存到 %s\n", path)
+	}
+}
 
-		if downloadOptions.Thumbnail {
-			downloadThumbnails(baseSaveDir, selectedVideos, defaultThumbnailURL)
-		}
+// runLink 根据频道或视频链接下载，跳过平台、频道的选择；视频链接同时跳过视频的选择
+func runLink(ctx context.Context, rawURL string) int {
+	link, err := channel.ParseLink(rawURL)
+	if err != nil {
+		fmt.Printf("❌ 解析链接失败: %v\n", err)
+		return exitUsage
+	}
+
+	if err := client.InitClientWithPlatform(ctx, link.Platform); err != nil {
+		fmt.Printf("❌ 初始化客户端失败: %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Printf("🔍 正在查找频道: %s\n", link.ChannelURL())
+	fcSiteID, err := channel.ResolveLink(ctx, link)
+	if err != nil {
+		fmt.Printf("❌ 获取频道失败: %v\n", err)
+		return exitFailure
+	}
 
-		if downloadOptions.Danmaku {
-			downloadDanmaku(baseSaveDir, fcSiteID, selectedVideos)
+	channelInfo, baseSaveDir, err := prepareChannel(ctx, fcSiteID, defaultOutDir)
+	if err != nil {
+		fmt.Printf("❌ 获取频道信息失败: %v\n", err)
+		return exitFailure
+	}
+
+	downloadOptions := selectDownloadOptions()
+	if !downloadOptions.HasAnySelection() {
+		fmt.Println("\n❌ 未选择任何下载内容，程序退出")
+		return exitOK
+	}
+
+	var failCount int
+	if downloadOptions.News {
+		failCount += downloadNews(ctx, baseSaveDir, fcSiteID, channelInfo.ThumbnailImageURL)
+	}
+
+	if downloadOptions.HasVideoSelection() {
+		var selectedVideos []video.VideoDetails
+		if link.ContentCode != "" {
+			if selectedVideos, err = getSingleVideo(ctx, fcSiteID, link.ContentCode); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return exitFailure
+			}
+		} else {
+			videoList, _ := video.GetVideoList(ctx, fcSiteID)
+			if selectedVideos = selectVideos(videoList); len(selectedVideos) == 0 {
+				fmt.Println("\n❌ 未选择任何视频，程序退出")
+				return exitOK
+			}
 		}
+
+		failCount += downloadVideoContents(ctx, baseSaveDir, fcSiteID, channelInfo, downloadOptions, selectedVideos, config.Load().Downloader)
+	}
+
+	if failCount > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// getSingleVideo 获取链接指定的视频
+func getSingleVideo(ctx context.Context, fcSiteID int, contentCode string) ([]video.VideoDetails, error) {
+	fmt.Printf("🔍 正在获取视频信息: %s\n", contentCode)
+	details, err := video.GetVideoDetails(ctx, fcSiteID, contentCode)
+	if err != nil {
+		return nil, fmt.Errorf("获取视频信息失败: %w", err)
+	}
+	if details == nil {
+		return nil, fmt.Errorf("未找到视频: %s", contentCode)
+	}
+
+	fmt.Printf("✅ 视频: %s\n", details.Title)
+	return []video.VideoDetails{*details}, nil
+}
+
+// prepareChannel 获取频道信息，并返回该频道的保存目录
+func prepareChannel(ctx context.Context, fcSiteID int, outDir string) (*channel.FanclubSiteInfo, string, error) {
+	fmt.Println("🔍 正在获取频道信息...")
+	channelInfo, err := channel.GetFanclubSiteInfo(ctx, fcSiteID)
+	if err != nil {
+		return nil, "", err
+	}
+	fmt.Printf("✅ 频道信息获取成功: %s\n", channelInfo.FanclubSiteName)
+
+	// 根据模板确定频道的保存目录
+	baseSaveDir := channelSaveDir(channelInfo, fcSiteID, outDir)
+	fmt.Printf("📁 保存目录: %s\n", baseSaveDir)
+
+	return channelInfo, baseSaveDir, nil
+}
+
+// downloadVideoContents 根据下载选项下载视频相关的内容，返回失败的数量
+func downloadVideoContents(ctx context.Context, baseSaveDir string, fcSiteID int, channelInfo *channel.FanclubSiteInfo, options *DownloadOptions, selectedVideos []video.VideoDetails, downloader string) int {
+	var failCount int
+
+	if options.Video {
+		failCount += downloadVideos(ctx, baseSaveDir, fcSiteID, selectedVideos, downloader)
+	}
+
+	if options.VideoDetails {
+		failCount += saveVideoDetails(ctx, baseSaveDir, fcSiteID, selectedVideos)
+	}
+
+	if options.Thumbnail {
+		failCount += downloadThumbnails(ctx, baseSaveDir, fcSiteID, selectedVideos, channelInfo.ThumbnailImageURL)
+	}
+
+	if options.Danmaku {
+		failCount += downloadDanmaku(ctx, baseSaveDir, fcSiteID, selectedVideos, options.DanmakuFormats, options.ASS)
+	}
+
+	if options.NFO {
+		failCount += saveNFO(ctx, baseSaveDir, fcSiteID, channelInfo, selectedVideos)
 	}
 
-	// 打印 refresh_token 用于后续的 token 刷新
-	fmt.Printf("\n最近的 refresh_token: %s \n", auth.GetRefreshToken())
-	fmt.Printf("请保存到 .env 文件中，用于后续的 token 刷新 \n")
+	return failCount
 }
 
-func downloadVideos(baseSaveDir string, selectedVideos []video.VideoDetails) {
+func downloadVideos(ctx context.Context, baseSaveDir string, fcSiteID int, selectedVideos []video.VideoDetails, downloader string) int {
 	// 记录下载总耗时
 	startTime := time.Now()
 	// 记录成功、失败、跳过的视频数量
@@ -146,12 +304,26 @@ func downloadVideos(baseSaveDir string, selectedVideos []video.VideoDetails) {
 
 	// 遍历选中的视频列表
 	for i, video := range selectedVideos {
+		if ctx.Err() != nil {
+			fmt.Printf("\n⚠️  已取消，跳过剩余的 %d 个视频\n", len(selectedVideos)-i)
+			break
+		}
+
 		// 确定保存路径和文件名
-		saveDir, saveName := getSavePathAndName(video, baseSaveDir)
+		paths, err := getVideoPaths(ctx, auth.DefaultClient(), video, baseSaveDir)
+		if err != nil {
+			fmt.Printf("\n%d. %s\n", i+1, video.Title)
+			fmt.Printf("   ❌ %v\n", err)
+			failCount++
+			failedVideos = append(failedVideos, video.Title)
+			continue
+		}
+		saveDir, saveName := paths.VideoDir()
 
-		// 检查视频文件是否已经存在，如果存在则跳过下载
+		// 检查账本中是否已经保存了视频，如果已保存则跳过下载
 		expectedFile := filepath.Join(saveDir, saveName+".ts")
-		if _, err := os.Stat(expectedFile); err == nil {
+		key := archiveKey(fcSiteID, video.ContentCode, archive.KindVideo)
+		if isArchived(baseSaveDir, key, video.ReleasedAt, expectedFile) {
 			fmt.Printf("\n%d. %s\n", i+1, video.Title)
 			fmt.Printf("   文件已存在，跳过下载: %s\n", expectedFile)
 			skipCount++
@@ -161,33 +333,31 @@ func downloadVideos(baseSaveDir string, selectedVideos []video.VideoDetails) {
 		// 记录单个文件下载开始时间
 		fileStartTime := time.Now()
 
-		// 获取 token（有效期为 5 分钟）
-		token, err := auth.GetToken()
+		// token 由 auth 自动获取和刷新
+		sessionID, err := auth.GetSessionID(ctx, video.ContentCode)
 		if err != nil {
 			fmt.Printf("\n%d. %s\n", i+1, video.Title)
-			fmt.Printf("   ❌ 获取 Token 失败: %v\n", err)
+			fmt.Printf("   ❌ 获取 sessionID 失败: %v\n", err)
 			failCount++
 			failedVideos = append(failedVideos, video.Title)
 			continue
 		}
-
-		sessionID, err := auth.GetSessionID(video.ContentCode, token)
+		index, err := m3u8.GetIndex(ctx, sessionID)
 		if err != nil {
 			fmt.Printf("\n%d. %s\n", i+1, video.Title)
-			fmt.Printf("   ❌ 获取 sessionID 失败: %v\n", err)
+			fmt.Printf("   ❌ 获取 index.m3u8 失败: %v\n", err)
 			failCount++
 			failedVideos = append(failedVideos, video.Title)
 			continue
 		}
-		index, err := m3u8.GetIndex(sessionID)
+		streamInfo, err := m3u8.ParseIndexM3U8(index, m3u8.IndexURL(sessionID))
 		if err != nil {
 			fmt.Printf("\n%d. %s\n", i+1, video.Title)
-			fmt.Printf("   ❌ 获取 index.m3u8 失败: %v\n", err)
+			fmt.Printf("   ❌ 解析 index.m3u8 失败: %v\n", err)
 			failCount++
 			failedVideos = append(failedVideos, video.Title)
 			continue
 		}
-		streamInfo := m3u8.ParseIndexM3U8(index)
 		bestQuality := m3u8.GetBestQuality(streamInfo)
 
 		fmt.Printf("\n%d. %s\n", i+1, video.Title)
@@ -197,13 +367,17 @@ func downloadVideos(baseSaveDir string, selectedVideos []video.VideoDetails) {
 		fmt.Printf("   开始执行下载...\n\n")
 
 		// 执行下载并检查结果
-		if err = downloadVideo(bestQuality.URL, saveDir, saveName); err == nil {
+		if err = downloadVideo(ctx, bestQuality.URL, saveDir, saveName, downloader); err == nil {
 			// 计算单个文件下载耗时
 			fileDuration := time.Since(fileStartTime)
 			fmt.Printf("\n   ✅ 下载成功，耗时: %s\n", formatDuration(fileDuration))
+			recordArchive(baseSaveDir, key, video.ReleasedAt, expectedFile)
 			successCount++
 		} else {
 			fmt.Printf("\n   ❌ 下载失败: %v\n", err)
+			if _, statErr := os.Stat(hls.JournalPath(saveDir, saveName)); statErr == nil {
+				fmt.Printf("   已保存下载进度，再次运行将从中断处继续\n")
+			}
 			failCount++
 			failedVideos = append(failedVideos, video.Title)
 			continue
@@ -228,16 +402,53 @@ func downloadVideos(baseSaveDir string, selectedVideos []video.VideoDetails) {
 		}
 	}
 	fmt.Printf(strings.Repeat("=", 50) + "\n")
+	return failCount
+}
+
+// downloadVideo 根据配置的下载方式下载视频
+func downloadVideo(ctx context.Context, url string, saveDir string, saveName string, downloader string) error {
+	switch downloader {
+	case config.DownloaderExternal:
+		return downloadVideoExternal(ctx, url, saveDir, saveName)
+	case config.DownloaderAuto:
+		err := downloadVideoNative(ctx, url, saveDir, saveName)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		fmt.Printf("\n   ⚠️  内置下载器失败: %v\n   改用 N_m3u8DL-RE 下载...\n\n", err)
+		return downloadVideoExternal(ctx, url, saveDir, saveName)
+	default:
+		return downloadVideoNative(ctx, url, saveDir, saveName)
+	}
+}
+
+// downloadVideoNative 使用内置 HLS 下载器下载视频
+func downloadVideoNative(ctx context.Context, url string, saveDir string, saveName string) error {
+	// 确保保存目录存在
+	if err := os.MkdirAll(saveDir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	d := hls.New()
+	d.OnResume = func(done, total int) {
+		fmt.Printf("   检测到未完成的下载，已完成 %d/%d 个分片，继续下载...\n", done, total)
+	}
+	d.OnProgress = func(done, total int) {
+		fmt.Printf("\r   下载进度: %d/%d 个分片", done, total)
+	}
+
+	return d.Download(ctx, url, saveDir, saveName)
 }
 
-func downloadVideo(url string, saveDir string, saveName string) error {
+// downloadVideoExternal 调用外部 N_m3u8DL-RE 下载视频
+func downloadVideoExternal(ctx context.Context, url string, saveDir string, saveName string) error {
 	// 确保保存目录存在
 	if err := os.MkdirAll(saveDir, 0755); err != nil {
 		return fmt.Errorf("创建目录失败: %w", err)
 	}
 
-	cmd := exec.Command("N_m3u8DL-RE", url,
-		"-H", "User-Agent: Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36",
+	cmd := exec.CommandContext(ctx, "N_m3u8DL-RE", url,
+		"-H", "User-Agent: "+hls.UserAgent,
 		"--save-dir", saveDir,
 		"--save-name", saveName,
 		"--binary-merge", // 防止 ts 分片过多导致合并时报错，开启后输出文件由 .mp4 变为 .ts
@@ -255,22 +466,41 @@ func downloadVideo(url string, saveDir string, saveName string) error {
 	return nil
 }
 
-func saveVideoDetails(baseSaveDir string, fcSiteID int, selectedVideos []video.VideoDetails) {
-	// 记录成功和失败的视频数量
-	var successCount, failCount int
+func saveVideoDetails(ctx context.Context, baseSaveDir string, fcSiteID int, selectedVideos []video.VideoDetails) int {
+	// 记录成功、失败、跳过的视频数量
+	var successCount, failCount, skipCount int
 	// 记录失败的视频列表
 	var failedVideos []string
 
 	for i, v := range selectedVideos {
+		if ctx.Err() != nil {
+			fmt.Printf("\n⚠️  已取消，跳过剩余的 %d 个视频\n", len(selectedVideos)-i)
+			break
+		}
+
 		// 打印视频标题
 		fmt.Printf("\n%d. %s\n", i+1, v.Title)
 
 		// 确定保存路径和文件名
-		saveDir, _ := getSavePathAndName(v, baseSaveDir)
-		saveName := "video_details"
+		paths, err := getVideoPaths(ctx, auth.DefaultClient(), v, baseSaveDir)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			failCount++
+			failedVideos = append(failedVideos, v.Title)
+			continue
+		}
+		videoFile := paths.Details + ".json"
+
+		// 检查账本中是否已经保存了视频详情
+		key := archiveKey(fcSiteID, v.ContentCode, archive.KindDetails)
+		if isArchived(baseSaveDir, key, v.ReleasedAt, videoFile) {
+			fmt.Printf("   已保存，跳过: %s\n", videoFile)
+			skipCount++
+			continue
+		}
 
 		// 获取视频的详细信息
-		videoDetails, err := video.GetVideoDetails(fcSiteID, v.ContentCode)
+		videoDetails, err := video.GetVideoDetails(ctx, fcSiteID, v.ContentCode)
 		if err != nil {
 			fmt.Printf("❌ 获取视频详情失败: %v\n", err)
 			failCount++
@@ -278,7 +508,7 @@ func saveVideoDetails(baseSaveDir string, fcSiteID int, selectedVideos []video.V
 			continue
 		}
 
-		// 保存视频的详细信息，如果文件存在的话直接覆盖
+		// 保存视频的详细信息
 		videoJSON, err := json.MarshalIndent(videoDetails, "", "  ")
 		if err != nil {
 			fmt.Printf("❌ JSON 序列化失败: %v\n", err)
@@ -287,14 +517,13 @@ func saveVideoDetails(baseSaveDir string, fcSiteID int, selectedVideos []video.V
 			continue
 		}
 		// 确保保存目录存在
-		if err := os.MkdirAll(saveDir, 0755); err != nil {
+		if err := os.MkdirAll(filepath.Dir(videoFile), 0755); err != nil {
 			fmt.Printf("❌ 创建目录失败: %v\n", err)
 			failCount++
 			failedVideos = append(failedVideos, v.Title)
 			continue
 		}
 		// 保存视频详情文件
-		videoFile := filepath.Join(saveDir, saveName+".json")
 		if err := os.WriteFile(videoFile, videoJSON, 0644); err != nil {
 			fmt.Printf("❌ 保存视频详情失败: %v\n", err)
 			failCount++
@@ -302,6 +531,7 @@ func saveVideoDetails(baseSaveDir string, fcSiteID int, selectedVideos []video.V
 			continue
 		}
 		fmt.Printf("✅ 已保存视频详情: %s\n", videoFile)
+		recordArchive(baseSaveDir, key, v.ReleasedAt, videoFile)
 		successCount++
 	}
 
@@ -309,6 +539,7 @@ func saveVideoDetails(baseSaveDir string, fcSiteID int, selectedVideos []video.V
 	fmt.Printf("\n" + strings.Repeat("=", 50) + "\n")
 	fmt.Printf("成功保存: %d 个视频详情文件\n", successCount)
 	fmt.Printf("保存失败: %d 个视频详情文件\n", failCount)
+	fmt.Printf("跳过保存: %d 个视频详情文件\n", skipCount)
 	fmt.Printf("总计: %d 个视频详情文件\n", len(selectedVideos))
 
 	if failCount > 0 {
@@ -318,21 +549,41 @@ func saveVideoDetails(baseSaveDir string, fcSiteID int, selectedVideos []video.V
 		}
 	}
 	fmt.Printf(strings.Repeat("=", 50) + "\n")
+	return failCount
 }
 
-func downloadThumbnails(baseSaveDir string, selectedVideos []video.VideoDetails, defaultThumbnailURL string) {
-	// 记录成功和失败的视频数量
-	var successCount, failCount int
+func downloadThumbnails(ctx context.Context, baseSaveDir string, fcSiteID int, selectedVideos []video.VideoDetails, defaultThumbnailURL string) int {
+	// 记录成功、失败、跳过的视频数量
+	var successCount, failCount, skipCount int
 	// 记录失败的视频列表
 	var failedVideos []string
 
 	for i, video := range selectedVideos {
+		if ctx.Err() != nil {
+			fmt.Printf("\n⚠️  已取消，跳过剩余的 %d 个视频\n", len(selectedVideos)-i)
+			break
+		}
+
 		// 打印视频标题
 		fmt.Printf("\n%d. %s\n", i+1, video.Title)
 
 		// 确定保存路径和文件名
-		saveDir, _ := getSavePathAndName(video, baseSaveDir)
-		saveName := "thumbnail"
+		paths, err := getVideoPaths(ctx, auth.DefaultClient(), video, baseSaveDir)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			failCount++
+			failedVideos = append(failedVideos, video.Title)
+			continue
+		}
+		thumbnailFile := paths.Thumbnail + ".jpg"
+
+		// 检查账本中是否已经保存了缩略图
+		key := archiveKey(fcSiteID, video.ContentCode, archive.KindThumbnail)
+		if isArchived(baseSaveDir, key, video.ReleasedAt, thumbnailFile) {
+			fmt.Printf("   已保存，跳过: %s\n", thumbnailFile)
+			skipCount++
+			continue
+		}
 
 		// 确定要下载的缩略图URL
 		thumbnailURL := video.ThumbnailURL
@@ -349,14 +600,14 @@ func downloadThumbnails(baseSaveDir string, selectedVideos []video.VideoDetails,
 		}
 
 		// 下载缩略图
-		thumbnailFile := filepath.Join(saveDir, saveName+".jpg")
-		if err := downloadImage(thumbnailURL, thumbnailFile); err != nil {
+		if err := downloadImage(ctx, thumbnailURL, thumbnailFile); err != nil {
 			fmt.Printf("❌ 下载缩略图失败: %v\n", err)
 			failCount++
 			failedVideos = append(failedVideos, video.Title)
 			continue
 		}
 		fmt.Printf("✅ 已保存缩略图: %s\n", thumbnailFile)
+		recordArchive(baseSaveDir, key, video.ReleasedAt, thumbnailFile)
 		successCount++
 	}
 
@@ -364,6 +615,7 @@ func downloadThumbnails(baseSaveDir string, selectedVideos []video.VideoDetails,
 	fmt.Printf("\n" + strings.Repeat("=", 50) + "\n")
 	fmt.Printf("成功下载: %d 个缩略图\n", successCount)
 	fmt.Printf("下载失败: %d 个缩略图\n", failCount)
+	fmt.Printf("跳过下载: %d 个缩略图\n", skipCount)
 	fmt.Printf("总计: %d 个缩略图\n", len(selectedVideos))
 
 	if failCount > 0 {
@@ -373,9 +625,10 @@ func downloadThumbnails(baseSaveDir string, selectedVideos []video.VideoDetails,
 		}
 	}
 	fmt.Printf(strings.Repeat("=", 50) + "\n")
+	return failCount
 }
 
-func downloadImage(url string, filePath string) error {
+func downloadImage(ctx context.Context, url string, filePath string) error {
 	// 确保保存目录存在
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -383,7 +636,11 @@ func downloadImage(url string, filePath string) error {
 	}
 
 	// 发送HTTP请求下载图片
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("HTTP请求失败: %w", err)
 	}
@@ -409,21 +666,45 @@ func downloadImage(url string, filePath string) error {
 	return nil
 }
 
-func downloadDanmaku(baseSaveDir string, fcSiteID int, selectedVideos []video.VideoDetails) {
-	// 记录成功和失败的视频数量
-	var successCount, failCount int
+func downloadDanmaku(ctx context.Context, baseSaveDir string, fcSiteID int, selectedVideos []video.VideoDetails, formats []danmaku.Format, assOptions danmaku.ASSOptions) int {
+	// 记录成功、失败、跳过的视频数量
+	var successCount, failCount, skipCount int
 	// 记录失败的视频列表
 	var failedVideos []string
 
 	for i, v := range selectedVideos {
+		if ctx.Err() != nil {
+			fmt.Printf("\n⚠️  已取消，跳过剩余的 %d 个视频\n", len(selectedVideos)-i)
+			break
+		}
+
 		// 打印视频标题
 		fmt.Printf("\n%d. %s\n", i+1, v.Title)
 
 		// 确定保存路径和文件名
-		saveDir, _ := getSavePathAndName(v, baseSaveDir)
-		saveName := "danmaku"
+		paths, err := getVideoPaths(ctx, auth.DefaultClient(), v, baseSaveDir)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			failCount++
+			failedVideos = append(failedVideos, v.Title)
+			continue
+		}
+		danmakuPath := paths.Danmaku
+		saveDir, saveName := filepath.Dir(danmakuPath), filepath.Base(danmakuPath)
+		danmakuFiles := make([]string, len(formats))
+		for i, format := range formats {
+			danmakuFiles[i] = danmakuPath + format.Ext()
+		}
 
-		details, err := video.GetVideoDetails(fcSiteID, v.ContentCode)
+		// 检查账本中是否已经保存了每种格式的弹幕
+		key := archiveKey(fcSiteID, v.ContentCode, archive.KindDanmaku)
+		if isArchived(baseSaveDir, key, v.ReleasedAt, danmakuFiles...) {
+			fmt.Printf("   已保存，跳过: %s\n", strings.Join(danmakuFiles, ", "))
+			skipCount++
+			continue
+		}
+
+		details, err := video.GetVideoDetails(ctx, fcSiteID, v.ContentCode)
 		if err != nil {
 			fmt.Printf("❌ 获取视频详情失败: %v\n", err)
 			failCount++
@@ -440,7 +721,7 @@ func downloadDanmaku(baseSaveDir string, fcSiteID int, selectedVideos []video.Vi
 		}
 
 		// 获取评论用户token
-		commentsUserToken, err := video.GetCommentsUserToken(v.ContentCode)
+		commentsUserToken, err := video.GetCommentsUserToken(ctx, v.ContentCode)
 		if err != nil {
 			fmt.Printf("❌ 获取评论用户token失败: %v\n", err)
 			failCount++
@@ -450,7 +731,7 @@ func downloadDanmaku(baseSaveDir string, fcSiteID int, selectedVideos []video.Vi
 
 		// 获取所有弹幕
 		fmt.Printf("  获取弹幕中...\n")
-		allComments, err := video.GetAllComments(commentsUserToken, details.VideoCommentSetting.CommentGroupID)
+		allComments, err := video.GetAllComments(ctx, commentsUserToken, details.VideoCommentSetting.CommentGroupID)
 		if err != nil {
 			fmt.Printf("❌ 获取弹幕失败: %v\n", err)
 			failCount++
@@ -458,15 +739,6 @@ func downloadDanmaku(baseSaveDir string, fcSiteID int, selectedVideos []video.Vi
 			continue
 		}
 
-		// 保存弹幕为JSON文件
-		commentsJSON, err := json.MarshalIndent(allComments, "", "  ")
-		if err != nil {
-			fmt.Printf("❌ JSON序列化失败: %v\n", err)
-			failCount++
-			failedVideos = append(failedVideos, v.Title)
-			continue
-		}
-
 		// 确保保存目录存在
 		if err := os.MkdirAll(saveDir, 0755); err != nil {
 			fmt.Printf("❌ 创建目录失败: %v\n", err)
@@ -475,16 +747,24 @@ func downloadDanmaku(baseSaveDir string, fcSiteID int, selectedVideos []video.Vi
 			continue
 		}
 
-		// 保存弹幕文件
-		danmakuFile := filepath.Join(saveDir, saveName+".json")
-		if err := os.WriteFile(danmakuFile, commentsJSON, 0644); err != nil {
+		// ASS 弹幕默认使用视频最高画质的分辨率
+		videoASSOptions := assOptions
+		if slices.Contains(formats, danmaku.FormatASS) && assOptions.Width == 0 {
+			if resolution, err := streamResolution(ctx, auth.DefaultClient(), v.ContentCode); err != nil {
+				fmt.Printf("⚠️  获取视频分辨率失败: %v，ASS 弹幕使用 1920x1080\n", err)
+			} else {
+				videoASSOptions.Width, videoASSOptions.Height, _ = danmaku.ParseResolution(resolution)
+			}
+		}
+
+		// 每种格式保存一个弹幕文件
+		if err := saveDanmaku(saveDir, saveName, allComments, formats, videoASSOptions); err != nil {
 			fmt.Printf("❌ 保存弹幕失败: %v\n", err)
 			failCount++
 			failedVideos = append(failedVideos, v.Title)
 			continue
 		}
-
-		fmt.Printf("✅ 已保存弹幕: %s (共 %d 条)\n", danmakuFile, len(allComments))
+		recordArchive(baseSaveDir, key, v.ReleasedAt, danmakuFiles...)
 		successCount++
 	}
 
@@ -492,6 +772,7 @@ func downloadDanmaku(baseSaveDir string, fcSiteID int, selectedVideos []video.Vi
 	fmt.Printf("\n" + strings.Repeat("=", 50) + "\n")
 	fmt.Printf("成功下载: %d 个弹幕文件\n", successCount)
 	fmt.Printf("下载失败: %d 个弹幕文件\n", failCount)
+	fmt.Printf("跳过下载: %d 个弹幕文件\n", skipCount)
 	fmt.Printf("总计: %d 个弹幕文件\n", len(selectedVideos))
 
 	if failCount > 0 {
@@ -501,44 +782,104 @@ func downloadDanmaku(baseSaveDir string, fcSiteID int, selectedVideos []video.Vi
 		}
 	}
 	fmt.Printf(strings.Repeat("=", 50) + "\n")
+	return failCount
 }
 
-func downloadNews(baseSaveDir string, fcSiteID int, defaultThumbnailURL string) {
-	fmt.Printf("\n=== 开始下载频道新闻 ===\n")
+// streamResolution 使用 c 返回视频最高画质的分辨率，即下载视频时选择的画质
+func streamResolution(ctx context.Context, c *client.Client, contentCode string) (string, error) {
+	stream, err := bestStream(ctx, c, contentCode)
+	if err != nil {
+		return "", err
+	}
+	return stream.Resolution, nil
+}
 
-	// 获取 token
-	token, err := auth.GetToken()
+// bestStream 使用 c 获取新的 sessionID，返回视频最高画质的流，c.Tokens 不能为空
+func bestStream(ctx context.Context, c *client.Client, contentCode string) (*m3u8.StreamInfo, error) {
+	sessionID, err := video.NewClient(c).GetSessionID(ctx, contentCode)
 	if err != nil {
-		fmt.Printf("❌ 获取 Token 失败: %v\n", err)
-		return
+		return nil, fmt.Errorf("获取 sessionID 失败: %w", err)
 	}
+	playlists := m3u8.NewClient(c)
+	index, err := playlists.GetIndex(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取 index.m3u8 失败: %w", err)
+	}
+	streamInfo, err := m3u8.ParseIndexM3U8(index, playlists.IndexFor(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("解析 index.m3u8 失败: %w", err)
+	}
+	return m3u8.GetBestQuality(streamInfo), nil
+}
+
+// saveDanmaku 将弹幕按每种格式保存为 saveDir/saveName.<扩展名>
+func saveDanmaku(saveDir string, saveName string, messages []video.Message, formats []danmaku.Format, assOptions danmaku.ASSOptions) error {
+	for _, format := range formats {
+		var buf bytes.Buffer
+		dropped, err := danmaku.Write(&buf, format, messages, assOptions)
+		if err != nil {
+			return fmt.Errorf("转换为 %s 格式失败: %w", format, err)
+		}
+
+		danmakuFile := filepath.Join(saveDir, saveName+format.Ext())
+		if err := os.WriteFile(danmakuFile, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已保存弹幕: %s (共 %d 条)\n", danmakuFile, len(messages))
+		if dropped > 0 {
+			fmt.Printf("⚠️  ASS 弹幕丢弃了 %d 条，屏幕上同时显示的弹幕过多\n", dropped)
+		}
+	}
+	return nil
+}
+
+func downloadNews(ctx context.Context, baseSaveDir string, fcSiteID int, defaultThumbnailURL string) int {
+	fmt.Printf("\n=== 开始下载频道新闻 ===\n")
 
 	// 获取文章列表
 	fmt.Println("🔍 正在获取文章列表...")
-	articles, err := news.GetArticleList(fcSiteID)
+	articles, err := news.GetArticleList(ctx, fcSiteID)
 	if err != nil {
 		fmt.Printf("❌ 获取文章列表失败: %v\n", err)
-		return
+		return 1
 	}
 
 	fmt.Printf("✅ 获取到 %d 篇文章\n", len(articles))
+	return downloadArticles(ctx, baseSaveDir, fcSiteID, defaultThumbnailURL, articles)
+}
 
+// downloadArticles 获取文章详情并生成 HTML，返回失败的数量
+func downloadArticles(ctx context.Context, baseSaveDir string, fcSiteID int, defaultThumbnailURL string, articles []news.Article) int {
 	// 读取HTML模板
 	templateHTML, err := os.ReadFile(client.CurrentPlatform.TemplateFile)
 	if err != nil {
 		fmt.Printf("❌ 读取模板文件失败: %v\n", err)
-		return
+		return 1
 	}
 
 	// 处理每篇文章
-	var successCount, failCount int
+	var successCount, failCount, skipCount int
 	var failedArticles []string
 
 	for i, articleSummary := range articles {
+		if ctx.Err() != nil {
+			fmt.Printf("\n⚠️  已取消，跳过剩余的 %d 篇文章\n", len(articles)-i)
+			break
+		}
+
 		fmt.Printf("\n%d. 处理文章: %s\n", i+1, articleSummary.ArticelTitle)
 
+		// 检查账本中是否已经保存了文章
+		_, htmlFile := getArticlePath(articleSummary, baseSaveDir)
+		key := archiveKey(fcSiteID, articleSummary.ArticleCode, archive.KindNews)
+		if isArchived(baseSaveDir, key, articleSummary.PublishAt, htmlFile) {
+			fmt.Printf("   已保存，跳过: %s\n", htmlFile)
+			skipCount++
+			continue
+		}
+
 		// 获取文章详细信息
-		article, err := news.GetArticle(fcSiteID, articleSummary.ArticleCode, token)
+		article, err := news.GetArticle(ctx, fcSiteID, articleSummary.ArticleCode)
 		if err != nil {
 			fmt.Printf("❌ 获取文章详情失败: %v\n", err)
 			failCount++
@@ -555,7 +896,7 @@ func downloadNews(baseSaveDir string, fcSiteID int, defaultThumbnailURL string)
 		}
 
 		// 生成HTML文件
-		if err := generateArticleHTML(article, string(templateHTML), baseSaveDir, defaultThumbnailURL); err != nil {
+		if err := generateArticleHTML(ctx, article, string(templateHTML), baseSaveDir, defaultThumbnailURL); err != nil {
 			fmt.Printf("❌ 生成HTML失败: %v\n", err)
 			failCount++
 			failedArticles = append(failedArticles, articleSummary.ArticelTitle)
@@ -563,6 +904,8 @@ func downloadNews(baseSaveDir string, fcSiteID int, defaultThumbnailURL string)
 		}
 
 		fmt.Printf("✅ 文章处理完成\n")
+		_, htmlFile = getArticlePath(*article, baseSaveDir)
+		recordArchive(baseSaveDir, key, article.PublishAt, htmlFile)
 		successCount++
 	}
 
@@ -571,6 +914,7 @@ func downloadNews(baseSaveDir string, fcSiteID int, defaultThumbnailURL string)
 	fmt.Printf("新闻下载完成！\n")
 	fmt.Printf("成功处理: %d 篇文章\n", successCount)
 	fmt.Printf("处理失败: %d 篇文章\n", failCount)
+	fmt.Printf("跳过处理: %d 篇文章\n", skipCount)
 	fmt.Printf("总计: %d 篇文章\n", len(articles))
 
 	if failCount > 0 {
@@ -580,38 +924,24 @@ func downloadNews(baseSaveDir string, fcSiteID int, defaultThumbnailURL string)
 		}
 	}
 	fmt.Printf(strings.Repeat("=", 50) + "\n")
+	return failCount
 }
 
 // generateArticleHTML 为单篇文章生成HTML文件
-func generateArticleHTML(article *news.Article, templateHTML string, baseSaveDir string, defaultThumbnailURL string) error {
-	// 清理文章标题作为文件夹名
-	cleanTitle := sanitizeFilename(article.ArticelTitle)
-
-	// 格式化发布时间，只保留日期部分（用于目录名，保持 2024-12-18 格式）
-	var publishDate string
-	if len(article.PublishAt) >= 10 {
-		publishDate = article.PublishAt[:10] // 保持 2024-12-18 格式
-	} else {
-		publishDate = article.PublishAt
-	}
-
-	// 构建目录名：格式为 "[2024-12-18] article_title"
-	dirName := fmt.Sprintf("[%s] %s", publishDate, cleanTitle)
-
+func generateArticleHTML(ctx context.Context, article *news.Article, templateHTML string, baseSaveDir string, defaultThumbnailURL string) error {
 	// 创建输出目录
-	outputDir := filepath.Join(baseSaveDir, "NEWS", dirName)
+	outputDir, htmlFilePath := getArticlePath(*article, baseSaveDir)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("创建目录失败: %w", err)
 	}
 
 	// 生成HTML内容，图片保存到文章目录
-	html, err := news.ProcessArticleWithOutputDir(article, templateHTML, outputDir, defaultThumbnailURL)
+	html, err := news.ProcessArticleWithOutputDir(ctx, article, templateHTML, outputDir, defaultThumbnailURL)
 	if err != nil {
 		return fmt.Errorf("处理文章失败: %w", err)
 	}
 
 	// 保存HTML文件
-	htmlFilePath := filepath.Join(outputDir, cleanTitle+".html")
 	if err := os.WriteFile(htmlFilePath, []byte(html), 0644); err != nil {
 		return fmt.Errorf("保存HTML文件失败: %w", err)
 	}
@@ -637,45 +967,6 @@ func isLiveArchive(video video.VideoDetails) bool {
 	return false
 }
 
-// sanitizeFilename 清理文件名，移除或替换特殊字符，使其适用于所有平台
-func sanitizeFilename(filename string) string {
-	// 定义不允许的字符（适用于 Windows、macOS、Linux）
-	invalidChars := regexp.MustCompile(`[<>:"|?*\x00-\x1f\x7f/\\]`)
-
-	// 替换不允许的字符为下划线
-	cleanName := invalidChars.ReplaceAllString(filename, "_")
-
-	// 移除开头和结尾的空格、点号
-	cleanName = strings.Trim(cleanName, " .")
-
-	// 如果清理后为空，使用默认名称
-	if cleanName == "" {
-		cleanName = fmt.Sprintf("untitled_%d", time.Now().Unix())
-	}
-
-	// 限制长度（避免路径过长）
-	if len(cleanName) > 200 {
-		cleanName = cleanName[:200]
-	}
-
-	return cleanName
-}
-
-// getSavePathAndName 根据视频类型确定保存路径和文件名
-func getSavePathAndName(video video.VideoDetails, baseSaveDir string) (string, string) {
-	cleanTitle := sanitizeFilename(video.Title)
-
-	if isLiveArchive(video) {
-		// 生放送 archive：保存到 baseSaveDir/生放送/视频标题/
-		saveDir := filepath.Join(baseSaveDir, "生放送", cleanTitle)
-		return saveDir, cleanTitle
-	} else {
-		// 普通视频：保存到 baseSaveDir/動画/视频标题/
-		saveDir := filepath.Join(baseSaveDir, "動画", cleanTitle)
-		return saveDir, cleanTitle
-	}
-}
-
 // formatDuration 格式化时间显示，便于阅读
 func formatDuration(d time.Duration) string {
 	if d < time.Minute {
@@ -693,7 +984,7 @@ func formatDuration(d time.Duration) string {
 }
 
 // selectChannelDomain 让用户选择频道并返回对应的ID
-func selectChannelDomain() (int, error) {
+func selectChannelDomain(ctx context.Context) (int, error) {
 	for {
 		// 第一步，让用户输入搜索关键字
 		var searchKeyword string
@@ -720,7 +1011,7 @@ func selectChannelDomain() (int, error) {
 
 		// 获取完整的频道列表
 		fmt.Println("🔍 正在获取频道列表...")
-		channels, err := channel.GetChannelList()
+		channels, err := channel.GetChannelList(ctx)
 		if err != nil {
 			fmt.Printf("❌ 获取频道列表失败: %v\n", err)
 			return -1, err
@@ -913,6 +1204,7 @@ func selectDownloadOptions() *DownloadOptions {
 					huh.Option[string]{Key: "视频封面", Value: "视频封面"},
 					huh.Option[string]{Key: "视频弹幕", Value: "视频弹幕"},
 					huh.Option[string]{Key: "视频详细信息", Value: "视频详细信息"},
+					huh.Option[string]{Key: "媒体库元数据（NFO）", Value: "媒体库元数据"},
 					huh.Option[string]{Key: "频道新闻", Value: "频道新闻"},
 				).
 				Value(&selectedOptions),
@@ -925,6 +1217,14 @@ func selectDownloadOptions() *DownloadOptions {
 		return &DownloadOptions{}
 	}
 
+	// 弹幕格式使用 .env 中的 DANMAKU_FORMAT
+	formats, err := danmaku.ParseFormats(config.Load().DanmakuFormat)
+	if err != nil {
+		fmt.Printf("⚠️  DANMAKU_FORMAT 无效: %v，使用 json 格式\n", err)
+		formats = []danmaku.Format{danmaku.FormatJSON}
+	}
+	options.DanmakuFormats = formats
+
 	// 根据选择设置结构体字段
 	for _, option := range selectedOptions {
 		switch option {
@@ -936,6 +1236,8 @@ func selectDownloadOptions() *DownloadOptions {
 			options.Thumbnail = true
 		case "视频弹幕":
 			options.Danmaku = true
+		case "媒体库元数据":
+			options.NFO = true
 		case "频道新闻":
 			options.News = true
 		}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"ncpd/internal/archive"
+	"ncpd/internal/auth"
+	"ncpd/internal/channel"
+	"ncpd/internal/client"
+	"ncpd/internal/nfo"
+	"ncpd/internal/video"
+)
+
+// saveNFO 为视频生成媒体库使用的 NFO 和缩略图，同时在频道目录中生成 tvshow.nfo、poster.jpg、fanart.jpg
+func saveNFO(ctx context.Context, baseSaveDir string, fcSiteID int, channelInfo *channel.FanclubSiteInfo, selectedVideos []video.VideoDetails) int {
+	// 记录成功、失败、跳过的视频数量和失败的视频列表
+	var stats nfoStats
+	if err := saveShowNFO(ctx, baseSaveDir, fcSiteID, channelInfo); err != nil {
+		fmt.Printf("❌ 保存频道的 NFO 失败: %v\n", err)
+		stats.fail(nfo.ShowFile)
+	}
+
+	for i, v := range selectedVideos {
+		if ctx.Err() != nil {
+			fmt.Printf("\n⚠️  已取消，跳过剩余的 %d 个视频\n", len(selectedVideos)-i)
+			break
+		}
+
+		// 打印视频标题
+		fmt.Printf("\n%d. %s\n", i+1, v.Title)
+
+		// NFO 和缩略图与视频同名，媒体库按文件名匹配
+		paths, err := getVideoPaths(ctx, auth.DefaultClient(), v, baseSaveDir)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			stats.fail(v.Title)
+			continue
+		}
+		nfoFile, thumbFile := paths.NFO()
+
+		// 检查账本中是否已经保存了 NFO，缩略图不一定有，记录了时由账本检查是否还存在
+		key := archiveKey(fcSiteID, v.ContentCode, archive.KindNFO)
+		if isArchived(baseSaveDir, key, v.ReleasedAt, nfoFile) {
+			fmt.Printf("   已保存，跳过: %s\n", nfoFile)
+			stats.skipped++
+			continue
+		}
+
+		// 列表中没有简介等信息，需要获取视频的详细信息
+		details, err := video.GetVideoDetails(ctx, fcSiteID, v.ContentCode)
+		if err != nil {
+			fmt.Printf("❌ 获取视频详情失败: %v\n", err)
+			stats.fail(v.Title)
+			continue
+		}
+
+		// 没有缩略图时使用频道的封面，都没有时只保存 NFO
+		files := []string{nfoFile}
+		thumbnailURL := details.ThumbnailURL
+		if thumbnailURL == "" {
+			thumbnailURL = channelInfo.ThumbnailImageURL
+		}
+		if thumbnailURL == "" {
+			fmt.Printf("⚠️  缩略图URL为空且无频道默认封面，只保存 NFO\n")
+		} else {
+			if err := downloadImage(ctx, thumbnailURL, thumbFile); err != nil {
+				fmt.Printf("❌ 下载缩略图失败: %v\n", err)
+				stats.fail(v.Title)
+				continue
+			}
+			files = append(files, thumbFile)
+		}
+
+		episode := nfo.NewEpisode(details, channelInfo.FanclubSiteName, client.CurrentPlatform.Key)
+		if err := nfo.Write(nfoFile, episode); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			stats.fail(v.Title)
+			continue
+		}
+		fmt.Printf("✅ 已保存 NFO: %s\n", nfoFile)
+		recordArchive(baseSaveDir, key, v.ReleasedAt, files...)
+		stats.saved++
+	}
+
+	stats.print(len(selectedVideos))
+	return len(stats.failed)
+}
+
+// nfoStats 记录保存 NFO 的成功、失败、跳过的数量，频道的 tvshow.nfo 失败时也计入失败
+type nfoStats struct {
+	saved, skipped int
+	failed         []string
+}
+
+// fail 记录保存失败的视频或文件
+func (s *nfoStats) fail(name string) {
+	s.failed = append(s.failed, name)
+}
+
+// print 打印最终统计信息，total 为选择的视频数
+func (s *nfoStats) print(total int) {
+	fmt.Printf("\n" + strings.Repeat("=", 50) + "\n")
+	fmt.Printf("成功保存: %d 个 NFO\n", s.saved)
+	fmt.Printf("保存失败: %d 个 NFO\n", len(s.failed))
+	fmt.Printf("跳过保存: %d 个 NFO\n", s.skipped)
+	fmt.Printf("总计: %d 个 NFO\n", total)
+
+	if len(s.failed) > 0 {
+		fmt.Printf("\n失败的 NFO 列表:\n")
+		for i, name := range s.failed {
+			fmt.Printf("  %d. %s\n", i+1, name)
+		}
+	}
+	fmt.Printf(strings.Repeat("=", 50) + "\n")
+}
+
+// saveShowNFO 在频道目录中保存 tvshow.nfo，频道信息可能变化，每次都重新生成
+// 海报和背景图使用频道的封面，已经存在时不重新下载
+func saveShowNFO(ctx context.Context, baseSaveDir string, fcSiteID int, channelInfo *channel.FanclubSiteInfo) error {
+	show := nfo.NewTVShow(channelInfo, client.CurrentPlatform.Key, fcSiteID)
+	if err := nfo.Write(filepath.Join(baseSaveDir, nfo.ShowFile), show); err != nil {
+		return err
+	}
+
+	if channelInfo.ThumbnailImageURL == "" {
+		return nil
+	}
+	for _, name := range []string{nfo.PosterFile, nfo.FanartFile} {
+		path := filepath.Join(baseSaveDir, name)
+		if fileExists(path) {
+			continue
+		}
+		if err := downloadImage(ctx, channelInfo.ThumbnailImageURL, path); err != nil {
+			return fmt.Errorf("下载 %s 失败: %w", name, err)
+		}
+	}
+	return nil
+}
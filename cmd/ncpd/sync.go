@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"ncpd/config"
+	"ncpd/internal/archive"
+	"ncpd/internal/auth"
+	"ncpd/internal/client"
+	"ncpd/internal/danmaku"
+	"ncpd/internal/news"
+	"ncpd/internal/video"
+)
+
+// defaultRecheck 增量同步时默认重新检查最近一周发布的内容
+const defaultRecheck = 7 * 24 * time.Hour
+
+// runSync 增量同步频道：只获取上次同步之后的新内容，重新检查最近的内容是否有变化，下载新的和有变化的内容
+func runSync(ctx context.Context, args []string) int {
+	cfg := config.Load()
+	fs := newFlagSet("sync", "sync <频道> [参数]")
+	platform := registerPlatformFlag(fs)
+	account := registerAccountFlag(fs)
+	outDir := fs.String("out", defaultOutDir, "输出目录")
+	downloader := fs.String("downloader", cfg.Downloader, "视频下载器: native、N_m3u8DL-RE、auto（默认使用 .env 中的 DOWNLOADER）")
+	var options DownloadOptions
+	fs.BoolVar(&options.Video, "video", false, "下载视频")
+	fs.BoolVar(&options.Danmaku, "danmaku", false, "下载弹幕")
+	danmakuFormat := fs.String("danmaku-format", cfg.DanmakuFormat, "弹幕格式，多个格式用逗号分隔: json、xml、ass（默认使用 .env 中的 DANMAKU_FORMAT）")
+	assResolution := registerASSFlags(fs, &options.ASS)
+	fs.BoolVar(&options.Thumbnail, "thumbnail", false, "下载缩略图")
+	fs.BoolVar(&options.VideoDetails, "details", false, "保存视频详情")
+	fs.BoolVar(&options.News, "news", false, "下载新闻")
+	fs.BoolVar(&options.NFO, "nfo", false, "生成 Kodi、Jellyfin 等媒体库使用的 NFO、海报和缩略图")
+	full := fs.Bool("full", false, "获取完整的列表，检查所有内容的变化和删除")
+	recheck := fs.Duration("recheck", defaultRecheck, "重新检查最近多长时间内发布的内容的评论数、缩略图等变化")
+	dryRun := fs.Bool("dry-run", false, "只显示变化，不下载也不保存同步结果")
+	channelArg, err := parseChannelArgs(fs, args)
+	if err != nil {
+		return usageError(fs, err)
+	}
+
+	// 没有指定内容时同步视频、弹幕、缩略图和新闻
+	if !options.HasAnySelection() {
+		options.Video, options.Danmaku, options.Thumbnail, options.News = true, true, true, true
+	}
+	if options.DanmakuFormats, err = danmaku.ParseFormats(*danmakuFormat); err != nil {
+		return usageError(fs, err)
+	}
+	if *downloader, err = config.ParseDownloader(*downloader); err != nil {
+		return usageError(fs, err)
+	}
+	if *assResolution != "" {
+		if options.ASS.Width, options.ASS.Height, err = danmaku.ParseResolution(*assResolution); err != nil {
+			return usageError(fs, err)
+		}
+	}
+
+	auth.SetAccount(*account)
+	t, err := resolveTarget(ctx, channelArg, *platform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+
+	channelInfo, baseSaveDir, err := prepareChannel(ctx, t.fcSiteID, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 获取频道信息失败: %v\n", err)
+		return exitFailure
+	}
+
+	state, err := archive.LoadSyncState(baseSaveDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailure
+	}
+	if state.SyncedAt.IsZero() {
+		fmt.Println("🆕 第一次同步，获取完整的列表")
+	} else {
+		fmt.Printf("🔄 上次同步: %s\n", state.SyncedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	recheckSince := time.Now().Add(-*recheck).In(client.JST).Format("2006-01-02 15:04:05")
+
+	var failCount int
+	listed := true
+	var videos []video.VideoDetails
+	var articles []news.Article
+	var videoChanges, articleChanges archive.Changes
+	if options.HasVideoSelection() {
+		if videos, videoChanges, err = syncVideos(ctx, t.fcSiteID, state, *full, recheckSince); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			failCount++
+			listed = false
+		}
+	}
+	if options.News {
+		if articles, articleChanges, err = syncArticles(ctx, t.fcSiteID, state, *full, recheckSince); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			failCount++
+			listed = false
+		}
+	}
+
+	fmt.Printf("\n" + strings.Repeat("=", 50) + "\n")
+	if options.HasVideoSelection() {
+		printSyncChanges("视频", videoChanges)
+	}
+	if options.News {
+		printSyncChanges("文章", articleChanges)
+	}
+	fmt.Printf(strings.Repeat("=", 50) + "\n")
+
+	if *dryRun {
+		return exitOK
+	}
+
+	// 有变化的内容需要重新保存，之后只下载账本中还没有保存的内容
+	forgetChanged(baseSaveDir, t.fcSiteID, videoChanges, articleChanges)
+
+	var archives []video.VideoDetails
+	for _, v := range videos {
+		if !isUpcomingLive(v) {
+			archives = append(archives, v)
+		}
+	}
+	if options.HasVideoSelection() && len(archives) > 0 {
+		failCount += downloadMissingVideos(ctx, baseSaveDir, t.fcSiteID, channelInfo, &options, *downloader, archives)
+	}
+	if options.News && len(articles) > 0 {
+		failCount += downloadMissingArticles(ctx, baseSaveDir, t.fcSiteID, channelInfo.ThumbnailImageURL, articles)
+	}
+
+	// 没有保存成功的内容不记录到同步结果中，下次同步时作为新内容重新获取和下载
+	if failCount > 0 {
+		dropUnsaved(baseSaveDir, t.fcSiteID, state, &options, archives, articles)
+	}
+
+	// 被中断时不保存，下次同步重新检查；列表没有获取完整时不更新同步时间
+	if ctx.Err() == nil {
+		if listed {
+			state.SyncedAt = time.Now()
+		}
+		if err := state.Save(baseSaveDir); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			failCount++
+		}
+	}
+
+	if failCount > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// syncVideos 获取上次同步之后有变化的视频，遇到一整页都已经同步过且不需要重新检查的视频时停止获取
+func syncVideos(ctx context.Context, fcSiteID int, state *archive.SyncState, full bool, recheckSince string) ([]video.VideoDetails, archive.Changes, error) {
+	stopped := false
+	videos, err := video.GetVideoListUntil(ctx, fcSiteID, func(page []video.VideoDetails) bool {
+		stopped = !full && archive.KnownPage(state.Videos, videoItems(page), recheckSince)
+		return stopped
+	})
+	if err != nil {
+		return nil, archive.Changes{}, fmt.Errorf("获取视频列表失败: %w", err)
+	}
+	return videos, archive.Merge(state.Videos, videoItems(videos), !stopped), nil
+}
+
+// syncArticles 获取上次同步之后有变化的文章，遇到一整页都已经同步过且不需要重新检查的文章时停止获取
+func syncArticles(ctx context.Context, fcSiteID int, state *archive.SyncState, full bool, recheckSince string) ([]news.Article, archive.Changes, error) {
+	stopped := false
+	articles, err := news.GetArticleListUntil(ctx, fcSiteID, func(page []news.Article) bool {
+		stopped = !full && archive.KnownPage(state.Articles, articleItems(page), recheckSince)
+		return stopped
+	})
+	if err != nil {
+		return nil, archive.Changes{}, fmt.Errorf("获取文章列表失败: %w", err)
+	}
+	return articles, archive.Merge(state.Articles, articleItems(articles), !stopped), nil
+}
+
+// videoItems 将视频列表转换为同步比较用的项目
+func videoItems(videos []video.VideoDetails) []archive.Item {
+	items := make([]archive.Item, len(videos))
+	for i, v := range videos {
+		items[i] = archive.Item{
+			Code:      v.ContentCode,
+			Title:     v.Title,
+			Date:      v.DisplayDate,
+			Thumbnail: v.ThumbnailURL,
+			Status:    videoStatus(v),
+		}
+		if items[i].Date == "" {
+			items[i].Date = v.ReleasedAt
+		}
+		if v.VideoAggregateInfo != nil {
+			items[i].Comments = v.VideoAggregateInfo.NumberOfComments
+		}
+	}
+	return items
+}
+
+// videoStatus 返回视频的状态，生放送开始、结束或转为アーカイブ时变化
+func videoStatus(v video.VideoDetails) string {
+	switch {
+	case isUpcomingLive(v) && v.LiveStartedAt == nil:
+		return "live_scheduled"
+	case isUpcomingLive(v):
+		return "live_on_air"
+	case v.ActiveVideoFilename != nil && v.ActiveVideoFilename.VideoFilenameType != nil:
+		return v.ActiveVideoFilename.VideoFilenameType.Value
+	}
+	return ""
+}
+
+// articleItems 将文章列表转换为同步比较用的项目
+func articleItems(articles []news.Article) []archive.Item {
+	items := make([]archive.Item, len(articles))
+	for i, article := range articles {
+		items[i] = archive.Item{
+			Code:      article.ArticleCode,
+			Title:     article.ArticelTitle,
+			Date:      article.PublishAt,
+			Thumbnail: article.ThumbnailURL,
+		}
+	}
+	return items
+}
+
+// forgetChanged 让有变化的内容在账本中失效，下载时重新保存
+// 评论数变化时重新下载弹幕，缩略图变化时重新下载缩略图，视频详情、NFO 和文章有任何变化都重新保存
+func forgetChanged(baseSaveDir string, fcSiteID int, videoChanges archive.Changes, articleChanges archive.Changes) {
+	ledger, err := channelLedger(baseSaveDir)
+	if err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+		return
+	}
+
+	var keys []archive.Key
+	for _, change := range videoChanges.Updated {
+		code := change.After.Code
+		keys = append(keys, archiveKey(fcSiteID, code, archive.KindDetails), archiveKey(fcSiteID, code, archive.KindNFO))
+		if change.Changed(archive.FieldComments) {
+			keys = append(keys, archiveKey(fcSiteID, code, archive.KindDanmaku))
+		}
+		if change.Changed(archive.FieldThumbnail) {
+			keys = append(keys, archiveKey(fcSiteID, code, archive.KindThumbnail))
+		}
+	}
+	for _, change := range articleChanges.Updated {
+		keys = append(keys, archiveKey(fcSiteID, change.After.Code, archive.KindNews))
+	}
+
+	for _, key := range keys {
+		if err := ledger.Forget(key); err != nil {
+			fmt.Printf("⚠️  更新账本失败: %v\n", err)
+		}
+	}
+}
+
+// dropUnsaved 从同步结果中移除还有选择的内容没有保存的视频和文章
+func dropUnsaved(baseSaveDir string, fcSiteID int, state *archive.SyncState, options *DownloadOptions, videos []video.VideoDetails, articles []news.Article) {
+	for _, v := range videos {
+		for _, kind := range selectedKinds(options) {
+			if !videoArchived(baseSaveDir, fcSiteID, options, v, kind) {
+				delete(state.Videos, v.ContentCode)
+				break
+			}
+		}
+	}
+	for _, article := range articles {
+		if !articleArchived(baseSaveDir, fcSiteID, article) {
+			delete(state.Articles, article.ArticleCode)
+		}
+	}
+}
+
+// printSyncChanges 打印一次同步中新增、更新和删除的内容
+func printSyncChanges(name string, changes archive.Changes) {
+	fmt.Printf("📊 %s: 新增 %d，更新 %d，删除 %d\n", name, len(changes.New), len(changes.Updated), len(changes.Removed))
+	for _, item := range changes.New {
+		fmt.Printf("   🆕 %s %s %s\n", item.Date, item.Code, item.Title)
+	}
+	for _, change := range changes.Updated {
+		fmt.Printf("   ✏️  %s %s: %s\n", change.After.Code, change.After.Title, describeChange(change))
+	}
+	for _, item := range changes.Removed {
+		fmt.Printf("   🗑️  %s %s（频道中已删除，保留已保存的文件）\n", item.Code, item.Title)
+	}
+}
+
+// describeChange 描述一个项目变化的字段
+func describeChange(change archive.ItemChange) string {
+	before, after := change.Before, change.After
+	var parts []string
+	for _, field := range change.Fields {
+		switch field {
+		case archive.FieldTitle:
+			parts = append(parts, fmt.Sprintf("标题 %q → %q", before.Title, after.Title))
+		case archive.FieldDate:
+			parts = append(parts, fmt.Sprintf("日期 %s → %s", before.Date, after.Date))
+		case archive.FieldThumbnail:
+			parts = append(parts, "缩略图")
+		case archive.FieldComments:
+			parts = append(parts, fmt.Sprintf("评论数 %d → %d", before.Comments, after.Comments))
+		case archive.FieldStatus:
+			parts = append(parts, fmt.Sprintf("状态 %s → %s", before.Status, after.Status))
+		}
+	}
+	return strings.Join(parts, "、")
+}
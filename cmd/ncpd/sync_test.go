@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ncpd/internal/archive"
+	"ncpd/internal/channel"
+	"ncpd/internal/client"
+	"ncpd/internal/news"
+	"ncpd/internal/video"
+)
+
+func TestVideoItems(t *testing.T) {
+	scheduled := "2024-04-01 20:00:00"
+	videos := []video.VideoDetails{
+		{ContentCode: "sm1", Title: "一", DisplayDate: "2024-03-12 20:00:00", VideoAggregateInfo: &video.VideoAggregateInfo{NumberOfComments: 144}},
+		{ContentCode: "sm2", ReleasedAt: "2024-03-11 20:00:00", LiveScheduledStartAt: &scheduled},
+	}
+
+	items := videoItems(videos)
+	if items[0].Comments != 144 || items[0].Date != "2024-03-12 20:00:00" {
+		t.Errorf("视频项目错误: %+v", items[0])
+	}
+	// 没有显示日期时使用公开日期
+	if items[1].Date != "2024-03-11 20:00:00" || items[1].Status != "live_scheduled" {
+		t.Errorf("生放送项目错误: %+v", items[1])
+	}
+
+	change := archive.ItemChange{
+		Before: archive.Item{Comments: 10},
+		After:  archive.Item{Comments: 12},
+		Fields: []string{archive.FieldComments, archive.FieldThumbnail},
+	}
+	if got := describeChange(change); got != "评论数 10 → 12、缩略图" {
+		t.Errorf("变化描述错误: %s", got)
+	}
+}
+
+// 下载失败的内容不记录到同步结果中，下次增量同步时重新获取
+func TestDropUnsaved(t *testing.T) {
+	setLayout(t, defaultLayoutConfig())
+	client.CurrentPlatform = &client.Platform{Key: "nicochannel"}
+	baseSaveDir := channelSaveDir(&channel.FanclubSiteInfo{FanclubSiteName: "同期"}, 1, t.TempDir())
+
+	ctx := context.Background()
+	saved := video.VideoDetails{ContentCode: "sm1", Title: "保存済み"}
+	failed := video.VideoDetails{ContentCode: "sm2", Title: "失敗"}
+	paths, _ := getVideoPaths(ctx, nil, saved, baseSaveDir)
+	videoFile := paths.Video + ".ts"
+	if err := os.MkdirAll(filepath.Dir(videoFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(videoFile, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	recordArchive(baseSaveDir, archiveKey(1, "sm1", archive.KindVideo), "", videoFile)
+
+	state := &archive.SyncState{
+		Videos:   map[string]archive.Item{"sm1": {Code: "sm1"}, "sm2": {Code: "sm2"}},
+		Articles: map[string]archive.Item{"ar1": {Code: "ar1"}},
+	}
+	articles := []news.Article{{ArticleCode: "ar1", ArticelTitle: "お知らせ"}}
+	dropUnsaved(baseSaveDir, 1, state, &DownloadOptions{Video: true}, []video.VideoDetails{saved, failed}, articles)
+
+	if _, ok := state.Videos["sm1"]; !ok {
+		t.Error("已经保存的视频应保留")
+	}
+	if _, ok := state.Videos["sm2"]; ok {
+		t.Error("没有保存的视频应移除")
+	}
+	if _, ok := state.Articles["ar1"]; ok {
+		t.Error("没有保存的文章应移除")
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ncpd/config"
+	"ncpd/internal/archive"
+	"ncpd/internal/auth"
+	"ncpd/internal/channel"
+	"ncpd/internal/client"
+	"ncpd/internal/danmaku"
+	"ncpd/internal/news"
+	"ncpd/internal/video"
+)
+
+// liveLeadTime 在生放送预定开始时间之前多久开始检查直播是否开始
+const liveLeadTime = 5 * time.Minute
+
+// watchChannel 关注的一个频道
+type watchChannel struct {
+	platform string // 平台名称或域名，使用链接时不需要
+	channel  string // 频道 ID、频道名或频道链接
+}
+
+func (w watchChannel) String() string {
+	if channel.IsLink(w.channel) {
+		return w.channel
+	}
+	return w.platform + ":" + w.channel
+}
+
+// parseWatchChannels 解析逗号分隔的频道列表，每一项为 [平台:]频道，省略平台时为 nicochannel
+func parseWatchChannels(s string) ([]watchChannel, error) {
+	var channels []watchChannel
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if channel.IsLink(item) {
+			channels = append(channels, watchChannel{channel: item})
+			continue
+		}
+
+		ch := watchChannel{platform: "nicochannel", channel: item}
+		if platform, name, ok := strings.Cut(item, ":"); ok {
+			ch.platform, ch.channel = strings.TrimSpace(platform), strings.TrimSpace(name)
+		}
+		if ch.platform == "" || ch.channel == "" {
+			return nil, fmt.Errorf("无效的频道 %q，格式应为 [平台:]频道，如 qlover:abcdef", item)
+		}
+		channels = append(channels, ch)
+	}
+	return channels, nil
+}
+
+// isUpcomingLive 判断视频是否为还没有结束的生放送，这样的视频还不能下载アーカイブ
+func isUpcomingLive(v video.VideoDetails) bool {
+	return v.LiveFinishedAt == nil && (v.LiveScheduledStartAt != nil || v.LiveStartedAt != nil)
+}
+
+// liveStartTime 返回生放送预定开始的时间，已经开始或没有预定时间时返回零值
+func liveStartTime(v video.VideoDetails) time.Time {
+	if v.LiveStartedAt != nil || v.LiveScheduledStartAt == nil {
+		return time.Time{}
+	}
+	start, err := time.ParseInLocation("2006-01-02 15:04:05", *v.LiveScheduledStartAt, client.JST)
+	if err != nil {
+		return time.Time{}
+	}
+	return start
+}
+
+// watcher 定期检查关注的频道，下载还没有保存的内容，并在后台录制生放送
+type watcher struct {
+	outDir      string
+	account     string
+	downloader  string
+	options     DownloadOptions
+	live        bool // 是否录制生放送
+	once        bool // 只检查一次，只录制已经开始的生放送
+	liveOptions liveOptions
+
+	mu    sync.Mutex
+	lives map[string]bool // 已经安排录制的生放送，键为 平台/视频代码
+	wg    sync.WaitGroup  // 正在等待或录制的生放送
+}
+
+// runWatch 定期检查关注的频道，自动下载新的视频、弹幕、缩略图和新闻，并录制生放送
+func runWatch(ctx context.Context, args []string) int {
+	cfg := config.Load()
+	fs := newFlagSet("watch", "watch [频道...] [参数]")
+	account := registerAccountFlag(fs)
+	outDir := fs.String("out", defaultOutDir, "输出目录")
+	downloader := fs.String("downloader", cfg.Downloader, "视频下载器: native、N_m3u8DL-RE、auto（默认使用 .env 中的 DOWNLOADER）")
+	interval := fs.Duration("interval", cfg.WatchInterval, "检查更新的间隔（默认使用 .env 中的 WATCH_INTERVAL）")
+	once := fs.Bool("once", false, "只检查一次，等待正在直播的生放送录制完成后退出，不等待还没有开始的生放送")
+	var options DownloadOptions
+	fs.BoolVar(&options.Video, "video", false, "下载视频")
+	fs.BoolVar(&options.Danmaku, "danmaku", false, "下载弹幕")
+	danmakuFormat := fs.String("danmaku-format", cfg.DanmakuFormat, "弹幕格式，多个格式用逗号分隔: json、xml、ass（默认使用 .env 中的 DANMAKU_FORMAT）")
+	fs.BoolVar(&options.Thumbnail, "thumbnail", false, "下载缩略图")
+	fs.BoolVar(&options.VideoDetails, "details", false, "保存视频详情")
+	fs.BoolVar(&options.News, "news", false, "下载新闻")
+	fs.BoolVar(&options.NFO, "nfo", false, "生成 Kodi、Jellyfin 等媒体库使用的 NFO、海报和缩略图")
+	noLive := fs.Bool("no-live", false, "不录制生放送")
+	var liveOpts liveOptions
+	fs.BoolVar(&liveOpts.chat, "chat", false, "录制生放送时同时录制弹幕")
+	fs.DurationVar(&liveOpts.poll, "poll", 30*time.Second, "等待生放送开始时检查的间隔")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(fs, err)
+	}
+
+	// 命令行指定了频道时不使用 WATCH_CHANNELS
+	sources := positional
+	if len(sources) == 0 {
+		sources = []string{cfg.WatchChannels}
+	}
+	var channels []watchChannel
+	for _, source := range sources {
+		parsed, err := parseWatchChannels(source)
+		if err != nil {
+			return usageError(fs, err)
+		}
+		channels = append(channels, parsed...)
+	}
+	if len(channels) == 0 {
+		return usageError(fs, fmt.Errorf("需要指定频道，或者在 .env 中设置 WATCH_CHANNELS"))
+	}
+	if *interval <= 0 {
+		return usageError(fs, fmt.Errorf("--interval 必须大于 0"))
+	}
+
+	// 没有指定内容时下载视频、弹幕、缩略图和新闻
+	if !options.HasAnySelection() {
+		options.Video, options.Danmaku, options.Thumbnail, options.News = true, true, true, true
+	}
+	if options.DanmakuFormats, err = danmaku.ParseFormats(*danmakuFormat); err != nil {
+		return usageError(fs, err)
+	}
+	if *downloader, err = config.ParseDownloader(*downloader); err != nil {
+		return usageError(fs, err)
+	}
+
+	auth.SetAccount(*account)
+	liveOpts.quiet = true
+	w := &watcher{
+		outDir:      *outDir,
+		account:     *account,
+		downloader:  *downloader,
+		options:     options,
+		live:        !*noLive,
+		once:        *once,
+		liveOptions: liveOpts,
+		lives:       make(map[string]bool),
+	}
+
+	failCount := 0
+	for {
+		fmt.Printf("\n🔄 [%s] 开始检查 %d 个频道\n", time.Now().Format("2006-01-02 15:04:05"), len(channels))
+		for _, ch := range channels {
+			if ctx.Err() != nil {
+				break
+			}
+			failCount += w.check(ctx, ch)
+		}
+
+		if *once || ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("\n💤 下次检查: %s\n", time.Now().Add(*interval).Format("2006-01-02 15:04:05"))
+		select {
+		case <-ctx.Done():
+		case <-time.After(*interval):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// 被中断时录制会保存进度后停止
+	w.wg.Wait()
+	if *once && failCount > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// check 检查一个频道，下载还没有保存的内容并安排生放送的录制，返回失败的数量
+func (w *watcher) check(ctx context.Context, ch watchChannel) int {
+	fmt.Printf("\n📺 %s\n", ch)
+
+	t, err := resolveTarget(ctx, ch.channel, ch.platform)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	platform := client.CurrentPlatform
+
+	channelInfo, baseSaveDir, err := prepareChannel(ctx, t.fcSiteID, w.outDir)
+	if err != nil {
+		fmt.Printf("❌ 获取频道信息失败: %v\n", err)
+		return 1
+	}
+
+	var failCount int
+	if w.options.News {
+		articles, err := news.GetArticleList(ctx, t.fcSiteID)
+		if err != nil {
+			fmt.Printf("❌ 获取文章列表失败: %v\n", err)
+			failCount++
+		} else {
+			failCount += downloadMissingArticles(ctx, baseSaveDir, t.fcSiteID, channelInfo.ThumbnailImageURL, articles)
+		}
+	}
+
+	if !w.options.HasVideoSelection() && !w.live {
+		return failCount
+	}
+
+	videoList, err := video.GetVideoList(ctx, t.fcSiteID)
+	if err != nil {
+		fmt.Printf("❌ 获取视频列表失败: %v\n", err)
+		return failCount + 1
+	}
+
+	var archives []video.VideoDetails
+	for _, v := range videoList {
+		if !isUpcomingLive(v) {
+			archives = append(archives, v)
+		} else if w.live {
+			// 只检查一次时不等待还没有开始的生放送，否则会一直等到预定的开始时间
+			if w.once && v.LiveStartedAt == nil {
+				fmt.Printf("📅 生放送还没有开始，跳过: %s\n", v.Title)
+				continue
+			}
+			w.scheduleLive(ctx, platform, t.fcSiteID, v, baseSaveDir)
+		}
+	}
+	return failCount + downloadMissingVideos(ctx, baseSaveDir, t.fcSiteID, channelInfo, &w.options, w.downloader, archives)
+}
+
+// downloadMissingArticles 下载 articles 中还没有保存的新闻
+func downloadMissingArticles(ctx context.Context, baseSaveDir string, fcSiteID int, defaultThumbnailURL string, articles []news.Article) int {
+	var newArticles []news.Article
+	for _, article := range articles {
+		if !articleArchived(baseSaveDir, fcSiteID, article) {
+			newArticles = append(newArticles, article)
+		}
+	}
+	if len(newArticles) == 0 {
+		fmt.Println("✅ 没有新的文章")
+		return 0
+	}
+
+	fmt.Printf("🆕 %d 篇新文章\n", len(newArticles))
+	return downloadArticles(ctx, baseSaveDir, fcSiteID, defaultThumbnailURL, newArticles)
+}
+
+// articleArchived 判断文章是否已经保存
+func articleArchived(baseSaveDir string, fcSiteID int, article news.Article) bool {
+	_, htmlFile := getArticlePath(article, baseSaveDir)
+	return isArchived(baseSaveDir, archiveKey(fcSiteID, article.ArticleCode, archive.KindNews), article.PublishAt, htmlFile)
+}
+
+// selectedKinds 返回下载选项中选择的视频相关内容，按下载的顺序排列
+func selectedKinds(options *DownloadOptions) []archive.Kind {
+	var kinds []archive.Kind
+	for _, k := range []struct {
+		selected bool
+		kind     archive.Kind
+	}{
+		{options.Video, archive.KindVideo},
+		{options.VideoDetails, archive.KindDetails},
+		{options.Thumbnail, archive.KindThumbnail},
+		{options.Danmaku, archive.KindDanmaku},
+		{options.NFO, archive.KindNFO},
+	} {
+		if k.selected {
+			kinds = append(kinds, k.kind)
+		}
+	}
+	return kinds
+}
+
+// videoFiles 返回视频的 kind 内容保存的文件
+func videoFiles(kind archive.Kind, paths videoPaths, options *DownloadOptions) []string {
+	switch kind {
+	case archive.KindVideo:
+		return []string{paths.Video + ".ts"}
+	case archive.KindDetails:
+		return []string{paths.Details + ".json"}
+	case archive.KindThumbnail:
+		return []string{paths.Thumbnail + ".jpg"}
+	case archive.KindDanmaku:
+		var files []string
+		for _, format := range options.DanmakuFormats {
+			files = append(files, paths.Danmaku+format.Ext())
+		}
+		return files
+	case archive.KindNFO:
+		// 没有缩略图时只保存 NFO，保存了缩略图时由账本检查是否还存在
+		nfoFile, _ := paths.NFO()
+		return []string{nfoFile}
+	}
+	return nil
+}
+
+// videoArchived 判断视频的 kind 内容是否已经保存，只使用记录的路径，不访问网络
+func videoArchived(baseSaveDir string, fcSiteID int, options *DownloadOptions, v video.VideoDetails, kind archive.Kind) bool {
+	paths, ok := savedVideoPaths(v, baseSaveDir)
+	if !ok {
+		return false
+	}
+	files := videoFiles(kind, paths, options)
+	return isArchived(baseSaveDir, archiveKey(fcSiteID, v.ContentCode, kind), v.ReleasedAt, files...)
+}
+
+// downloadMissingVideos 按内容类型分别找出 videos 中还没有保存的内容并下载
+func downloadMissingVideos(ctx context.Context, baseSaveDir string, fcSiteID int, channelInfo *channel.FanclubSiteInfo, options *DownloadOptions, downloader string, videos []video.VideoDetails) int {
+	var failCount int
+	found := false
+	for _, kind := range selectedKinds(options) {
+		var selected []video.VideoDetails
+		for _, v := range videos {
+			if !videoArchived(baseSaveDir, fcSiteID, options, v, kind) {
+				selected = append(selected, v)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		found = true
+		switch kind {
+		case archive.KindVideo:
+			fmt.Printf("🆕 %d 个新视频\n", len(selected))
+			failCount += downloadVideos(ctx, baseSaveDir, fcSiteID, selected, downloader)
+		case archive.KindDetails:
+			failCount += saveVideoDetails(ctx, baseSaveDir, fcSiteID, selected)
+		case archive.KindThumbnail:
+			failCount += downloadThumbnails(ctx, baseSaveDir, fcSiteID, selected, channelInfo.ThumbnailImageURL)
+		case archive.KindDanmaku:
+			failCount += downloadDanmaku(ctx, baseSaveDir, fcSiteID, selected, options.DanmakuFormats, options.ASS)
+		case archive.KindNFO:
+			failCount += saveNFO(ctx, baseSaveDir, fcSiteID, channelInfo, selected)
+		}
+	}
+
+	if !found {
+		fmt.Println("✅ 没有新的视频")
+	}
+	return failCount
+}
+
+// scheduleLive 在后台等待生放送开始并录制，同一个生放送只安排一次，录制失败时下次检查会重新安排
+func (w *watcher) scheduleLive(ctx context.Context, platform *client.Platform, fcSiteID int, v video.VideoDetails, baseSaveDir string) {
+	key := platform.Key + "/" + v.ContentCode
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lives[key] {
+		return
+	}
+
+	// 后台录制时会切换到其它频道的平台，所以使用单独的客户端
+	c := client.New(platform, config.Load())
+	if err := c.Init(ctx); err != nil {
+		fmt.Printf("❌ 安排录制 %s 失败: %v\n", v.Title, err)
+		return
+	}
+	c.Tokens = auth.TokenSource(platform, w.account)
+	w.lives[key] = true
+
+	start := liveStartTime(v)
+	if start.IsZero() {
+		fmt.Printf("🔴 开始录制生放送: %s\n", v.Title)
+	} else {
+		fmt.Printf("📅 已安排录制生放送: %s（%s 开始）\n", v.Title, start.Local().Format("2006-01-02 15:04"))
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		// 提前一段时间开始等待，之后由 recordLive 检查直播是否已经开始
+		if wait := time.Until(start) - liveLeadTime; wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		err := recordLive(ctx, c, fcSiteID, v.ContentCode, baseSaveDir, w.liveOptions)
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("❌ %v\n", err)
+			w.mu.Lock()
+			delete(w.lives, key)
+			w.mu.Unlock()
+		}
+	}()
+}
+
+// fileExists 判断文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ncpd/internal/archive"
+	"ncpd/internal/channel"
+	"ncpd/internal/client"
+	"ncpd/internal/video"
+)
+
+func TestParseWatchChannels(t *testing.T) {
+	channels, err := parseWatchChannels(" 123, qlover:abcdef ,,https://nicochannel.jp/xyz")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	want := []watchChannel{
+		{platform: "nicochannel", channel: "123"},
+		{platform: "qlover", channel: "abcdef"},
+		{channel: "https://nicochannel.jp/xyz"},
+	}
+	if !reflect.DeepEqual(channels, want) {
+		t.Errorf("期望 %+v，实际 %+v", want, channels)
+	}
+
+	for _, s := range []string{"qlover:", ":123"} {
+		if _, err := parseWatchChannels(s); err == nil {
+			t.Errorf("%q 应返回错误", s)
+		}
+	}
+}
+
+func TestUpcomingLive(t *testing.T) {
+	scheduled := "2024-04-01 20:00:00"
+	finished := "2024-04-01 22:00:00"
+
+	upcoming := video.VideoDetails{LiveScheduledStartAt: &scheduled}
+	if !isUpcomingLive(upcoming) {
+		t.Error("预定中的生放送应该被安排录制")
+	}
+	// 预定时间为日本时间
+	if start := liveStartTime(upcoming); !start.Equal(time.Date(2024, 4, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("预定开始时间错误: %s", start)
+	}
+
+	onAir := video.VideoDetails{LiveScheduledStartAt: &scheduled, LiveStartedAt: &scheduled}
+	if !isUpcomingLive(onAir) || !liveStartTime(onAir).IsZero() {
+		t.Error("直播中的生放送应该立即录制")
+	}
+
+	archive := video.VideoDetails{LiveScheduledStartAt: &scheduled, LiveStartedAt: &scheduled, LiveFinishedAt: &finished}
+	if isUpcomingLive(archive) || isUpcomingLive(video.VideoDetails{}) {
+		t.Error("アーカイブ和普通视频应该按视频下载")
+	}
+}
+
+// 没有缩略图时只保存了 NFO，也算已经保存；记录了缩略图时缩略图被删除需要重新保存
+func TestNFOArchived(t *testing.T) {
+	setLayout(t, defaultLayoutConfig())
+	client.CurrentPlatform = &client.Platform{Key: "nicochannel"}
+	baseSaveDir := channelSaveDir(&channel.FanclubSiteInfo{FanclubSiteName: "NFO"}, 1, t.TempDir())
+
+	ctx := context.Background()
+	options := &DownloadOptions{NFO: true}
+	v := video.VideoDetails{ContentCode: "sm1", Title: "サムネなし"}
+	paths, _ := getVideoPaths(ctx, nil, v, baseSaveDir)
+	nfoFile, thumbFile := paths.NFO()
+	if err := os.MkdirAll(filepath.Dir(nfoFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{nfoFile, thumbFile} {
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := archiveKey(1, "sm1", archive.KindNFO)
+	recordArchive(baseSaveDir, key, "", nfoFile)
+	if !videoArchived(baseSaveDir, 1, options, v, archive.KindNFO) {
+		t.Error("只有 NFO 时应已保存")
+	}
+
+	recordArchive(baseSaveDir, key, "", nfoFile, thumbFile)
+	if err := os.Remove(thumbFile); err != nil {
+		t.Fatal(err)
+	}
+	if videoArchived(baseSaveDir, 1, options, v, archive.KindNFO) {
+		t.Error("记录的缩略图被删除后应重新保存")
+	}
+}
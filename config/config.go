@@ -1,16 +1,60 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// 视频下载方式
+const (
+	DownloaderNative   = "native"      // 内置 HLS 下载器
+	DownloaderExternal = "N_m3u8DL-RE" // 调用外部 N_m3u8DL-RE
+	DownloaderAuto     = "auto"        // 优先使用内置下载器，失败时回退到 N_m3u8DL-RE
+)
+
+// ParseDownloader 检查视频下载方式，不区分大小写，返回对应的常量
+func ParseDownloader(s string) (string, error) {
+	for _, downloader := range []string{DownloaderNative, DownloaderExternal, DownloaderAuto} {
+		if strings.EqualFold(strings.TrimSpace(s), downloader) {
+			return downloader, nil
+		}
+	}
+	return "", fmt.Errorf("不支持的视频下载器 %q，可选: %s、%s、%s", s, DownloaderNative, DownloaderExternal, DownloaderAuto)
+}
+
 // Config 存储应用配置
 type Config struct {
-	NicoClientID     string
+	NicoClientID     string // 所有平台共用的默认值，可以用 NICO_CLIENT_ID_<平台> 按平台覆盖
 	NicoRefreshToken string
+	Downloader       string // 视频下载方式: native / N_m3u8DL-RE / auto
+	DanmakuFormat    string // 弹幕保存格式，多个格式用逗号分隔，如 "json,xml"
+	CredentialsDir   string // 保存 token 的目录，为空时使用默认目录
+
+	// 保存位置的模板，频道目录相对于输出目录，其它相对于频道目录，可用的字段见 .env.example
+	PathTemplateChannel   string
+	PathTemplateVideo     string
+	PathTemplateThumbnail string
+	PathTemplateDanmaku   string
+	PathTemplateDetails   string
+	PathTemplateNews      string
+
+	// ncpd watch 的设置
+	WatchChannels string        // 关注的频道，逗号分隔，每一项为 [平台:]频道，如 "nicochannel:123,qlover:abcdef"
+	WatchInterval time.Duration // 检查更新的间隔
+
+	// API 请求的超时、重试和限流
+	APITimeout   time.Duration // 单次请求的超时时间
+	RetryCount   int           // 失败后的最大重试次数，0 表示不重试
+	RetryWait    time.Duration // 第一次重试前的等待时间，之后按指数增长
+	RetryMaxWait time.Duration // 重试前的最长等待时间
+	RateLimit    float64       // 每秒最多发起的请求数，0 表示不限制
+	RateBurst    int           // 允许短时间内连续发起的请求数
 }
 
 // Load 加载配置
@@ -24,19 +68,78 @@ func Load() *Config {
 	}
 
 	config := &Config{
-		NicoClientID:     getEnv("NICO_CLIENT_ID", ""),
-		NicoRefreshToken: getEnv("NICO_REFRESH_TOKEN", ""),
+		NicoClientID:          getEnv("NICO_CLIENT_ID", ""),
+		NicoRefreshToken:      getEnv("NICO_REFRESH_TOKEN", ""),
+		Downloader:            getEnv("DOWNLOADER", DownloaderNative),
+		DanmakuFormat:         getEnv("DANMAKU_FORMAT", "json"),
+		CredentialsDir:        getEnv("CREDENTIALS_DIR", ""),
+		PathTemplateChannel:   getEnv("PATH_TEMPLATE_CHANNEL", "{channel}"),
+		PathTemplateVideo:     getEnv("PATH_TEMPLATE_VIDEO", "{type}/{title}/{title}"),
+		PathTemplateThumbnail: getEnv("PATH_TEMPLATE_THUMBNAIL", "{type}/{title}/thumbnail"),
+		PathTemplateDanmaku:   getEnv("PATH_TEMPLATE_DANMAKU", "{type}/{title}/danmaku"),
+		PathTemplateDetails:   getEnv("PATH_TEMPLATE_DETAILS", "{type}/{title}/video_details"),
+		PathTemplateNews:      getEnv("PATH_TEMPLATE_NEWS", "NEWS/[{publish_date:2006-01-02}] {title}/{title}"),
+		WatchChannels:         getEnv("WATCH_CHANNELS", ""),
+		WatchInterval:         getEnvDuration("WATCH_INTERVAL", 30*time.Minute),
+		APITimeout:            getEnvDuration("API_TIMEOUT", 30*time.Second),
+		RetryCount:            getEnvInt("API_RETRY_COUNT", 3),
+		RetryWait:             getEnvDuration("API_RETRY_WAIT", time.Second),
+		RetryMaxWait:          getEnvDuration("API_RETRY_MAX_WAIT", time.Minute),
+		RateLimit:             getEnvFloat("API_RATE_LIMIT", 5),
+		RateBurst:             getEnvInt("API_RATE_BURST", 10),
 	}
 
-	// 验证必要的配置
-	if config.NicoClientID == "" {
-		log.Fatal("请设置环境变量 NICO_CLIENT_ID")
+	// NICO_CLIENT_ID 可以按平台设置，在获取 token 时再检查
+	// NICO_REFRESH_TOKEN 只在首次使用时需要，之后会使用自动保存的 token
+
+	return config
+}
+
+// ClientID 返回平台和账号对应的 client_id
+// 依次查找 NICO_CLIENT_ID_<平台>_<账号>、NICO_CLIENT_ID_<平台>、NICO_CLIENT_ID
+func (c *Config) ClientID(platformKey string, account string) string {
+	return lookupAccountEnv("NICO_CLIENT_ID", platformKey, account, c.NicoClientID)
+}
+
+// RefreshToken 返回平台和账号对应的 refresh_token，查找顺序与 ClientID 相同
+func (c *Config) RefreshToken(platformKey string, account string) string {
+	return lookupAccountEnv("NICO_REFRESH_TOKEN", platformKey, account, c.NicoRefreshToken)
+}
+
+// AccountEnvName 返回平台和账号对应的环境变量名，如 NICO_CLIENT_ID_QLOVER_MAIN
+func AccountEnvName(name string, platformKey string, account string) string {
+	for _, part := range []string{platformKey, account} {
+		if part != "" {
+			name += "_" + envKey(part)
+		}
 	}
-	if config.NicoRefreshToken == "" {
-		log.Fatal("请设置环境变量 NICO_REFRESH_TOKEN")
+	return name
+}
+
+// lookupAccountEnv 按从具体到通用的顺序查找环境变量
+func lookupAccountEnv(name string, platformKey string, account string, defaultValue string) string {
+	if account != "" {
+		if value := os.Getenv(AccountEnvName(name, platformKey, account)); value != "" {
+			return value
+		}
 	}
+	if value := os.Getenv(AccountEnvName(name, platformKey, "")); value != "" {
+		return value
+	}
+	return defaultValue
+}
 
-	return config
+// envKey 将名称转换为环境变量名的一部分，如 "main-account" → "MAIN_ACCOUNT"
+func envKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
 }
 
 // getEnv 获取环境变量，如果不存在则返回默认值
@@ -46,3 +149,48 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt 获取整数类型的环境变量，不存在或无效时返回默认值
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("环境变量 %s 的值 %q 无效，使用默认值 %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvFloat 获取浮点数类型的环境变量，不存在或无效时返回默认值
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		log.Printf("环境变量 %s 的值 %q 无效，使用默认值 %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+// getEnvDuration 获取时长类型的环境变量，如 "30s"、"1m"，不存在或无效时返回默认值
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("环境变量 %s 的值 %q 无效，使用默认值 %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
@@ -0,0 +1,272 @@
+// Package archive 记录已经下载的内容，保存为频道目录中的 JSON Lines 账本，
+// 每一行是一次保存的记录，同一个内容以最后一行为准
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LedgerFile 账本的文件名
+const LedgerFile = "archive.jsonl"
+
+// Kind 保存的内容类型
+type Kind string
+
+const (
+	KindVideo     Kind = "video"     // 视频或生放送的录制
+	KindDanmaku   Kind = "danmaku"   // 弹幕，每种格式一个文件
+	KindThumbnail Kind = "thumbnail" // 缩略图
+	KindDetails   Kind = "details"   // 视频详情
+	KindLiveChat  Kind = "live_chat" // 直播中录制的弹幕
+	KindNews      Kind = "news"      // 新闻的 HTML
+	KindNFO       Kind = "nfo"       // 媒体库的 NFO 和图片
+)
+
+// Key 标识一个保存的内容
+type Key struct {
+	Platform string `json:"platform"`   // 平台的 Key
+	FcSiteID int    `json:"fc_site_id"` // 频道
+	Code     string `json:"code"`       // 视频代码或文章代码
+	Kind     Kind   `json:"kind"`
+}
+
+// File 保存的一个文件
+type File struct {
+	Path   string `json:"path"` // 相对于账本所在目录的路径，使用 / 分隔
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Entry 账本中的一条记录
+type Entry struct {
+	Key
+	Files      []File    `json:"files"`
+	ReleasedAt string    `json:"released_at"` // 视频的 ReleasedAt 或文章的 PublishAt
+	SavedAt    time.Time `json:"saved_at"`
+	Forgotten  bool      `json:"forgotten,omitempty"` // 内容有更新，需要重新保存
+}
+
+// Ledger 一个目录的账本
+type Ledger struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[Key]Entry // 包括 Forget 之后的记录
+}
+
+// Open 读取 dir 中的账本，账本不存在时返回空的账本，第一次记录时创建
+// 上次写入中断时最后一行可能不完整，跳过无法解析的行
+func Open(dir string) (*Ledger, error) {
+	l := &Ledger{dir: dir, entries: make(map[Key]Entry)}
+
+	file, err := os.Open(l.Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开账本失败: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Code == "" {
+			continue
+		}
+		l.entries[entry.Key] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取账本失败: %w", err)
+	}
+	return l, nil
+}
+
+// Path 返回账本文件的路径
+func (l *Ledger) Path() string {
+	return filepath.Join(l.dir, LedgerFile)
+}
+
+// Get 返回 key 对应的记录
+func (l *Ledger) Get(key Key) (Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[key]
+	return entry, ok && !entry.Forgotten
+}
+
+// Seen 判断账本中是否有过 key 的记录，包括 Forget 之后的记录
+func (l *Ledger) Seen(key Key) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.entries[key]
+	return ok
+}
+
+// Has 判断 key 对应的内容是否已经保存：有记录，记录中包含 paths 中的每个文件，
+// 并且记录的文件都还存在、大小没有变化
+func (l *Ledger) Has(key Key, paths ...string) bool {
+	entry, ok := l.Get(key)
+	if !ok {
+		return false
+	}
+
+	recorded := make(map[string]bool)
+	for _, file := range entry.Files {
+		info, err := os.Stat(l.abs(file.Path))
+		if err != nil || info.Size() != file.Size {
+			return false
+		}
+		recorded[file.Path] = true
+	}
+	for _, path := range paths {
+		rel, err := l.rel(path)
+		if err != nil || !recorded[rel] {
+			return false
+		}
+	}
+	return true
+}
+
+// Record 记录 key 对应的内容已经保存为 paths，计算每个文件的大小和 SHA-256 后追加到账本
+func (l *Ledger) Record(key Key, releasedAt string, paths ...string) (Entry, error) {
+	entry := Entry{Key: key, ReleasedAt: releasedAt, SavedAt: time.Now()}
+	for _, path := range paths {
+		rel, err := l.rel(path)
+		if err != nil {
+			return Entry{}, err
+		}
+		size, sum, err := hashFile(path)
+		if err != nil {
+			return Entry{}, fmt.Errorf("计算文件哈希失败: %w", err)
+		}
+		entry.Files = append(entry.Files, File{Path: rel, Size: size, SHA256: sum})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.append(entry); err != nil {
+		return Entry{}, err
+	}
+	l.entries[key] = entry
+	return entry, nil
+}
+
+// Forget 记录 key 对应的内容有更新，之后 Has 返回 false，直到再次调用 Record
+// 已经保存的文件不会被删除
+func (l *Ledger) Forget(key Key) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry, ok := l.entries[key]; !ok || entry.Forgotten {
+		return nil
+	}
+	entry := Entry{Key: key, SavedAt: time.Now(), Forgotten: true}
+	if err := l.append(entry); err != nil {
+		return err
+	}
+	l.entries[key] = entry
+	return nil
+}
+
+// append 将一条记录追加到账本文件，调用时需要持有 l.mu
+func (l *Ledger) append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	file, err := os.OpenFile(l.Path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开账本失败: %w", err)
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入账本失败: %w", err)
+	}
+	return nil
+}
+
+// Entries 返回所有已经保存的记录，按平台、频道、代码和类型排序
+func (l *Ledger) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]Entry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		if !entry.Forgotten {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Key, entries[j].Key
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		if a.FcSiteID != b.FcSiteID {
+			return a.FcSiteID < b.FcSiteID
+		}
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		return a.Kind < b.Kind
+	})
+	return entries
+}
+
+// abs 将账本中的相对路径转换为文件路径
+func (l *Ledger) abs(rel string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(rel))
+}
+
+// rel 将文件路径转换为相对于账本所在目录的路径，文件必须在该目录中
+func (l *Ledger) rel(path string) (string, error) {
+	dir, err := filepath.Abs(l.dir)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || rel == ".." || filepath.IsAbs(rel) || len(rel) > 2 && rel[:3] == ".."+string(filepath.Separator) {
+		return "", fmt.Errorf("%s 不在账本目录 %s 中", path, l.dir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// hashFile 返回文件的大小和 SHA-256
+func hashFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// go test -v ./internal/archive
+func TestLedger(t *testing.T) {
+	dir := t.TempDir()
+	videoFile := filepath.Join(dir, "動画", "テスト", "テスト.ts")
+	os.MkdirAll(filepath.Dir(videoFile), 0755)
+	if err := os.WriteFile(videoFile, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开账本失败: %v", err)
+	}
+	key := Key{Platform: "nicochannel", FcSiteID: 387, Code: "sm1", Kind: KindVideo}
+	if l.Has(key) {
+		t.Fatal("空的账本不应有记录")
+	}
+
+	entry, err := l.Record(key, "2024-03-12 20:00:00", videoFile)
+	if err != nil {
+		t.Fatalf("记录失败: %v", err)
+	}
+	file := entry.Files[0]
+	if file.Path != "動画/テスト/テスト.ts" || file.Size != 5 ||
+		file.SHA256 != "0cab1c9617404faf2b24e221e189ca5945813e14d3f766345b09ca13bbe28ffc" {
+		t.Errorf("记录的文件错误: %+v", file)
+	}
+
+	// 重新打开后读取到相同的记录
+	l, err = Open(dir)
+	if err != nil {
+		t.Fatalf("打开账本失败: %v", err)
+	}
+	if !l.Has(key, videoFile) {
+		t.Error("重新打开后应有记录")
+	}
+	if l.Has(key, filepath.Join(dir, "other.ts")) {
+		t.Error("没有记录的文件不应算作已保存")
+	}
+
+	// 文件被修改或删除后需要重新下载
+	os.WriteFile(videoFile, []byte("truncated video"), 0644)
+	if l.Has(key) {
+		t.Error("文件大小变化后不应算作已保存")
+	}
+	os.Remove(videoFile)
+	if l.Has(key) {
+		t.Error("文件删除后不应算作已保存")
+	}
+
+	if _, err := l.Record(Key{Code: "sm2", Kind: KindVideo}, "", filepath.Join(t.TempDir(), "x.ts")); err == nil {
+		t.Error("账本目录之外的文件应返回错误")
+	}
+}
+
+// 同一个内容以最后一条记录为准，跳过不完整的行
+func TestLedgerLatestEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "danmaku.json")
+	os.WriteFile(path, []byte("[]"), 0644)
+
+	l, _ := Open(dir)
+	key := Key{Platform: "nicochannel", FcSiteID: 387, Code: "sm1", Kind: KindDanmaku}
+	l.Record(key, "2024-03-12 20:00:00", path)
+	os.WriteFile(path, []byte("[{}]"), 0644)
+	l.Record(key, "2024-03-12 20:00:00", path)
+	l.Record(Key{Platform: "nicochannel", FcSiteID: 387, Code: "ar1", Kind: KindNews}, "2024-03-13 12:00:00")
+
+	f, _ := os.OpenFile(l.Path(), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"platform":"nico`)
+	f.Close()
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatalf("打开账本失败: %v", err)
+	}
+	entries := l.Entries()
+	if len(entries) != 2 || entries[0].Code != "ar1" || entries[1].Files[0].Size != 4 {
+		t.Errorf("记录错误: %+v", entries)
+	}
+	if !l.Has(key, path) {
+		t.Error("最后一条记录应与文件一致")
+	}
+}
@@ -0,0 +1,136 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PathsFile 记录频道目录中每个保存路径属于哪个视频或文章，用于处理生成相同路径的内容；
+// 同时记录路径模板中使用的视频分辨率，之后计算路径时不需要再次获取
+const PathsFile = "paths.jsonl"
+
+// pathOwner paths.jsonl 中的一行，记录分辨率的行没有 path
+type pathOwner struct {
+	Path       string `json:"path,omitempty"`
+	Code       string `json:"code"`
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// Paths 频道目录中保存路径的所有者
+type Paths struct {
+	dir string
+
+	mu          sync.Mutex
+	owners      map[string]string // 相对于频道目录的路径 → 视频代码或文章代码
+	resolutions map[string]string // 视频代码 → 路径中使用的分辨率
+}
+
+// OpenPaths 读取 dir 中保存路径的所有者和视频的分辨率，跳过无法解析的行
+func OpenPaths(dir string) (*Paths, error) {
+	p := &Paths{dir: dir, owners: make(map[string]string), resolutions: make(map[string]string)}
+
+	file, err := os.Open(filepath.Join(dir, PathsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开路径记录失败: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var owner pathOwner
+		if json.Unmarshal(scanner.Bytes(), &owner) != nil {
+			continue
+		}
+		if owner.Path != "" {
+			if _, ok := p.owners[owner.Path]; !ok {
+				p.owners[owner.Path] = owner.Code
+			}
+		}
+		if owner.Resolution != "" && owner.Code != "" {
+			if _, ok := p.resolutions[owner.Code]; !ok {
+				p.resolutions[owner.Code] = owner.Resolution
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取路径记录失败: %w", err)
+	}
+	return p, nil
+}
+
+// Available 判断相对于频道目录的 path 是否还没有分配或者已经属于 code
+func (p *Paths) Available(path string, code string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	owner, ok := p.owners[path]
+	return !ok || owner == code
+}
+
+// Claim 将相对于频道目录的 path 分配给 code，path 已经属于其它内容时返回 false
+func (p *Paths) Claim(path string, code string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if owner, ok := p.owners[path]; ok {
+		return owner == code, nil
+	}
+	if err := p.append(pathOwner{Path: path, Code: code}); err != nil {
+		return false, err
+	}
+	p.owners[path] = code
+	return true, nil
+}
+
+// Resolution 返回记录的视频分辨率
+func (p *Paths) Resolution(code string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	resolution, ok := p.resolutions[code]
+	return resolution, ok
+}
+
+// SetResolution 记录视频的分辨率，已经记录过时保持不变，保证之后计算的路径不变
+func (p *Paths) SetResolution(code string, resolution string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.resolutions[code]; ok {
+		return nil
+	}
+	if err := p.append(pathOwner{Code: code, Resolution: resolution}); err != nil {
+		return err
+	}
+	p.resolutions[code] = resolution
+	return nil
+}
+
+// append 在 paths.jsonl 末尾追加一行，调用时需要持有 mu
+func (p *Paths) append(owner pathOwner) error {
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(p.dir, PathsFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开路径记录失败: %w", err)
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入路径记录失败: %w", err)
+	}
+	return nil
+}
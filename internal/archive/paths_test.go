@@ -0,0 +1,50 @@
+package archive
+
+import "testing"
+
+func TestPaths(t *testing.T) {
+	dir := t.TempDir()
+	p, err := OpenPaths(dir)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+
+	if ok, err := p.Claim("動画/テスト/テスト", "sm1"); !ok || err != nil {
+		t.Fatalf("分配失败: %v %v", ok, err)
+	}
+	if ok, _ := p.Claim("動画/テスト/テスト", "sm1"); !ok {
+		t.Error("已经属于同一个视频的路径应分配成功")
+	}
+
+	// 重新打开后仍然属于 sm1
+	p, _ = OpenPaths(dir)
+	if p.Available("動画/テスト/テスト", "sm2") {
+		t.Error("属于其它视频的路径不可用")
+	}
+	if ok, _ := p.Claim("動画/テスト/テスト", "sm2"); ok {
+		t.Error("属于其它视频的路径不应分配")
+	}
+}
+
+func TestPathsResolution(t *testing.T) {
+	dir := t.TempDir()
+	p, _ := OpenPaths(dir)
+	if _, ok := p.Resolution("sm1"); ok {
+		t.Error("还没有记录分辨率")
+	}
+	if err := p.SetResolution("sm1", "1920x1080"); err != nil {
+		t.Fatalf("记录分辨率失败: %v", err)
+	}
+	// 已经记录的分辨率不变，路径也就不变
+	if err := p.SetResolution("sm1", "1280x720"); err != nil {
+		t.Fatalf("记录分辨率失败: %v", err)
+	}
+
+	p, _ = OpenPaths(dir)
+	if resolution, ok := p.Resolution("sm1"); !ok || resolution != "1920x1080" {
+		t.Errorf("重新打开后分辨率错误: %s %v", resolution, ok)
+	}
+	if !p.Available("", "sm2") {
+		t.Error("记录分辨率的行不应分配路径")
+	}
+}
@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SyncStateFile 保存上次同步时频道列表的文件名
+const SyncStateFile = "sync.json"
+
+// Item 列表中的一个视频或文章，用于判断上次同步之后是否有变化
+type Item struct {
+	Code      string `json:"code"`
+	Title     string `json:"title"`
+	Date      string `json:"date"` // 列表的排序时间，视频为 DisplayDate，文章为 PublishAt
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Comments  int    `json:"comments,omitempty"` // 视频的评论数
+	Status    string `json:"status,omitempty"`   // 视频的状态，如生放送是否结束
+}
+
+// 可能变化的字段，用于 ItemChange.Fields
+const (
+	FieldTitle     = "title"
+	FieldDate      = "date"
+	FieldThumbnail = "thumbnail"
+	FieldComments  = "comments"
+	FieldStatus    = "status"
+)
+
+// ItemChange 上次同步之后有变化的项目
+type ItemChange struct {
+	Before, After Item
+	Fields        []string // 变化的字段
+}
+
+// Changed 判断 field 是否有变化
+func (c ItemChange) Changed(field string) bool {
+	for _, f := range c.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Changes 一次同步中列表的变化
+type Changes struct {
+	New     []Item
+	Updated []ItemChange
+	Removed []Item
+}
+
+// Empty 判断是否没有任何变化
+func (c Changes) Empty() bool {
+	return len(c.New) == 0 && len(c.Updated) == 0 && len(c.Removed) == 0
+}
+
+// SyncState 上次同步时频道的视频和文章列表，保存在频道目录的 sync.json
+type SyncState struct {
+	SyncedAt time.Time       `json:"synced_at"`
+	Videos   map[string]Item `json:"videos"`
+	Articles map[string]Item `json:"articles"`
+}
+
+// LoadSyncState 读取 dir 中上次同步的结果，还没有同步过时返回空的结果
+func LoadSyncState(dir string) (*SyncState, error) {
+	state := &SyncState{}
+	data, err := os.ReadFile(filepath.Join(dir, SyncStateFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("读取同步状态失败: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("解析同步状态失败: %w", err)
+		}
+	}
+
+	if state.Videos == nil {
+		state.Videos = make(map[string]Item)
+	}
+	if state.Articles == nil {
+		state.Articles = make(map[string]Item)
+	}
+	return state, nil
+}
+
+// Save 将同步结果保存到 dir，先写入临时文件再重命名，中断时不会损坏上次的结果
+func (s *SyncState) Save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	path := filepath.Join(dir, SyncStateFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("保存同步状态失败: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// KnownPage 判断获取到的一页是否可以作为增量同步的终点：页中的每一项上次同步时都已经获取过且没有变化，
+// 并且都早于 recheckSince，recheckSince 之后的项目即使已经获取过也要重新检查评论数等变化
+func KnownPage(known map[string]Item, page []Item, recheckSince string) bool {
+	if len(page) == 0 {
+		return false
+	}
+	for _, item := range page {
+		if previous, ok := known[item.Code]; !ok || previous != item || item.Date >= recheckSince {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge 将获取到的列表合并到 known 并返回变化
+// complete 为 false 时只获取了最新的一部分，此时只有晚于获取到的最旧一项的已知项目才能判断是否已被删除
+func Merge(known map[string]Item, fetched []Item, complete bool) Changes {
+	var changes Changes
+	fetchedCodes := make(map[string]bool, len(fetched))
+	oldest := ""
+	for i, item := range fetched {
+		fetchedCodes[item.Code] = true
+		if i == 0 || item.Date < oldest {
+			oldest = item.Date
+		}
+
+		previous, ok := known[item.Code]
+		switch {
+		case !ok:
+			changes.New = append(changes.New, item)
+		case previous != item:
+			changes.Updated = append(changes.Updated, ItemChange{Before: previous, After: item, Fields: changedFields(previous, item)})
+		}
+		known[item.Code] = item
+	}
+
+	if !complete && len(fetched) == 0 {
+		return changes
+	}
+	for code, item := range known {
+		if fetchedCodes[code] || !complete && item.Date <= oldest {
+			continue
+		}
+		changes.Removed = append(changes.Removed, item)
+		delete(known, code)
+	}
+	sort.Slice(changes.Removed, func(i, j int) bool {
+		return changes.Removed[i].Date > changes.Removed[j].Date
+	})
+	return changes
+}
+
+// changedFields 返回 before 和 after 不同的字段
+func changedFields(before Item, after Item) []string {
+	var fields []string
+	if before.Title != after.Title {
+		fields = append(fields, FieldTitle)
+	}
+	if before.Date != after.Date {
+		fields = append(fields, FieldDate)
+	}
+	if before.Thumbnail != after.Thumbnail {
+		fields = append(fields, FieldThumbnail)
+	}
+	if before.Comments != after.Comments {
+		fields = append(fields, FieldComments)
+	}
+	if before.Status != after.Status {
+		fields = append(fields, FieldStatus)
+	}
+	return fields
+}
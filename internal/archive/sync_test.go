@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"testing"
+)
+
+// go test -v ./internal/archive -run TestMerge
+func TestMerge(t *testing.T) {
+	known := map[string]Item{
+		"sm1": {Code: "sm1", Title: "一", Date: "2024-03-01 20:00:00", Comments: 10},
+		"sm2": {Code: "sm2", Title: "二", Date: "2024-03-02 20:00:00", Comments: 5},
+		"sm3": {Code: "sm3", Title: "三", Date: "2024-03-03 20:00:00"},
+		"sm4": {Code: "sm4", Title: "四", Date: "2024-03-04 20:00:00"},
+	}
+
+	// 只获取了最新的一部分：sm5 是新的，sm4 的评论数变化，sm3 已被删除，sm1 没有获取到
+	fetched := []Item{
+		{Code: "sm5", Title: "五", Date: "2024-03-05 20:00:00"},
+		{Code: "sm4", Title: "四", Date: "2024-03-04 20:00:00", Comments: 3},
+		{Code: "sm2", Title: "二", Date: "2024-03-02 20:00:00", Comments: 5},
+	}
+	changes := Merge(known, fetched, false)
+	if len(changes.New) != 1 || changes.New[0].Code != "sm5" {
+		t.Errorf("新增错误: %+v", changes.New)
+	}
+	if len(changes.Updated) != 1 || changes.Updated[0].After.Code != "sm4" ||
+		!changes.Updated[0].Changed(FieldComments) || changes.Updated[0].Changed(FieldTitle) {
+		t.Errorf("更新错误: %+v", changes.Updated)
+	}
+	if len(changes.Removed) != 1 || changes.Removed[0].Code != "sm3" {
+		t.Errorf("删除错误: %+v", changes.Removed)
+	}
+	if _, ok := known["sm1"]; !ok || len(known) != 4 {
+		t.Errorf("合并后的列表错误: %+v", known)
+	}
+
+	// 获取了完整的列表时，没有获取到的都已被删除
+	changes = Merge(known, fetched, true)
+	if len(changes.New) != 0 || len(changes.Updated) != 0 || len(changes.Removed) != 1 || changes.Removed[0].Code != "sm1" {
+		t.Errorf("完整同步的变化错误: %+v", changes)
+	}
+	if len(known) != 3 {
+		t.Errorf("合并后的列表错误: %+v", known)
+	}
+}
+
+func TestKnownPage(t *testing.T) {
+	known := map[string]Item{
+		"sm1": {Code: "sm1", Date: "2024-03-01 20:00:00"},
+		"sm2": {Code: "sm2", Date: "2024-03-02 20:00:00", Comments: 5},
+	}
+	page := []Item{known["sm2"], known["sm1"]}
+
+	if !KnownPage(known, page, "2024-03-10 00:00:00") {
+		t.Error("都已获取过且没有变化的页应停止获取")
+	}
+	if KnownPage(known, page, "2024-03-02 00:00:00") {
+		t.Error("需要重新检查的项目不应停止获取")
+	}
+	changed := []Item{{Code: "sm2", Date: "2024-03-02 20:00:00", Comments: 6}, known["sm1"]}
+	if KnownPage(known, changed, "2024-03-10 00:00:00") {
+		t.Error("有变化的页不应停止获取")
+	}
+	if KnownPage(known, append(page, Item{Code: "sm0", Date: "2024-02-28 20:00:00"}), "2024-03-10 00:00:00") {
+		t.Error("有新项目的页不应停止获取")
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	dir := t.TempDir()
+	state, err := LoadSyncState(dir)
+	if err != nil || len(state.Videos) != 0 {
+		t.Fatalf("还没有同步过时应返回空的结果: %+v %v", state, err)
+	}
+
+	state.Videos["sm1"] = Item{Code: "sm1", Title: "一"}
+	if err := state.Save(dir); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	state, err = LoadSyncState(dir)
+	if err != nil || state.Videos["sm1"].Title != "一" || state.Articles == nil {
+		t.Errorf("读取的结果错误: %+v %v", state, err)
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
@@ -21,34 +22,139 @@ type OAuthResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
-// tokenManager 管理 OAuth token 的获取和自动刷新
+// tokenManager 管理某个平台、某个账号的 OAuth token 的获取和自动刷新
 type tokenManager struct {
-	mu           sync.RWMutex
-	accessToken  string
-	refreshToken string
-	expiresAt    time.Time
-	client       *resty.Client
-	config       *config.Config
+	mu              sync.RWMutex
+	accessToken     string
+	refreshToken    string
+	expiresAt       time.Time
+	client          *resty.Client
+	platform        *client.Platform
+	account         string
+	clientID        string
+	envRefreshToken string // .env 中配置的 refresh token，没有保存的 token 时使用
+	tokenURL        string
+	store           TokenStore // 为 nil 时不保存 token
+}
+
+// managerKey 区分不同平台、不同账号的 tokenManager
+type managerKey struct {
+	domain  string
+	account string
 }
 
 var (
-	instance *tokenManager
-	once     sync.Once
+	managersMu     sync.Mutex
+	managers       = make(map[managerKey]*tokenManager)
+	currentAccount string
 )
 
-// Singleton
+// SetAccount 选择之后使用的账号，空字符串表示默认账号
+func SetAccount(account string) {
+	managersMu.Lock()
+	defer managersMu.Unlock()
+	currentAccount = account
+}
+
+// getTokenManager 返回当前平台、当前账号的 tokenManager
 func getTokenManager() *tokenManager {
-	once.Do(func() {
-		instance = &tokenManager{
-			client: client.Get(),
-			config: config.Load(),
-		}
+	managersMu.Lock()
+	account := currentAccount
+	managersMu.Unlock()
+
+	return tokenManagerFor(client.CurrentPlatform, account)
+}
+
+// tokenManagerFor 返回指定平台、指定账号的 tokenManager，同一个平台和账号共用一个
+// 每个平台和账号使用各自的 client_id、refresh token 和认证地址，切换平台时不会混用
+func tokenManagerFor(platform *client.Platform, account string) *tokenManager {
+	managersMu.Lock()
+	defer managersMu.Unlock()
+
+	key := managerKey{domain: platform.Domain, account: account}
+	if tm, ok := managers[key]; ok {
+		return tm
+	}
+
+	cfg := config.Load()
+	var store TokenStore
+	if path, err := CredentialsPath(cfg.CredentialsDir, platform.Domain, account); err != nil {
+		log.Printf("⚠️  %v，刷新后的 token 将不会被保存", err)
+	} else {
+		store = NewFileStore(path)
+	}
+
+	tm := newTokenManager(client.Get(), platform, account, cfg, store)
+	managers[key] = tm
+	return tm
+}
+
+// TokenSource 返回指定平台、指定账号的 token，用于 client.Client 的 Tokens
+// token 从保存的登录信息或环境变量中读取，刷新后自动保存
+func TokenSource(platform *client.Platform, account string) client.TokenSource {
+	return tokenManagerFor(platform, account)
+}
+
+// DefaultClient 返回使用当前平台、当前账号 token 的 Client，供各个包的包级函数使用
+func DefaultClient() *client.Client {
+	c := client.Default()
+	c.Tokens = getTokenManager()
+	return c
+}
+
+// newTokenManager 创建 tokenManager，并读取 store 中保存的 token
+func newTokenManager(c *resty.Client, platform *client.Platform, account string, cfg *config.Config, store TokenStore) *tokenManager {
+	tm := &tokenManager{
+		client:          c,
+		platform:        platform,
+		account:         account,
+		clientID:        cfg.ClientID(platform.Key, account),
+		envRefreshToken: cfg.RefreshToken(platform.Key, account),
+		tokenURL:        platform.AuthBaseURL() + "/oauth/token",
+		store:           store,
+	}
+	tm.loadCredentials()
+	return tm
+}
+
+// loadCredentials 读取上次保存的 token，优先于 .env 中的 NICO_REFRESH_TOKEN
+func (tm *tokenManager) loadCredentials() {
+	if tm.store == nil {
+		return
+	}
+
+	credentials, err := tm.store.Load()
+	if err != nil {
+		log.Printf("⚠️  读取保存的 token 失败: %v", err)
+		return
+	}
+	if credentials == nil || credentials.RefreshToken == "" {
+		return
+	}
+
+	tm.refreshToken = credentials.RefreshToken
+	tm.accessToken = credentials.AccessToken
+	tm.expiresAt = credentials.ExpiresAt
+}
+
+// saveCredentials 保存当前的 token，调用时需持有写锁
+func (tm *tokenManager) saveCredentials() {
+	if tm.store == nil {
+		return
+	}
+
+	err := tm.store.Save(&Credentials{
+		RefreshToken: tm.refreshToken,
+		AccessToken:  tm.accessToken,
+		ExpiresAt:    tm.expiresAt,
 	})
-	return instance
+	if err != nil {
+		log.Printf("⚠️  保存 token 失败: %v", err)
+	}
 }
 
 // 获取有效的 Access token，如果过期会自动刷新
-func (tm *tokenManager) getToken() (string, error) {
+func (tm *tokenManager) getToken(ctx context.Context) (string, error) {
 	// 检查 token 是否有效，使用读锁
 	tm.mu.RLock()
 	if tm.isTokenValid() {
@@ -59,7 +165,28 @@ func (tm *tokenManager) getToken() (string, error) {
 	tm.mu.RUnlock()
 
 	// 需要刷新 token，使用写锁
-	return tm.refreshOAuthToken()
+	return tm.refreshOAuthToken(ctx)
+}
+
+// Token 实现 client.TokenSource
+func (tm *tokenManager) Token(ctx context.Context) (string, error) {
+	return tm.getToken(ctx)
+}
+
+// Refresh 实现 client.TokenSource，stale 被服务器拒绝时强制刷新
+func (tm *tokenManager) Refresh(ctx context.Context, stale string) (string, error) {
+	tm.mu.Lock()
+	// 其它请求已经刷新过 token，直接使用新的
+	if tm.accessToken != stale && tm.isTokenValid() {
+		token := tm.accessToken
+		tm.mu.Unlock()
+		return token, nil
+	}
+	tm.accessToken = ""
+	tm.mu.Unlock()
+
+	log.Println("token 被服务器拒绝，强制刷新")
+	return tm.refreshOAuthToken(ctx)
 }
 
 // 检查 token 是否有效
@@ -69,7 +196,7 @@ func (tm *tokenManager) isTokenValid() bool {
 }
 
 // 刷新 token
-func (tm *tokenManager) refreshOAuthToken() (string, error) {
+func (tm *tokenManager) refreshOAuthToken(ctx context.Context) (string, error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -82,36 +209,53 @@ func (tm *tokenManager) refreshOAuthToken() (string, error) {
 
 	var oauthResp OAuthResponse
 
+	if tm.clientID == "" {
+		return "", fmt.Errorf("未找到 %s 的 client_id，请设置环境变量 %s 或 NICO_CLIENT_ID",
+			tm.platform.Name, config.AccountEnvName("NICO_CLIENT_ID", tm.platform.Key, tm.account))
+	}
+
 	// 获取 refresh token，优先使用存储的，否则使用配置中的
 	var refreshToken string
 	if tm.refreshToken != "" {
 		refreshToken = tm.refreshToken
 	} else {
-		refreshToken = tm.config.NicoRefreshToken
+		refreshToken = tm.envRefreshToken
+	}
+	if refreshToken == "" {
+		return "", fmt.Errorf("未找到 %s 的 refresh token，请运行 ncpd login 登录或设置环境变量 %s",
+			tm.platform.Name, config.AccountEnvName("NICO_REFRESH_TOKEN", tm.platform.Key, tm.account))
 	}
 
+	// 刷新可能由需要认证的请求触发，刷新请求本身不需要认证
 	_, err := tm.client.R().
+		SetContext(client.WithoutTokenSource(ctx)).
 		SetFormData(map[string]string{
-			"client_id":     tm.config.NicoClientID,
-			"redirect_uri":  fmt.Sprintf("https://%s/login/login-redirect", client.CurrentPlatform.Domain),
+			"client_id":     tm.clientID,
+			"redirect_uri":  fmt.Sprintf("https://%s/login/login-redirect", tm.platform.Domain),
 			"grant_type":    "refresh_token",
 			"refresh_token": refreshToken,
 		}).
 		SetResult(&oauthResp).
-		SetPathParam("platformDomain", client.CurrentPlatform.Domain).
-		Post("https://auth.{platformDomain}/oauth/token")
+		Post(tm.tokenURL)
 
 	if err != nil {
 		return "", err
 	}
+	if oauthResp.AccessToken == "" {
+		return "", fmt.Errorf("刷新 token 失败: 响应中没有 access_token")
+	}
 
-	// 保存新的 token 信息
+	// 保存新的 token 信息，refresh token 未轮换时继续使用旧的
 	tm.accessToken = oauthResp.AccessToken
-	tm.refreshToken = oauthResp.RefreshToken
+	if oauthResp.RefreshToken != "" {
+		tm.refreshToken = oauthResp.RefreshToken
+	} else {
+		tm.refreshToken = refreshToken
+	}
 	tm.expiresAt = time.Now().Add(time.Duration(oauthResp.ExpiresIn) * time.Second)
+	tm.saveCredentials()
 
 	log.Printf("刷新 token 成功，过期时间: %s", tm.expiresAt.Format("2006-01-02 15:04:05"))
-	log.Printf("新的 refresh_token: %s", tm.refreshToken)
 
 	return tm.accessToken, nil
 }
@@ -125,7 +269,7 @@ func (tm *tokenManager) getRefreshToken() string {
 	if tm.refreshToken != "" {
 		return tm.refreshToken
 	} else {
-		return tm.config.NicoRefreshToken
+		return tm.envRefreshToken
 	}
 }
 
@@ -136,10 +280,16 @@ func (tm *tokenManager) getTokenExpiry() time.Time {
 	return tm.expiresAt
 }
 
+// R 返回使用 ctx 的需要认证的请求，由当前平台和账号的 tokenManager 自动设置 bearer token，
+// 服务器返回 401 时刷新 token 并重发一次。返回的请求已设置 context，不要再调用 SetContext
+func R(ctx context.Context) *resty.Request {
+	return DefaultClient().AuthR(ctx)
+}
+
 // 提供全局函数供其他文件使用
 // 获取 token，如果过期会自动刷新
-func GetToken() (string, error) {
-	return getTokenManager().getToken()
+func GetToken(ctx context.Context) (string, error) {
+	return getTokenManager().getToken(ctx)
 }
 
 // 获取 token 过期时间
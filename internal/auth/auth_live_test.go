@@ -0,0 +1,54 @@
+//go:build live
+
+package auth
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	_, err := GetToken(context.Background())
+	if err != nil {
+		log.Fatalf("获取 token 失败: %v", err)
+	}
+	code := m.Run()
+	os.Exit(code)
+}
+
+// go test -tags live ./internal/auth -v
+func TestGetTokenLive(t *testing.T) {
+	token1 := getToken(t)
+	t.Logf("获取到的 token 长度: %d", len(token1))
+
+	token2 := getToken(t)
+	t.Logf("获取到的 token 长度: %d", len(token2))
+
+	if token1 != token2 {
+		t.Fatalf("两次获取的 token 不同")
+	} else {
+		t.Logf("两次获取的 token 相同")
+	}
+}
+
+func getToken(t *testing.T) string {
+	token, err := GetToken(context.Background())
+	if err != nil {
+		t.Fatalf("获取 token 失败: %v", err)
+	}
+	return token
+}
+
+func TestGetExpireTimeLive(t *testing.T) {
+	expireTime := GetExpireTime()
+	t.Logf("获取到的 expire_time: %s", expireTime.Format("2006-01-02 15:04:05"))
+}
+
+func TestGetRefreshTokenLive(t *testing.T) {
+	refreshToken := GetRefreshToken()
+	if refreshToken == "" {
+		t.Error("refresh_token 不应为空")
+	}
+}
@@ -1,49 +1,99 @@
 package auth
 
 import (
-	"log"
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"ncpd/internal/client"
+	"ncpd/internal/fakeapi"
 )
 
-func TestMain(m *testing.M) {
-	_, err := GetToken()
-	if err != nil {
-		log.Fatalf("获取 token 失败: %v", err)
-	}
-	code := m.Run()
-	os.Exit(code)
-}
+// useFakeServer 把当前平台切换到假服务器，token 保存到临时目录，测试结束后恢复
+func useFakeServer(t *testing.T) *fakeapi.Server {
+	t.Helper()
 
-// go test ./internal/auth -v
-func TestGetToken(t *testing.T) {
-	token1 := getToken(t)
-	t.Logf("获取到的 token: %s", token1[:50])
+	fake := fakeapi.New(t)
+	dir := t.TempDir()
+	t.Setenv("CREDENTIALS_DIR", dir)
+	t.Setenv("NICO_CLIENT_ID", fakeapi.ClientID)
+	t.Setenv("NICO_REFRESH_TOKEN", fake.RefreshToken())
 
-	token2 := getToken(t)
-	t.Logf("获取到的 token: %s", token2[:50])
+	previous := client.CurrentPlatform
+	managersMu.Lock()
+	previousManagers := managers
+	managers = make(map[managerKey]*tokenManager)
+	managersMu.Unlock()
+	t.Cleanup(func() {
+		client.SetCurrentPlatform(previous)
+		client.Get().SetBaseURL(previous.DefaultAPIBaseURL)
+		managersMu.Lock()
+		managers = previousManagers
+		managersMu.Unlock()
+	})
 
-	if token1 != token2 {
-		t.Fatalf("两次获取的 token 不同")
-	} else {
-		t.Logf("两次获取的 token 相同")
+	if err := client.InitClientWithPlatform(context.Background(), fake.Platform); err != nil {
+		t.Fatalf("初始化客户端失败: %v", err)
 	}
+	return fake
 }
 
-func getToken(t *testing.T) string {
-	token, err := GetToken()
+// go test -v ./internal/auth -run TestGetToken
+func TestGetToken(t *testing.T) {
+	fake := useFakeServer(t)
+
+	token1, err := GetToken(context.Background())
 	if err != nil {
 		t.Fatalf("获取 token 失败: %v", err)
 	}
-	return token
-}
+	token2, err := GetToken(context.Background())
+	if err != nil {
+		t.Fatalf("获取 token 失败: %v", err)
+	}
+	if token1 != token2 || token1 != fake.AccessToken() {
+		t.Errorf("两次获取的 token 应相同且有效: %s, %s", token1, token2)
+	}
+	if fake.TokenRequests() != 1 {
+		t.Errorf("token 未过期时不应重复刷新，实际刷新 %d 次", fake.TokenRequests())
+	}
 
-func TestGetExpireTime(t *testing.T) {
-	expireTime := GetExpireTime()
-	t.Logf("获取到的 expire_time: %s", expireTime.Format("2006-01-02 15:04:05"))
+	if GetRefreshToken() != fake.RefreshToken() {
+		t.Errorf("应使用轮换后的 refresh token，实际 %s", GetRefreshToken())
+	}
+	if !GetExpireTime().After(time.Now()) {
+		t.Errorf("token 过期时间错误: %v", GetExpireTime())
+	}
+
+	// 轮换后的 refresh token 已保存
+	credentials, err := NewFileStore(filepath.Join(os.Getenv("CREDENTIALS_DIR"), "nicochannel.jp.json")).Load()
+	if err != nil || credentials == nil {
+		t.Fatalf("读取保存的凭据失败: %v", err)
+	}
+	if credentials.RefreshToken != fake.RefreshToken() {
+		t.Errorf("保存的 refresh token 错误: %s", credentials.RefreshToken)
+	}
 }
 
-func TestGetRefreshToken(t *testing.T) {
-	refreshToken := GetRefreshToken()
-	t.Logf("获取到的 refresh_token: %s", refreshToken)
+// go test -v ./internal/auth -run TestGetSessionID
+func TestGetSessionID(t *testing.T) {
+	fake := useFakeServer(t)
+
+	sessionID, err := GetSessionID(context.Background(), fakeapi.VideoCode)
+	if err != nil {
+		t.Fatalf("获取 sessionID 失败: %v", err)
+	}
+	if sessionID != fakeapi.SessionID {
+		t.Errorf("期望 sessionID %s，实际 %s", fakeapi.SessionID, sessionID)
+	}
+
+	// token 被服务器吊销后，刷新 token 并重发请求
+	fake.RevokeAccessToken()
+	if _, err := GetSessionID(context.Background(), fakeapi.VideoCode); err != nil {
+		t.Fatalf("token 被吊销后获取 sessionID 失败: %v", err)
+	}
+	if fake.TokenRequests() != 2 {
+		t.Errorf("token 被吊销后应刷新一次，实际共刷新 %d 次", fake.TokenRequests())
+	}
 }
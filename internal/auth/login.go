@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"ncpd/internal/client"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// LoginScope 登录时申请的权限，offline_access 用于获取 refresh token
+const LoginScope = "openid profile email offline_access"
+
+// LoginFlow 使用 OAuth 授权码 + PKCE 获取首个 refresh token
+type LoginFlow struct {
+	Client       *resty.Client
+	ClientID     string
+	AuthorizeURL string
+	TokenURL     string
+	RedirectURI  string
+	Scope        string
+
+	state    string
+	verifier string
+}
+
+// NewLoginFlow 创建登录流程，redirectURI 为空时使用平台网页的登录回调地址
+func NewLoginFlow(platform *client.Platform, clientID string, redirectURI string) (*LoginFlow, error) {
+	if redirectURI == "" {
+		redirectURI = fmt.Sprintf("https://%s/login/login-redirect", platform.Domain)
+	}
+
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+	// code_verifier 需要 43~128 个字符
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginFlow{
+		Client:       client.Get(),
+		ClientID:     clientID,
+		AuthorizeURL: platform.AuthBaseURL() + "/oauth/authorize",
+		TokenURL:     platform.AuthBaseURL() + "/oauth/token",
+		RedirectURI:  redirectURI,
+		Scope:        LoginScope,
+		state:        state,
+		verifier:     verifier,
+	}, nil
+}
+
+// randomString 返回 n 个随机字节的 base64url 编码
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge 根据 code_verifier 计算 S256 code_challenge
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 返回需要在浏览器中打开的登录地址
+func (f *LoginFlow) AuthCodeURL() string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {f.ClientID},
+		"redirect_uri":          {f.RedirectURI},
+		"scope":                 {f.Scope},
+		"state":                 {f.state},
+		"code_challenge":        {codeChallenge(f.verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return f.AuthorizeURL + "?" + query.Encode()
+}
+
+// CodeFromRedirect 从登录后跳转的地址中取出授权码，并校验 state
+func (f *LoginFlow) CodeFromRedirect(redirectURL string) (string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", fmt.Errorf("无效的跳转地址: %w", err)
+	}
+	return f.codeFromQuery(u.Query())
+}
+
+// codeFromQuery 从回调参数中取出授权码
+func (f *LoginFlow) codeFromQuery(query url.Values) (string, error) {
+	if errCode := query.Get("error"); errCode != "" {
+		return "", fmt.Errorf("登录失败: %s %s", errCode, query.Get("error_description"))
+	}
+	if query.Get("state") != f.state {
+		return "", fmt.Errorf("state 不匹配，请使用本次生成的登录地址重新登录")
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("跳转地址中没有授权码 code")
+	}
+	return code, nil
+}
+
+// Exchange 使用授权码换取 token
+func (f *LoginFlow) Exchange(ctx context.Context, code string) (*Credentials, error) {
+	var oauthResp OAuthResponse
+	_, err := f.Client.R().
+		SetContext(ctx).
+		SetFormData(map[string]string{
+			"client_id":     f.ClientID,
+			"redirect_uri":  f.RedirectURI,
+			"grant_type":    "authorization_code",
+			"code":          code,
+			"code_verifier": f.verifier,
+		}).
+		SetResult(&oauthResp).
+		Post(f.TokenURL)
+
+	if err != nil {
+		return nil, fmt.Errorf("换取 token 失败: %w", err)
+	}
+	if oauthResp.RefreshToken == "" {
+		return nil, fmt.Errorf("换取 token 失败: 响应中没有 refresh_token")
+	}
+
+	return &Credentials{
+		RefreshToken: oauthResp.RefreshToken,
+		AccessToken:  oauthResp.AccessToken,
+		ExpiresAt:    time.Now().Add(time.Duration(oauthResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// ListenLoopback 在本机监听登录回调，返回监听器和对应的 redirect_uri，port 为 0 时随机选择端口
+func ListenLoopback(port int) (net.Listener, string, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, "", fmt.Errorf("监听本地端口失败: %w", err)
+	}
+	return listener, fmt.Sprintf("http://%s/callback", listener.Addr()), nil
+}
+
+// WaitForCallback 等待浏览器跳转到本地回调地址，返回授权码，state 不匹配的请求会被忽略，ctx 取消时停止等待
+func (f *LoginFlow) WaitForCallback(ctx context.Context, listener net.Listener, timeout time.Duration) (string, error) {
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// 浏览器预加载或旧的登录页面发来的请求不属于本次登录，忽略后继续等待
+		if query.Get("state") != f.state {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<p>state 不匹配，请使用本次生成的登录地址重新登录。</p>")
+			return
+		}
+
+		code, err := f.codeFromQuery(query)
+		if err != nil {
+			// 错误信息中有来自地址的 error_description，需要转义
+			fmt.Fprintf(w, "<p>登录失败: %s</p>", html.EscapeString(err.Error()))
+		} else {
+			fmt.Fprint(w, "<p>登录成功，可以关闭此页面并返回终端。</p>")
+		}
+
+		select {
+		case results <- result{code, err}:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	// 等待页面发送给浏览器之后再关闭
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	select {
+	case r := <-results:
+		return r.code, r.err
+	case <-time.After(timeout):
+		return "", errors.New("等待登录超时")
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// SaveLogin 保存登录得到的 token，后续运行会优先使用该 token
+func SaveLogin(credentialsDir string, platform *client.Platform, account string, credentials *Credentials) (string, error) {
+	path, err := CredentialsPath(credentialsDir, platform.Domain, account)
+	if err != nil {
+		return "", err
+	}
+
+	if err := NewFileStore(path).Save(credentials); err != nil {
+		return "", fmt.Errorf("保存 token 失败: %w", err)
+	}
+
+	// 丢弃已创建的 tokenManager，之后获取 token 时重新读取
+	managersMu.Lock()
+	delete(managers, managerKey{domain: platform.Domain, account: account})
+	managersMu.Unlock()
+
+	return path, nil
+}
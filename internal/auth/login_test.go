@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ncpd/internal/client"
+)
+
+// newFakeAuthServer 模拟授权服务器：/oauth/authorize 直接跳转回 redirect_uri，/oauth/token 校验 PKCE
+func newFakeAuthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var challenge string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "client" {
+			t.Errorf("登录参数错误: %s", r.URL.RawQuery)
+		}
+		challenge = query.Get("code_challenge")
+
+		redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {"auth-code"}, "state": {query.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != "auth-code" ||
+			codeChallenge(r.PostForm.Get("code_verifier")) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OAuthResponse{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 300})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestLoginFlow(t *testing.T, server *httptest.Server, redirectURI string) *LoginFlow {
+	t.Helper()
+
+	flow, err := NewLoginFlow(&client.SupportedPlatforms[0], "client", redirectURI)
+	if err != nil {
+		t.Fatalf("创建登录流程失败: %v", err)
+	}
+	flow.AuthorizeURL = server.URL + "/oauth/authorize"
+	flow.TokenURL = server.URL + "/oauth/token"
+	return flow
+}
+
+// go test -v ./internal/auth -run TestLoginLoopback
+func TestLoginLoopback(t *testing.T) {
+	server := newFakeAuthServer(t)
+
+	listener, redirectURI, err := ListenLoopback(0)
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	flow := newTestLoginFlow(t, server, redirectURI)
+
+	// 模拟浏览器打开登录地址并跟随跳转
+	go func() {
+		resp, err := http.Get(flow.AuthCodeURL())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	code, err := flow.WaitForCallback(context.Background(), listener, 5*time.Second)
+	if err != nil {
+		t.Fatalf("等待回调失败: %v", err)
+	}
+
+	credentials, err := flow.Exchange(context.Background(), code)
+	if err != nil {
+		t.Fatalf("换取 token 失败: %v", err)
+	}
+	if credentials.RefreshToken != "refresh" || credentials.AccessToken != "access" {
+		t.Errorf("token 错误: %+v", credentials)
+	}
+
+	path, err := SaveLogin(t.TempDir(), &client.SupportedPlatforms[0], "", credentials)
+	if err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	if filepath.Base(path) != "nicochannel.jp.json" {
+		t.Errorf("凭据文件路径错误: %s", path)
+	}
+	if saved, _ := NewFileStore(path).Load(); saved == nil || saved.RefreshToken != "refresh" {
+		t.Errorf("保存的 token 错误: %+v", saved)
+	}
+}
+
+// 回调页面中的错误信息来自地址，需要转义
+func TestLoginCallbackEscapesError(t *testing.T) {
+	server := newFakeAuthServer(t)
+
+	listener, redirectURI, err := ListenLoopback(0)
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	flow := newTestLoginFlow(t, server, redirectURI)
+
+	bodies := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(redirectURI + "?" + url.Values{"error": {"x"}, "error_description": {"<b>"}, "state": {flow.state}}.Encode())
+		if err != nil {
+			bodies <- ""
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		bodies <- string(body)
+	}()
+
+	if _, err := flow.WaitForCallback(context.Background(), listener, 5*time.Second); err == nil {
+		t.Error("期望登录被拒绝时返回错误")
+	}
+	body := <-bodies
+	if strings.Contains(body, "<b>") || !strings.Contains(body, "&lt;b&gt;") {
+		t.Errorf("错误信息没有转义: %s", body)
+	}
+}
+
+// state 不匹配的回调请求不会结束登录，之后的正确回调仍然有效
+func TestLoginCallbackIgnoresBadState(t *testing.T) {
+	server := newFakeAuthServer(t)
+
+	listener, redirectURI, err := ListenLoopback(0)
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	flow := newTestLoginFlow(t, server, redirectURI)
+
+	go func() {
+		for _, query := range []url.Values{
+			{"code": {"stale"}, "state": {"other"}},
+			{"code": {"prefetch"}},
+			{"error": {"access_denied"}, "state": {"other"}},
+		} {
+			resp, err := http.Get(redirectURI + "?" + query.Encode())
+			if err != nil {
+				t.Errorf("请求回调地址失败: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("state 不匹配时状态码错误: %d", resp.StatusCode)
+			}
+		}
+
+		resp, err := http.Get(redirectURI + "?" + url.Values{"code": {"auth-code"}, "state": {flow.state}}.Encode())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	code, err := flow.WaitForCallback(context.Background(), listener, 5*time.Second)
+	if err != nil {
+		t.Fatalf("等待回调失败: %v", err)
+	}
+	if code != "auth-code" {
+		t.Errorf("授权码错误: %s", code)
+	}
+}
+
+func TestLoginPastedRedirect(t *testing.T) {
+	server := newFakeAuthServer(t)
+	flow := newTestLoginFlow(t, server, "")
+	if flow.RedirectURI != "https://nicochannel.jp/login/login-redirect" {
+		t.Errorf("默认 redirect_uri 错误: %s", flow.RedirectURI)
+	}
+
+	// 不跟随跳转，取出浏览器地址栏中会显示的地址
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(flow.AuthCodeURL())
+	if err != nil {
+		t.Fatalf("请求登录地址失败: %v", err)
+	}
+	resp.Body.Close()
+
+	code, err := flow.CodeFromRedirect(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("解析跳转地址失败: %v", err)
+	}
+	if _, err := flow.Exchange(context.Background(), code); err != nil {
+		t.Fatalf("换取 token 失败: %v", err)
+	}
+
+	// state 不匹配或登录被拒绝时返回错误
+	if _, err := flow.CodeFromRedirect("https://nicochannel.jp/login/login-redirect?code=x&state=other"); err == nil {
+		t.Error("期望 state 不匹配时返回错误")
+	}
+	if _, err := flow.CodeFromRedirect("https://nicochannel.jp/login/login-redirect?error=access_denied"); err == nil {
+		t.Error("期望登录被拒绝时返回错误")
+	}
+}
@@ -1,17 +1,15 @@
+//go:build live
+
 package auth
 
 import (
+	"context"
 	"testing"
 )
 
-func TestGetSessionID(t *testing.T) {
-	token, err := GetToken()
-	if err != nil {
-		t.Fatalf("获取 token 失败: %v", err)
-	}
-
+func TestGetSessionIDLive(t *testing.T) {
 	videoID := "smQKzZSkFT4Fap6ERziVr26f"
-	sessionID, err := GetSessionID(videoID, token)
+	sessionID, err := GetSessionID(context.Background(), videoID)
 	if err != nil {
 		t.Fatalf("获取 sessionID 失败: %v", err)
 	}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// invalidAccountChars 账号名中不能用于文件名的字符
+var invalidAccountChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// Credentials 持久化保存的 token 信息
+type Credentials struct {
+	RefreshToken string    `json:"refresh_token"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TokenStore 保存最新的 token，refresh token 每次刷新都会轮换，需要及时保存
+type TokenStore interface {
+	// Load 读取保存的 token，不存在时返回 nil
+	Load() (*Credentials, error)
+	// Save 保存 token
+	Save(credentials *Credentials) error
+}
+
+// FileStore 将 token 保存为 JSON 文件，文件权限为 0600
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore 创建保存到 path 的 FileStore
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// DefaultCredentialsDir 返回默认的凭据目录，如 Linux 下的 ~/.config/ncpd/credentials
+func DefaultCredentialsDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "ncpd", "credentials"), nil
+}
+
+// CredentialsPath 返回平台和账号对应的凭据文件路径，dir 为空时使用默认目录
+// 默认账号为 <域名>.json，其它账号为 <域名>.<账号>.json
+func CredentialsPath(dir string, platformDomain string, account string) (string, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultCredentialsDir(); err != nil {
+			return "", fmt.Errorf("获取凭据目录失败: %w", err)
+		}
+	}
+
+	name := platformDomain
+	if account != "" {
+		name += "." + invalidAccountChars.ReplaceAllString(account, "_")
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Load 读取凭据文件，文件不存在时返回 nil
+func (s *FileStore) Load() (*Credentials, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials Credentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("凭据文件 %s 已损坏: %w", s.Path, err)
+	}
+
+	return &credentials, nil
+}
+
+// Save 原子地写入凭据文件：先写入同目录下的临时文件，再重命名覆盖
+func (s *FileStore) Save(credentials *Credentials) error {
+	credentials.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	// CreateTemp 创建的文件权限为 0600
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
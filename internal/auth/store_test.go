@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ncpd/config"
+	"ncpd/internal/client"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials", "nicochannel.jp.json")
+	store := NewFileStore(path)
+
+	// 文件不存在时返回 nil
+	credentials, err := store.Load()
+	if err != nil || credentials != nil {
+		t.Fatalf("期望返回 nil，实际 %v, %v", credentials, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := store.Save(&Credentials{RefreshToken: "refresh", AccessToken: "access", ExpiresAt: expiresAt}); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("凭据文件不存在: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("凭据文件权限应为 0600，实际 %o", info.Mode().Perm())
+	}
+
+	// 不应残留临时文件
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("目录中应只有凭据文件，实际 %d 个文件", len(entries))
+	}
+
+	credentials, err = store.Load()
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if credentials.RefreshToken != "refresh" || credentials.AccessToken != "access" || !credentials.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("读取结果错误: %+v", credentials)
+	}
+}
+
+// go test -v ./internal/auth -run TestTokenManagerPersistsRotatedToken
+func TestTokenManagerPersistsRotatedToken(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received = append(received, r.PostForm.Get("refresh_token"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OAuthResponse{
+			AccessToken:  "access-" + r.PostForm.Get("refresh_token"),
+			RefreshToken: "rotated",
+			ExpiresIn:    300,
+		})
+	}))
+	defer server.Close()
+
+	store := NewFileStore(filepath.Join(t.TempDir(), "nicochannel.jp.json"))
+	cfg := &config.Config{NicoClientID: "client", NicoRefreshToken: "from-env"}
+	newManager := func() *tokenManager {
+		tm := newTokenManager(resty.New(), &client.SupportedPlatforms[0], "", cfg, store)
+		tm.tokenURL = server.URL
+		return tm
+	}
+
+	// 首次使用 .env 中的 refresh token，并保存轮换后的 token
+	token, err := newManager().getToken(context.Background())
+	if err != nil {
+		t.Fatalf("获取 token 失败: %v", err)
+	}
+	if token != "access-from-env" {
+		t.Errorf("access token 错误: %s", token)
+	}
+
+	credentials, err := store.Load()
+	if err != nil || credentials == nil {
+		t.Fatalf("token 未保存: %v", err)
+	}
+	if credentials.RefreshToken != "rotated" || credentials.AccessToken != "access-from-env" {
+		t.Errorf("保存的 token 错误: %+v", credentials)
+	}
+
+	// 重新启动后直接使用保存的 access token，不需要刷新
+	if token, _ := newManager().getToken(context.Background()); token != "access-from-env" || len(received) != 1 {
+		t.Errorf("应使用保存的 access token，实际 %s，刷新 %d 次", token, len(received))
+	}
+
+	// access token 过期后使用保存的 refresh token 而不是 .env 中的
+	credentials.ExpiresAt = time.Now()
+	store.Save(credentials)
+	if _, err := newManager().getToken(context.Background()); err != nil {
+		t.Fatalf("刷新 token 失败: %v", err)
+	}
+	if received[len(received)-1] != "rotated" {
+		t.Errorf("应使用保存的 refresh token，实际 %s", received[len(received)-1])
+	}
+}
+
+func TestTokenManagerPerPlatform(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CREDENTIALS_DIR", dir)
+	t.Setenv("NICO_CLIENT_ID", "default-client")
+	t.Setenv("NICO_REFRESH_TOKEN", "default-refresh")
+	t.Setenv("NICO_CLIENT_ID_QLOVER", "qlover-client")
+	t.Setenv("NICO_REFRESH_TOKEN_QLOVER", "qlover-refresh")
+	t.Setenv("NICO_REFRESH_TOKEN_QLOVER_SUB", "qlover-sub-refresh")
+
+	defer client.SetCurrentPlatform(client.CurrentPlatform)
+	defer SetAccount("")
+
+	tests := []struct {
+		platform     *client.Platform
+		account      string
+		clientID     string
+		refreshToken string
+		file         string
+	}{
+		{&client.SupportedPlatforms[0], "", "default-client", "default-refresh", "nicochannel.jp.json"},
+		{&client.SupportedPlatforms[1], "", "qlover-client", "qlover-refresh", "qlover.jp.json"},
+		{&client.SupportedPlatforms[1], "sub", "qlover-client", "qlover-sub-refresh", "qlover.jp.sub.json"},
+	}
+
+	seen := make(map[*tokenManager]bool)
+	for _, tt := range tests {
+		client.SetCurrentPlatform(tt.platform)
+		SetAccount(tt.account)
+
+		tm := getTokenManager()
+		if tm != getTokenManager() {
+			t.Errorf("%s/%s: 同一平台和账号应复用 tokenManager", tt.platform.Key, tt.account)
+		}
+		if seen[tm] {
+			t.Errorf("%s/%s: 不同平台或账号不应共用 tokenManager", tt.platform.Key, tt.account)
+		}
+		seen[tm] = true
+
+		if tm.clientID != tt.clientID || tm.envRefreshToken != tt.refreshToken {
+			t.Errorf("%s/%s: 凭据错误 client_id=%s", tt.platform.Key, tt.account, tm.clientID)
+		}
+		if tm.tokenURL != "https://auth."+tt.platform.Domain+"/oauth/token" {
+			t.Errorf("%s/%s: 认证地址错误 %s", tt.platform.Key, tt.account, tm.tokenURL)
+		}
+		if path := tm.store.(*FileStore).Path; path != filepath.Join(dir, tt.file) {
+			t.Errorf("%s/%s: 凭据文件错误 %s", tt.platform.Key, tt.account, path)
+		}
+	}
+}
+
+func TestTokenManagerRefresh(t *testing.T) {
+	var refreshes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OAuthResponse{AccessToken: fmt.Sprintf("access-%d", refreshes), RefreshToken: "refresh", ExpiresIn: 300})
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{NicoClientID: "client", NicoRefreshToken: "refresh"}
+	tm := newTokenManager(resty.New(), &client.SupportedPlatforms[0], "", cfg, nil)
+	tm.tokenURL = server.URL
+
+	token, _ := tm.Token(context.Background())
+	if token != "access-1" {
+		t.Fatalf("token 错误: %s", token)
+	}
+
+	// 被拒绝的是旧 token 时，直接使用已刷新的 token
+	if token, _ := tm.Refresh(context.Background(), "stale"); token != "access-1" || refreshes != 1 {
+		t.Errorf("不应重复刷新，token %s，刷新 %d 次", token, refreshes)
+	}
+
+	// 当前 token 被拒绝时，即使未过期也强制刷新
+	if token, _ := tm.Refresh(context.Background(), "access-1"); token != "access-2" || refreshes != 2 {
+		t.Errorf("应强制刷新，token %s，刷新 %d 次", token, refreshes)
+	}
+}
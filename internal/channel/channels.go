@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -31,12 +32,45 @@ type FanclubSite struct {
 	ID int `json:"id"`
 }
 
+// Client 使用指定平台的 API 客户端获取频道信息
+type Client struct {
+	*client.Client
+}
+
+// NewClient 创建使用 c 的频道客户端
+func NewClient(c *client.Client) *Client {
+	return &Client{Client: c}
+}
+
 // 获取频道列表
-func GetChannels() (*ChannelsResponse, error) {
-	client := client.Get()
+func GetChannels(ctx context.Context) (*ChannelsResponse, error) {
+	return NewClient(client.Default()).GetChannels(ctx)
+}
+
+// 获取频道列表（简化版本，只返回 ContentProvider 数组）
+func GetChannelList(ctx context.Context) ([]ContentProvider, error) {
+	return NewClient(client.Default()).GetChannelList(ctx)
+}
+
+// 根据 FC Site ID 查找特定频道
+func GetChannelByID(ctx context.Context, id int) (*ContentProvider, error) {
+	return NewClient(client.Default()).GetChannelByID(ctx, id)
+}
 
+// 根据域名查找特定频道的 ID
+func GetChannelByDomain(ctx context.Context, domain string) (*ContentProvider, error) {
+	return NewClient(client.Default()).GetChannelByDomain(ctx, domain)
+}
+
+// GetFanclubSiteInfo 根据 fc site id 获取 fanclub 信息
+func GetFanclubSiteInfo(ctx context.Context, siteID int) (*FanclubSiteInfo, error) {
+	return NewClient(client.Default()).GetFanclubSiteInfo(ctx, siteID)
+}
+
+// GetChannels 获取频道列表
+func (c *Client) GetChannels(ctx context.Context) (*ChannelsResponse, error) {
 	var channelsResponse ChannelsResponse
-	_, err := client.R().
+	_, err := c.R(ctx).
 		SetResult(&channelsResponse).
 		Get("/content_providers/channels")
 
@@ -47,9 +81,9 @@ func GetChannels() (*ChannelsResponse, error) {
 	return &channelsResponse, nil
 }
 
-// 获取频道列表（简化版本，只返回 ContentProvider 数组）
-func GetChannelList() ([]ContentProvider, error) {
-	response, err := GetChannels()
+// GetChannelList 获取频道列表（简化版本，只返回 ContentProvider 数组）
+func (c *Client) GetChannelList(ctx context.Context) ([]ContentProvider, error) {
+	response, err := c.GetChannels(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +91,9 @@ func GetChannelList() ([]ContentProvider, error) {
 	return response.Data.ContentProviders, nil
 }
 
-// 根据 FC Site ID 查找特定频道
-func GetChannelByID(id int) (*ContentProvider, error) {
-	channels, err := GetChannelList()
+// GetChannelByID 根据 FC Site ID 查找特定频道
+func (c *Client) GetChannelByID(ctx context.Context, id int) (*ContentProvider, error) {
+	channels, err := c.GetChannelList(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -73,12 +107,10 @@ func GetChannelByID(id int) (*ContentProvider, error) {
 	return nil, fmt.Errorf("channel.GetChannelByID: 未找到 ID 为 %d 的频道", id)
 }
 
-// 根据域名查找特定频道的 ID
-func GetChannelByDomain(domain string) (*ContentProvider, error) {
-	client := client.Get()
-
+// GetChannelByDomain 根据域名查找特定频道的 ID
+func (c *Client) GetChannelByDomain(ctx context.Context, domain string) (*ContentProvider, error) {
 	var channelDomainResponse ChannelDomainResponse
-	_, err := client.R().
+	_, err := c.R(ctx).
 		SetPathParam("domain", domain).
 		SetResult(&channelDomainResponse).
 		Get("/content_providers/channel_domain?current_site_domain={domain}")
@@ -110,11 +142,9 @@ type FanclubSiteInfo struct {
 }
 
 // GetFanclubSiteInfo 根据 fc site id 获取 fanclub 信息
-func GetFanclubSiteInfo(siteID int) (*FanclubSiteInfo, error) {
-	client := client.Get()
-
+func (c *Client) GetFanclubSiteInfo(ctx context.Context, siteID int) (*FanclubSiteInfo, error) {
 	var fanclubSiteInfoResponse FanclubSiteInfoResponse
-	_, err := client.R().
+	_, err := c.R(ctx).
 		SetPathParam("siteId", strconv.Itoa(siteID)).
 		SetResult(&fanclubSiteInfoResponse).
 		Get("/fanclub_sites/{siteId}/page_base_info")
@@ -0,0 +1,58 @@
+//go:build live
+
+package channel
+
+import (
+	"context"
+	"testing"
+)
+
+// go test -tags live -v ./internal/channel
+func TestGetChannelListLive(t *testing.T) {
+	channels, err := GetChannelList(context.Background())
+	if err != nil {
+		t.Fatalf("获取频道列表失败: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		channel := channels[i]
+		t.Logf("频道 %d: %v", channel.ID, channel.Domain)
+	}
+}
+
+func TestGetChannelByIDLive(t *testing.T) {
+	siteID := 387
+	channel, err := GetChannelByID(context.Background(), siteID)
+	if err != nil {
+		t.Fatalf("获取频道失败: %v", err)
+	}
+	t.Logf("获取到的频道: %v", channel)
+}
+
+func TestGetChannelByDomainLive(t *testing.T) {
+	channel, err := GetChannelByDomain(context.Background(), "https://nicochannel.jp/sakakura-sakura")
+	if err != nil {
+		t.Fatalf("获取频道失败: %v", err)
+	}
+	t.Logf("获取到的频道: %v", channel)
+}
+
+func TestGetFanclubSiteInfoLive(t *testing.T) {
+	siteID := 387
+	fanclubInfo, err := GetFanclubSiteInfo(context.Background(), siteID)
+	if err != nil {
+		t.Fatalf("获取 fanclub site 信息失败: %v", err)
+	}
+
+	t.Logf("=== 获取到的结果 ===")
+	t.Logf("Fanclub Site ID: %d", siteID)
+	t.Logf("名称: %s", fanclubInfo.FanclubSiteName)
+	t.Logf("描述: %s", fanclubInfo.Description)
+	t.Logf("Favicon URL: %s", fanclubInfo.FaviconURL)
+	t.Logf("缩略图 URL: %s", fanclubInfo.ThumbnailImageURL)
+
+	t.Logf("=== 输出目录结构 ===")
+	t.Logf("视频目录: ./out/%s/動画/", fanclubInfo.FanclubSiteName)
+	t.Logf("生放送目录: ./out/%s/生放送/", fanclubInfo.FanclubSiteName)
+	t.Logf("新闻目录: ./out/%s/NEWS/", fanclubInfo.FanclubSiteName)
+}
@@ -1,55 +1,82 @@
 package channel
 
 import (
+	"context"
 	"testing"
+
+	"ncpd/internal/fakeapi"
 )
 
 // go test -v ./internal/channel
 func TestGetChannelList(t *testing.T) {
-	channels, err := GetChannelList()
+	c := NewClient(fakeapi.New(t).Client())
+
+	channels, err := c.GetChannelList(context.Background())
 	if err != nil {
 		t.Fatalf("获取频道列表失败: %v", err)
 	}
-
-	for i := 0; i < 10; i++ {
-		channel := channels[i]
-		t.Logf("频道 %d: %v", channel.ID, channel.Domain)
+	if len(channels) != 3 || channels[0].Domain != fakeapi.ChannelURL {
+		t.Errorf("频道列表错误: %+v", channels)
 	}
 }
 
 func TestGetChannelByID(t *testing.T) {
-	siteID := 387
-	channel, err := GetChannelByID(siteID)
+	c := NewClient(fakeapi.New(t).Client())
+
+	channel, err := c.GetChannelByID(context.Background(), fakeapi.SiteID)
 	if err != nil {
 		t.Fatalf("获取频道失败: %v", err)
 	}
-	t.Logf("获取到的频道: %v", channel)
+	if channel.Domain != fakeapi.ChannelURL {
+		t.Errorf("期望频道 %s，实际 %s", fakeapi.ChannelURL, channel.Domain)
+	}
+
+	if _, err := c.GetChannelByID(context.Background(), 999); err == nil {
+		t.Error("不存在的频道应返回错误")
+	}
 }
 
 func TestGetChannelByDomain(t *testing.T) {
-	channel, err := GetChannelByDomain("https://nicochannel.jp/sakakura-sakura")
+	c := NewClient(fakeapi.New(t).Client())
+
+	channel, err := c.GetChannelByDomain(context.Background(), fakeapi.ChannelURL)
 	if err != nil {
 		t.Fatalf("获取频道失败: %v", err)
 	}
-	t.Logf("获取到的频道: %v", channel)
+	if channel.FanclubSite.ID != fakeapi.SiteID {
+		t.Errorf("期望 fanclub site ID %d，实际 %d", fakeapi.SiteID, channel.FanclubSite.ID)
+	}
+
+	if _, err := c.GetChannelByDomain(context.Background(), "https://nicochannel.jp/unknown"); err == nil {
+		t.Error("不存在的频道应返回错误")
+	}
 }
 
 func TestGetFanclubSiteInfo(t *testing.T) {
-	siteID := 387
-	fanclubInfo, err := GetFanclubSiteInfo(siteID)
+	c := NewClient(fakeapi.New(t).Client())
+
+	info, err := c.GetFanclubSiteInfo(context.Background(), fakeapi.SiteID)
 	if err != nil {
-		t.Fatalf("获取 fanclub site 信息失败: %v", err)
+		t.Fatalf("获取 fanclub 信息失败: %v", err)
+	}
+	if info.FanclubSiteName != "テストチャンネル" || info.ThumbnailImageURL == "" {
+		t.Errorf("fanclub 信息错误: %+v", info)
 	}
+}
+
+func TestResolveLink(t *testing.T) {
+	c := NewClient(fakeapi.New(t).Client())
 
-	t.Logf("=== 获取到的结果 ===")
-	t.Logf("Fanclub Site ID: %d", siteID)
-	t.Logf("名称: %s", fanclubInfo.FanclubSiteName)
-	t.Logf("描述: %s", fanclubInfo.Description)
-	t.Logf("Favicon URL: %s", fanclubInfo.FaviconURL)
-	t.Logf("缩略图 URL: %s", fanclubInfo.ThumbnailImageURL)
+	link, err := ParseLink(fakeapi.ChannelURL + "/video/" + fakeapi.VideoCode)
+	if err != nil {
+		t.Fatalf("解析链接失败: %v", err)
+	}
 
-	t.Logf("=== 输出目录结构 ===")
-	t.Logf("视频目录: ./out/%s/動画/", fanclubInfo.FanclubSiteName)
-	t.Logf("生放送目录: ./out/%s/生放送/", fanclubInfo.FanclubSiteName)
-	t.Logf("新闻目录: ./out/%s/NEWS/", fanclubInfo.FanclubSiteName)
+	fcSiteID, err := c.ResolveLink(context.Background(), link)
+	if err != nil {
+		t.Fatalf("解析频道失败: %v", err)
+	}
+	if fcSiteID != fakeapi.SiteID {
+		t.Errorf("期望 fanclub site ID %d，实际 %d", fakeapi.SiteID, fcSiteID)
+	}
 }
@@ -0,0 +1,89 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"ncpd/internal/client"
+)
+
+// 链接指向的内容类型
+const (
+	LinkChannel = "channel"
+	LinkVideo   = "video"
+	LinkLive    = "live"
+)
+
+// Link 表示从频道或视频链接中解析出的信息，例如
+// https://nicochannel.jp/<channel>/video/<content_code>
+// https://qlover.jp/<channel>/live/<content_code>
+type Link struct {
+	Platform    *client.Platform
+	Slug        string // 频道名
+	Kind        string // LinkChannel、LinkVideo 或 LinkLive
+	ContentCode string // 频道链接为空
+}
+
+// ParseLink 解析频道或视频链接，根据域名识别所属平台
+func ParseLink(rawURL string) (*Link, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("channel.ParseLink: 无效的链接 %s: %w", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("channel.ParseLink: 无效的链接 %s", rawURL)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	var platform *client.Platform
+	for i := range client.SupportedPlatforms {
+		if host == client.SupportedPlatforms[i].Domain {
+			platform = &client.SupportedPlatforms[i]
+			break
+		}
+	}
+	if platform == nil {
+		return nil, fmt.Errorf("channel.ParseLink: 不支持的平台 %s", u.Hostname())
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if segments[0] == "" {
+		return nil, fmt.Errorf("channel.ParseLink: 链接中没有频道名 %s", rawURL)
+	}
+
+	link := &Link{Platform: platform, Slug: segments[0], Kind: LinkChannel}
+	// /<channel>/video/<code> 和 /<channel>/live/<code> 指向单个视频，其它页面视为频道链接
+	if len(segments) >= 3 && (segments[1] == LinkVideo || segments[1] == LinkLive) && segments[2] != "" {
+		link.Kind = segments[1]
+		link.ContentCode = segments[2]
+	}
+
+	return link, nil
+}
+
+// IsLink 判断参数是否为链接而不是频道名或 ID
+func IsLink(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// ChannelURL 返回频道首页地址，与频道列表中的 domain 字段格式相同
+func (l *Link) ChannelURL() string {
+	return fmt.Sprintf("https://%s/%s", l.Platform.Domain, l.Slug)
+}
+
+// ResolveLink 获取链接所属频道的 fanclub site ID，调用前需要使用链接的平台初始化客户端
+func ResolveLink(ctx context.Context, link *Link) (int, error) {
+	return NewClient(client.Default()).ResolveLink(ctx, link)
+}
+
+// ResolveLink 获取链接所属频道的 fanclub site ID，c 需要使用链接的平台
+func (c *Client) ResolveLink(ctx context.Context, link *Link) (int, error) {
+	provider, err := c.GetChannelByDomain(ctx, link.ChannelURL())
+	if err != nil {
+		return -1, err
+	}
+
+	return provider.FanclubSite.ID, nil
+}
@@ -0,0 +1,43 @@
+package channel
+
+import (
+	"testing"
+)
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		url         string
+		domain      string
+		slug        string
+		kind        string
+		contentCode string
+	}{
+		{"https://nicochannel.jp/sakakura-sakura", "nicochannel.jp", "sakakura-sakura", LinkChannel, ""},
+		{"https://nicochannel.jp/sakakura-sakura/videos?sort=new", "nicochannel.jp", "sakakura-sakura", LinkChannel, ""},
+		{"https://nicochannel.jp/sakakura-sakura/video/smKNsmQmsJ7H4N9qWfD6iEVm", "nicochannel.jp", "sakakura-sakura", LinkVideo, "smKNsmQmsJ7H4N9qWfD6iEVm"},
+		{"https://www.qlover.jp/abc/live/smAbc123/", "qlover.jp", "abc", LinkLive, "smAbc123"},
+		{" https://qlover.jp/abc/video/ ", "qlover.jp", "abc", LinkChannel, ""},
+	}
+
+	for _, tt := range tests {
+		link, err := ParseLink(tt.url)
+		if err != nil {
+			t.Errorf("解析 %s 失败: %v", tt.url, err)
+			continue
+		}
+		if link.Platform.Domain != tt.domain || link.Slug != tt.slug || link.Kind != tt.kind || link.ContentCode != tt.contentCode {
+			t.Errorf("解析 %s 的结果错误: %+v", tt.url, link)
+		}
+	}
+
+	link, _ := ParseLink("https://nicochannel.jp/sakakura-sakura/video/sm1")
+	if link.ChannelURL() != "https://nicochannel.jp/sakakura-sakura" {
+		t.Errorf("频道地址错误: %s", link.ChannelURL())
+	}
+
+	for _, url := range []string{"https://example.com/abc", "https://nicochannel.jp/", "nicochannel.jp/abc", "ftp://nicochannel.jp/abc"} {
+		if _, err := ParseLink(url); err == nil {
+			t.Errorf("期望 %s 返回错误", url)
+		}
+	}
+}
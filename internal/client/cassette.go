@@ -0,0 +1,368 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted 录制时替换 token 等敏感信息的占位符
+const Redacted = "REDACTED"
+
+// sensitiveKeys 录制时需要替换的查询参数、表单字段和 JSON 字段
+var sensitiveKeys = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"token":         true,
+	"code":          true,
+	"code_verifier": true,
+	"client_id":     true,
+	"client_secret": true,
+	"session_id":    true,
+}
+
+// sensitiveHeaders 录制时需要替换的请求头和响应头
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Interaction 一次请求和响应的记录，保存为 cassette 目录中的一个 JSON 文件
+type Interaction struct {
+	RecordedAt time.Time        `json:"recorded_at"`
+	Request    RecordedRequest  `json:"request"`
+	Response   RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// cassette 不为 nil 时包装所有客户端的 Transport，用于录制或回放请求
+var cassette func(base http.RoundTripper) http.RoundTripper
+
+// Record 将之后所有 API 请求和响应录制到 dir，token 等敏感信息会被替换为 Redacted
+// 需要在第一次发起请求之前调用
+func Record(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建录制目录失败: %w", err)
+	}
+
+	r := &recorder{dir: dir}
+	cassette = func(base http.RoundTripper) http.RoundTripper {
+		return &recordTransport{base: base, recorder: r}
+	}
+	return nil
+}
+
+// Replay 之后所有 API 请求都从 dir 中录制的响应返回，不访问网络
+// 需要在第一次发起请求之前调用
+func Replay(dir string) error {
+	p, err := loadPlayer(dir)
+	if err != nil {
+		return err
+	}
+
+	cassette = func(http.RoundTripper) http.RoundTripper {
+		return p
+	}
+	return nil
+}
+
+// wrapCassette 在录制或回放模式下包装 base
+func wrapCassette(base http.RoundTripper) http.RoundTripper {
+	if cassette == nil {
+		return base
+	}
+	return cassette(base)
+}
+
+// recorder 为录制的文件编号，多个客户端共用
+type recorder struct {
+	mu  sync.Mutex
+	dir string
+	seq int
+}
+
+// save 保存一次请求，文件名为 序号-方法-路径.json
+func (r *recorder) save(interaction *Interaction) error {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	name := fmt.Sprintf("%04d-%s%s.json", r.seq, interaction.Request.Method, fileSlug(interaction.Request.URL))
+	return os.WriteFile(filepath.Join(r.dir, name), data, 0644)
+}
+
+var slugPattern = regexp.MustCompile(`[^A-Za-z0-9_.]+`)
+
+// fileSlug 将 URL 的路径转换为可以用作文件名的部分
+func fileSlug(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	slug := strings.Trim(slugPattern.ReplaceAllString(u.Path, "-"), "-")
+	if len(slug) > 80 {
+		slug = slug[:80]
+	}
+	if slug == "" {
+		return ""
+	}
+	return "-" + slug
+}
+
+// recordTransport 发起请求并录制请求和响应
+type recordTransport struct {
+	base     http.RoundTripper
+	recorder *recorder
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		RecordedAt: time.Now(),
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    sanitizeURL(req.URL),
+			Header: sanitizeHeader(req.Header),
+			Body:   sanitizeBody(req.Header.Get("Content-Type"), reqBody),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     sanitizeHeader(resp.Header),
+			Body:       sanitizeBody(resp.Header.Get("Content-Type"), respBody),
+		},
+	}
+	if err := t.recorder.save(interaction); err != nil {
+		return nil, fmt.Errorf("保存录制的请求失败: %w", err)
+	}
+	return resp, nil
+}
+
+// readRequestBody 读取请求体，读取后请求仍然可以发送
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// player 按请求返回录制的响应
+type player struct {
+	mu           sync.Mutex
+	interactions map[string][]*Interaction // 按 interactionKey 分组，按录制顺序排列
+}
+
+// loadPlayer 读取 dir 中录制的所有请求
+func loadPlayer(dir string) (*player, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s 中没有录制的请求", dir)
+	}
+	sort.Strings(files)
+
+	p := &player{interactions: make(map[string][]*Interaction)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", filepath.Base(file), err)
+		}
+
+		key := interactionKey(interaction.Request.Method, interaction.Request.URL, interaction.Request.Body)
+		p.interactions[key] = append(p.interactions[key], &interaction)
+	}
+	return p, nil
+}
+
+// interactionKey 回放时用于匹配请求，请求和录制的内容都经过相同的替换
+func interactionKey(method string, url string, body string) string {
+	return method + " " + url + "\n" + body
+}
+
+// RoundTrip 返回与请求匹配的下一个录制的响应，同一个请求录制了多次时按录制顺序返回，用完后重复返回最后一个
+func (p *player) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	target := sanitizeURL(req.URL)
+	key := interactionKey(req.Method, target, sanitizeBody(req.Header.Get("Content-Type"), body))
+
+	p.mu.Lock()
+	queue := p.interactions[key]
+	if len(queue) > 1 {
+		p.interactions[key] = queue[1:]
+	}
+	p.mu.Unlock()
+
+	if len(queue) == 0 {
+		return nil, fmt.Errorf("录制中没有请求 %s %s", req.Method, target)
+	}
+
+	recorded := queue[0].Response
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// sanitizeURL 替换 URL 查询参数中的敏感信息
+func sanitizeURL(u *url.URL) string {
+	clone := *u
+	if clone.RawQuery != "" {
+		query := clone.Query()
+		sanitizeValues(query)
+		clone.RawQuery = query.Encode()
+	}
+	return clone.String()
+}
+
+// sanitizeHeader 替换 token 和 cookie，去掉替换后不再正确的 Content-Length
+func sanitizeHeader(header http.Header) http.Header {
+	clone := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if clone.Get(name) != "" {
+			clone.Set(name, Redacted)
+		}
+	}
+	clone.Del("Content-Length")
+	return clone
+}
+
+func sanitizeValues(values url.Values) {
+	for key, value := range values {
+		if sensitiveKeys[key] {
+			for i := range value {
+				value[i] = Redacted
+			}
+		}
+	}
+}
+
+// sanitizeBody 替换表单和 JSON 中的敏感字段，其它格式原样保存
+func sanitizeBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return string(body)
+		}
+		sanitizeValues(values)
+		return values.Encode()
+	}
+
+	// 使用 json.Number 保留 ID 等大整数的精度
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if decoder.Decode(&v) != nil || decoder.More() {
+		return string(body)
+	}
+	// 没有敏感字段时原样保存，保留字段顺序便于对比
+	if !sanitizeJSON(v) {
+		return string(body)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(data)
+}
+
+// sanitizeJSON 递归替换敏感字段中的字符串，返回是否有字段被替换
+func sanitizeJSON(v any) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if _, ok := value.(string); ok && sensitiveKeys[key] {
+				v[key] = Redacted
+				changed = true
+			} else if sanitizeJSON(value) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if sanitizeJSON(value) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
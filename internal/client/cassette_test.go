@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// go test -v ./internal/client -run TestRecordReplay
+func TestRecordReplay(t *testing.T) {
+	t.Cleanup(func() { cassette = nil })
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret-cookie")
+		switch r.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token":"secret-access","refresh_token":"secret-refresh","expires_in":300}`))
+		case "/counter":
+			w.Write([]byte(`{"id":9007199254740993,"count":` + string('0'+rune(n)) + `}`))
+		}
+	}))
+
+	dir := t.TempDir()
+	if err := Record(dir); err != nil {
+		t.Fatalf("开启录制失败: %v", err)
+	}
+
+	c := New(&SupportedPlatforms[0], newTestConfig())
+	c.HTTP.SetBaseURL(server.URL)
+	c.Tokens = &fakeTokenSource{token: "secret-bearer"}
+
+	ctx := context.Background()
+	recorded := make([]string, 3)
+	resp, err := c.R(ctx).SetFormData(map[string]string{"grant_type": "refresh_token", "refresh_token": "secret-refresh"}).Post("/oauth/token")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	recorded[0] = resp.String()
+	for i := 1; i < 3; i++ {
+		resp, err := c.AuthR(ctx).SetQueryParam("session_id", "secret-session").Get("/counter")
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		recorded[i] = resp.String()
+	}
+	server.Close()
+
+	// 录制的文件中不应包含任何 token
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 3 {
+		t.Fatalf("期望录制 3 个请求，实际 %d 个", len(files))
+	}
+	for _, file := range files {
+		data, _ := os.ReadFile(file)
+		if strings.Contains(string(data), "secret") {
+			t.Errorf("%s 中包含未替换的敏感信息:\n%s", filepath.Base(file), data)
+		}
+	}
+
+	// 回放时不访问网络，按录制顺序返回响应
+	if err := Replay(dir); err != nil {
+		t.Fatalf("开启回放失败: %v", err)
+	}
+	replay := New(&SupportedPlatforms[0], newTestConfig())
+	replay.HTTP.SetBaseURL(server.URL)
+	replay.Tokens = &fakeTokenSource{token: "another-bearer"}
+
+	resp, err = replay.R(ctx).SetFormData(map[string]string{"grant_type": "refresh_token", "refresh_token": "another-refresh"}).Post("/oauth/token")
+	if err != nil {
+		t.Fatalf("回放失败: %v", err)
+	}
+	if !strings.Contains(resp.String(), `"access_token":"REDACTED"`) || !strings.Contains(resp.String(), `"expires_in":300`) {
+		t.Errorf("回放的响应错误: %s", resp.String())
+	}
+
+	for i := 1; i < 4; i++ {
+		resp, err := replay.AuthR(ctx).SetQueryParam("session_id", "another-session").Get("/counter")
+		if err != nil {
+			t.Fatalf("回放失败: %v", err)
+		}
+		// 录制的响应用完后重复返回最后一个
+		expected := recorded[min(i, 2)]
+		if resp.String() != expected {
+			t.Errorf("第 %d 次回放期望 %s，实际 %s", i, expected, resp.String())
+		}
+	}
+
+	if _, err := replay.R(ctx).Get("/unknown"); err == nil {
+		t.Error("没有录制的请求应返回错误")
+	}
+	if requests.Load() != 3 {
+		t.Errorf("回放时不应访问服务器，服务器共收到 %d 个请求", requests.Load())
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ncpd/config"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// JST 接口返回的时间不带时区，为日本时间
+var JST = time.FixedZone("JST", 9*60*60)
+
+// Client 访问某个平台 API 的客户端
+// 每个 Client 有各自的平台、Base URL 和 token，可以同时使用多个平台或账号
+type Client struct {
+	Platform *Platform
+	HTTP     *resty.Client // Base URL 为平台的 API 地址
+	Tokens   TokenSource   // 需要认证的请求使用，为 nil 时不设置 token
+}
+
+// New 根据配置创建平台的客户端，Base URL 为平台的默认 API 地址，可调用 Init 获取实际地址
+func New(platform *Platform, cfg *config.Config) *Client {
+	http := newClient(cfg)
+	http.SetBaseURL(platform.DefaultAPIBaseURL)
+
+	return &Client{
+		Platform: platform,
+		HTTP:     http,
+	}
+}
+
+// Default 返回使用当前平台和全局 resty 客户端的 Client，供各个包的包级函数使用
+func Default() *Client {
+	return &Client{
+		Platform: CurrentPlatform,
+		HTTP:     Get(),
+	}
+}
+
+// Init 从平台的 site/settings.json 获取 API base URL
+func (c *Client) Init(ctx context.Context) error {
+	apiBaseURL, err := GetAPIBaseURL(ctx, c.Platform)
+	if err != nil {
+		return fmt.Errorf("获取 API base URL 失败: %w", err)
+	}
+
+	c.HTTP.SetBaseURL(apiBaseURL)
+	return nil
+}
+
+// R 返回使用 ctx 的请求
+func (c *Client) R(ctx context.Context) *resty.Request {
+	return c.HTTP.R().SetContext(ctx)
+}
+
+// AuthR 返回使用 ctx 的需要认证的请求，由 Tokens 设置 bearer token，
+// 服务器返回 401 时刷新 token 并重发一次。返回的请求已设置 context，不要再调用 SetContext
+func (c *Client) AuthR(ctx context.Context) *resty.Request {
+	if c.Tokens != nil {
+		ctx = WithTokenSource(ctx, c.Tokens)
+	}
+	return c.R(ctx)
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// go test -v ./internal/client -run TestClient
+func TestClient(t *testing.T) {
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + "|" + r.Header.Get("Authorization")))
+		}))
+	}
+	nico := newServer("nico")
+	defer nico.Close()
+	qlover := newServer("qlover")
+	defer qlover.Close()
+
+	// 两个平台的客户端互不影响
+	nicoClient := New(&SupportedPlatforms[0], newTestConfig())
+	nicoClient.HTTP.SetBaseURL(nico.URL)
+	nicoClient.Tokens = &fakeTokenSource{token: "fresh"}
+
+	qloverClient := New(&SupportedPlatforms[1], newTestConfig())
+	qloverClient.HTTP.SetBaseURL(qlover.URL)
+
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		resp     func() (string, error)
+		expected string
+	}{
+		{"nico R", func() (string, error) { resp, err := nicoClient.R(ctx).Get("/"); return resp.String(), err }, "nico|"},
+		{"nico AuthR", func() (string, error) { resp, err := nicoClient.AuthR(ctx).Get("/"); return resp.String(), err }, "nico|Bearer fresh"},
+		// 没有 Tokens 时 AuthR 不设置 token
+		{"qlover AuthR", func() (string, error) { resp, err := qloverClient.AuthR(ctx).Get("/"); return resp.String(), err }, "qlover|"},
+	}
+	for _, tt := range tests {
+		body, err := tt.resp()
+		if err != nil {
+			t.Errorf("%s: 请求失败: %v", tt.name, err)
+			continue
+		}
+		if body != tt.expected {
+			t.Errorf("%s: 期望 %q，实际 %q", tt.name, tt.expected, body)
+		}
+	}
+
+	if nicoClient.HTTP == Get() || qloverClient.HTTP == nicoClient.HTTP {
+		t.Error("New 应创建独立的 resty 客户端")
+	}
+}
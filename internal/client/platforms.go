@@ -1,23 +1,45 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-resty/resty/v2"
 )
 
 type Platform struct {
-	Name              string
-	Domain            string
-	DefaultAPIBaseURL string
-	TemplateFile      string
+	Name                string
+	Key                 string // 用于命令行参数和环境变量名，如 NICO_CLIENT_ID_QLOVER
+	Domain              string
+	DefaultAPIBaseURL   string
+	TemplateFile        string
+	GalleryTemplateFile string // 生成静态网站使用的模板，样式与 TemplateFile 相同
+	SiteURL             string // 站点地址，为空时为 https://<Domain>
+	AuthURL             string // 认证服务器地址，为空时为 https://auth.<Domain>
+}
+
+// SiteBaseURL 返回平台的站点地址
+func (p *Platform) SiteBaseURL() string {
+	if p.SiteURL != "" {
+		return p.SiteURL
+	}
+	return "https://" + p.Domain
+}
+
+// AuthBaseURL 返回平台的认证服务器地址
+func (p *Platform) AuthBaseURL() string {
+	if p.AuthURL != "" {
+		return p.AuthURL
+	}
+	return "https://auth." + p.Domain
 }
 
 // 支持的平台列表
 var SupportedPlatforms = []Platform{
-	{Name: "Nicochannel+", Domain: "nicochannel.jp", DefaultAPIBaseURL: "https://api.nicochannel.jp/fc", TemplateFile: "assets/template_white_bg.html"},
-	{Name: "QloveR", Domain: "qlover.jp", DefaultAPIBaseURL: "https://api.qlover.jp/fc", TemplateFile: "assets/template_black_bg.html"},
+	{Name: "Nicochannel+", Key: "nicochannel", Domain: "nicochannel.jp", DefaultAPIBaseURL: "https://api.nicochannel.jp/fc", TemplateFile: "assets/template_white_bg.html", GalleryTemplateFile: "assets/gallery_white_bg.html"},
+	{Name: "QloveR", Key: "qlover", Domain: "qlover.jp", DefaultAPIBaseURL: "https://api.qlover.jp/fc", TemplateFile: "assets/template_black_bg.html", GalleryTemplateFile: "assets/gallery_black_bg.html"},
 }
 
 // 当前选择的平台
@@ -27,6 +49,20 @@ func SetCurrentPlatform(platform *Platform) {
 	CurrentPlatform = platform
 }
 
+// FindPlatform 根据名称或域名查找平台，例如 "nicochannel"、"Nicochannel+"、"qlover.jp"
+func FindPlatform(name string) (*Platform, error) {
+	key := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "+"))
+	for i := range SupportedPlatforms {
+		platform := &SupportedPlatforms[i]
+		if key == strings.ToLower(strings.TrimSuffix(platform.Name, "+")) ||
+			key == platform.Key || key == strings.ToLower(platform.Domain) {
+			return platform, nil
+		}
+	}
+
+	return nil, fmt.Errorf("不支持的平台: %s", name)
+}
+
 type SiteSettings struct {
 	PlatformID     string `json:"platform_id"`
 	FanclubSiteID  string `json:"fanclub_site_id"`
@@ -35,12 +71,12 @@ type SiteSettings struct {
 }
 
 // GetAPIBaseURL 根据平台获取 API base URL
-func GetAPIBaseURL(platform *Platform) (string, error) {
+func GetAPIBaseURL(ctx context.Context, platform *Platform) (string, error) {
 	var settings SiteSettings
-	resp, err := resty.New().R().
+	resp, err := resty.New().SetTransport(wrapCassette(http.DefaultTransport)).R().
+		SetContext(ctx).
 		SetResult(&settings).
-		SetPathParam("domain", platform.Domain).
-		Get("https://{domain}/site/settings.json")
+		Get(platform.SiteBaseURL() + "/site/settings.json")
 
 	if err != nil {
 		return "", err
@@ -58,8 +94,8 @@ func GetAPIBaseURL(platform *Platform) (string, error) {
 }
 
 // InitClientWithPlatform 根据平台设置 Resty 客户端的 Base URL
-func InitClientWithPlatform(platform *Platform) error {
-	apiBaseURL, err := GetAPIBaseURL(platform)
+func InitClientWithPlatform(ctx context.Context, platform *Platform) error {
+	apiBaseURL, err := GetAPIBaseURL(ctx, platform)
 	if err != nil {
 		return fmt.Errorf("获取 API base URL 失败: %w", err)
 	}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestFindPlatform(t *testing.T) {
+	cases := map[string]string{
+		"nicochannel":  "nicochannel.jp",
+		"Nicochannel+": "nicochannel.jp",
+		"qlover.jp":    "qlover.jp",
+		"QloveR":       "qlover.jp",
+	}
+
+	for name, domain := range cases {
+		platform, err := FindPlatform(name)
+		if err != nil {
+			t.Errorf("查找平台 %s 失败: %v", name, err)
+			continue
+		}
+		if platform.Domain != domain {
+			t.Errorf("平台 %s 期望为 %s，实际为 %s", name, domain, platform.Domain)
+		}
+	}
+
+	if _, err := FindPlatform("unknown"); err == nil {
+		t.Error("期望未知平台返回错误")
+	}
+}
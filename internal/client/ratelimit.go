@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter 令牌桶限流器，所有 API 请求共用
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒补充的令牌数
+	burst  float64 // 令牌桶容量
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter 创建每秒最多 rate 个请求、允许 burst 个突发请求的限流器，rate 为 0 时返回 nil 表示不限制
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// limiterKey 限流的设置
+type limiterKey struct {
+	rate  float64
+	burst int
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[limiterKey]*rateLimiter) // 同一个进程中相同设置的客户端共用一个令牌桶
+)
+
+// sharedRateLimiter 返回相同设置共用的限流器，后台录制等单独创建的客户端与前台的客户端共用同一个令牌桶，
+// 同时进行的任务加起来也不会超过限制
+func sharedRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	key := limiterKey{rate, burst}
+	if limiters[key] == nil {
+		limiters[key] = newRateLimiter(rate, burst)
+	}
+	return limiters[key]
+}
+
+// reserve 取出一个令牌，返回需要等待的时间
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// 令牌不足时预支，等待补足后再发起请求
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// Wait 等待直到可以发起请求，ctx 取消时返回错误
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	wait := l.reserve()
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
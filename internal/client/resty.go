@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"sync"
 
+	"ncpd/config"
+
 	"github.com/go-resty/resty/v2"
 )
 
@@ -21,13 +23,31 @@ func Get() *resty.Client {
 
 // initClient 初始化全局 resty 客户端
 func initClient() {
-	restyClient = resty.New()
+	restyClient = newClient(config.Load())
+}
+
+// newClient 根据配置创建 resty 客户端
+func newClient(cfg *config.Config) *resty.Client {
+	c := resty.New()
 
 	// 默认 Base URL
-	restyClient.SetBaseURL(CurrentPlatform.DefaultAPIBaseURL)
+	c.SetBaseURL(CurrentPlatform.DefaultAPIBaseURL)
+	c.SetTimeout(cfg.APITimeout)
+
+	// 为使用 WithTokenSource 的请求自动设置 token，录制时记录的是设置 token 后的请求
+	c.SetTransport(&authTransport{base: wrapCassette(c.GetClient().Transport)})
+
+	// 失败重试，每次重试也会经过限流
+	configureRetry(c, cfg.RetryCount, cfg.RetryWait, cfg.RetryMaxWait)
+
+	// 所有请求共用的限流，同一个进程中的所有客户端共用
+	limiter := sharedRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	c.OnBeforeRequest(func(c *resty.Client, req *resty.Request) error {
+		return limiter.Wait(req.Context())
+	})
 
 	// 统一错误处理
-	restyClient.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
+	c.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
 		if resp.IsError() {
 			return &HTTPError{
 				StatusCode: resp.StatusCode(),
@@ -37,6 +57,23 @@ func initClient() {
 		}
 		return nil
 	})
+
+	return c
+}
+
+// NewMediaClient 创建下载分片、密钥等媒体文件使用的客户端，不使用 API 的 Base URL、token 和限流，
+// 但使用与 API 相同的重试策略，这些请求都是幂等的 GET
+func NewMediaClient(cfg *config.Config) *resty.Client {
+	c := resty.New()
+	configureRetry(c, cfg.RetryCount, cfg.RetryWait, cfg.RetryMaxWait)
+
+	// 不解析响应的请求（如流式读取的分片）重试前关闭失败的响应，避免连接泄漏
+	c.AddRetryHook(func(resp *resty.Response, err error) {
+		if resp != nil && resp.RawResponse != nil {
+			resp.RawResponse.Body.Close()
+		}
+	})
+	return c
 }
 
 type HTTPError struct {
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// configureRetry 设置重试策略：只重试幂等请求和使用 WithRetry 标记的请求，遇到网络错误、429 和 5xx 时按指数退避（带随机抖动）重试，
+// 服务器返回 Retry-After 时优先按其等待
+func configureRetry(c *resty.Client, count int, wait time.Duration, maxWait time.Duration) {
+	c.SetRetryCount(count).
+		SetRetryWaitTime(wait).
+		SetRetryMaxWaitTime(maxWait).
+		SetRetryAfter(retryAfter).
+		AddRetryCondition(shouldRetry)
+}
+
+type retryKey struct{}
+
+// WithRetry 标记使用该 context 的请求可以安全地重复发送，用于只读取数据的 POST（如分页获取弹幕）
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+// retryAllowed 判断请求是否可以重试：请求方法是幂等的，或者 context 使用了 WithRetry
+func retryAllowed(req *resty.Request) bool {
+	if isIdempotent(req.Method) {
+		return true
+	}
+	allowed, _ := req.Context().Value(retryKey{}).(bool)
+	return allowed
+}
+
+// isIdempotent 判断请求方法是否可以安全地重复发送
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry 判断请求失败后是否需要重试
+func shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil || !retryAllowed(resp.Request) {
+		return false
+	}
+	if resp.Request.Context().Err() != nil {
+		return false
+	}
+
+	// 连接失败、超时、连接被中断等网络错误，刷新 token 失败等其它错误不重试
+	// url.Error 本身也实现了 net.Error，需要先取出原始错误
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter 解析 Retry-After 响应头，返回 0 时使用指数退避
+func retryAfter(c *resty.Client, resp *resty.Response) (time.Duration, error) {
+	return parseRetryAfter(resp.Header().Get("Retry-After"), time.Now()), nil
+}
+
+// parseRetryAfter 解析秒数或 HTTP 日期格式的 Retry-After
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
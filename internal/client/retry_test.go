@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ncpd/config"
+)
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		APITimeout:   5 * time.Second,
+		RetryCount:   3,
+		RetryWait:    time.Millisecond,
+		RetryMaxWait: 10 * time.Millisecond,
+	}
+}
+
+// go test -v ./internal/client -run TestRetry
+func TestRetry(t *testing.T) {
+	var attempts, postBodies atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := attempts.Add(1)
+		if body, _ := io.ReadAll(r.Body); r.Method == http.MethodPost && string(body) == `{"token":"t"}` {
+			postBodies.Add(1)
+		}
+		switch r.URL.Path {
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		case "/not-found":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	c := newClient(newTestConfig())
+
+	// GET 遇到 5xx 时重试
+	resp, err := c.R().Get(server.URL + "/flaky")
+	if err != nil || resp.String() != "ok" || attempts.Load() != 3 {
+		t.Errorf("期望重试后成功，请求 %d 次，错误 %v", attempts.Load(), err)
+	}
+
+	// 4xx 不重试
+	attempts.Store(0)
+	if _, err := c.R().Get(server.URL + "/not-found"); err == nil || attempts.Load() != 1 {
+		t.Errorf("404 不应重试，请求 %d 次", attempts.Load())
+	}
+
+	// POST 不是幂等请求，不重试
+	attempts.Store(0)
+	if _, err := c.R().Post(server.URL + "/post"); err == nil || attempts.Load() != 1 {
+		t.Errorf("POST 不应重试，请求 %d 次", attempts.Load())
+	}
+
+	// 使用 WithRetry 标记的只读 POST 重试，每次都发送相同的请求体
+	attempts.Store(0)
+	resp, err = c.R().SetContext(WithRetry(context.Background())).SetBody(map[string]string{"token": "t"}).Post(server.URL + "/flaky")
+	if err != nil || resp.String() != "ok" || attempts.Load() != 3 {
+		t.Errorf("标记可以重试的 POST 期望重试后成功，请求 %d 次，错误 %v", attempts.Load(), err)
+	}
+	if bodies := postBodies.Load(); bodies != 3 {
+		t.Errorf("每次重试都应发送请求体，实际 %d 次", bodies)
+	}
+
+	// 重试次数用完后返回错误
+	attempts.Store(0)
+	if _, err := c.R().Get(server.URL + "/down"); err == nil || attempts.Load() != 4 {
+		t.Errorf("期望请求 4 次后失败，请求 %d 次", attempts.Load())
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	var first time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.RetryMaxWait = 2 * time.Second
+	if _, err := newClient(cfg).R().Get(server.URL); err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if wait := time.Since(first); wait < time.Second {
+		t.Errorf("应按 Retry-After 等待 1 秒，实际 %s", wait)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"invalid":                       0,
+		"Mon, 01 Jan 2024 00:00:30 GMT": 30 * time.Second,
+		"Sun, 31 Dec 2023 23:59:00 GMT": 0,
+	}
+	for value, expected := range tests {
+		if d := parseRetryAfter(value, now); d != expected {
+			t.Errorf("parseRetryAfter(%q) = %s，期望 %s", value, d, expected)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0, 10) != nil {
+		t.Error("rate 为 0 时不应限流")
+	}
+
+	limiter := newRateLimiter(100, 2)
+	for i := 0; i < 2; i++ {
+		if wait := limiter.reserve(); wait != 0 {
+			t.Errorf("突发请求不应等待，第 %d 次等待 %s", i+1, wait)
+		}
+	}
+	if wait := limiter.reserve(); wait <= 0 || wait > 10*time.Millisecond {
+		t.Errorf("令牌用完后应等待约 10ms，实际 %s", wait)
+	}
+
+	start := time.Now()
+	cfg := newTestConfig()
+	cfg.RateLimit = 50
+	cfg.RateBurst = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	c := newClient(cfg)
+	for i := 0; i < 6; i++ {
+		c.R().Get(server.URL)
+	}
+	// 第一个请求不等待，之后每个请求间隔 20ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("6 个请求应至少耗时 100ms，实际 %s", elapsed)
+	}
+}
+
+// 每个 Client 各自创建 resty 客户端，但共用同一个令牌桶
+func TestRateLimiterShared(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.RateLimit = 40
+	cfg.RateBurst = 1
+	platform := &Platform{Key: "test"}
+	a, b := New(platform, cfg), New(platform, cfg)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		a.HTTP.R().Get(server.URL)
+		b.HTTP.R().Get(server.URL)
+	}
+	// 两个客户端合计 6 个请求，第一个请求不等待，之后每个请求间隔 25ms
+	if elapsed := time.Since(start); elapsed < 125*time.Millisecond {
+		t.Errorf("6 个请求应至少耗时 125ms，实际 %s", elapsed)
+	}
+}
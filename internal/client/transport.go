@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// TokenSource 为需要认证的请求提供 access token
+type TokenSource interface {
+	// Token 返回有效的 access token
+	Token(ctx context.Context) (string, error)
+	// Refresh 在 stale 被服务器拒绝后强制刷新 token；如果其它请求已经刷新过，直接返回新的 token
+	Refresh(ctx context.Context, stale string) (string, error)
+}
+
+type tokenSourceKey struct{}
+
+// WithTokenSource 标记使用该 context 的请求需要认证，由 authTransport 设置 bearer token
+func WithTokenSource(ctx context.Context, source TokenSource) context.Context {
+	return context.WithValue(ctx, tokenSourceKey{}, source)
+}
+
+// WithoutTokenSource 去掉 ctx 上的认证标记，刷新 token 的请求使用，避免获取 token 时再次请求 token
+func WithoutTokenSource(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tokenSourceKey{}, nil)
+}
+
+// authTransport 为需要认证的请求设置 bearer token，遇到 401 时刷新 token 并重发一次
+type authTransport struct {
+	base http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	source, ok := req.Context().Value(tokenSourceKey{}).(TokenSource)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	token, err := source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(withBearer(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// 请求体无法重新读取时不能重发
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	// token 可能被服务器提前吊销，强制刷新后重发一次
+	resp.Body.Close()
+	if token, err = source.Refresh(req.Context(), token); err != nil {
+		return nil, fmt.Errorf("token 被拒绝，刷新失败: %w", err)
+	}
+
+	retry := withBearer(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.base.RoundTrip(retry)
+}
+
+// withBearer 复制请求并设置 Authorization 头，RoundTripper 不能修改原请求
+func withBearer(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeTokenSource 每次刷新生成新的 token
+type fakeTokenSource struct {
+	mu         sync.Mutex
+	token      string
+	refreshes  int
+	refreshErr error
+}
+
+func (s *fakeTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token, nil
+}
+
+func (s *fakeTokenSource) Refresh(ctx context.Context, stale string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refreshErr != nil {
+		return "", s.refreshErr
+	}
+	s.refreshes++
+	s.token = "fresh"
+	return s.token, nil
+}
+
+// go test -v ./internal/client -run TestAuthTransport
+func TestAuthTransport(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Header.Get("Authorization")+" "+string(body))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// token 被吊销时刷新并重发，请求体保持不变
+	source := &fakeTokenSource{token: "revoked"}
+	resp, err := Get().R().
+		SetContext(WithTokenSource(context.Background(), source)).
+		SetBody(map[string]string{"a": "b"}).
+		Post(server.URL)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	if resp.String() != "ok" || source.refreshes != 1 {
+		t.Errorf("期望刷新一次后成功，响应 %q，刷新 %d 次", resp.String(), source.refreshes)
+	}
+	if len(requests) != 2 || requests[0] != `Bearer revoked {"a":"b"}` || requests[1] != `Bearer fresh {"a":"b"}` {
+		t.Errorf("请求错误: %q", requests)
+	}
+
+	// 不需要认证的请求不设置 token，也不重发
+	requests = nil
+	_, err = Get().R().Get(server.URL)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("期望返回 401，实际 %v", err)
+	}
+	if len(requests) != 1 || requests[0] != " " {
+		t.Errorf("请求错误: %q", requests)
+	}
+
+	// 刷新失败时返回刷新的错误
+	refreshErr := errors.New("refresh token 已失效")
+	_, err = Get().R().
+		SetContext(WithTokenSource(context.Background(), &fakeTokenSource{token: "revoked", refreshErr: refreshErr})).
+		Get(server.URL)
+	if !errors.Is(err, refreshErr) {
+		t.Errorf("期望返回刷新的错误，实际 %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package danmaku
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ncpd/internal/video"
+)
+
+// ASSOptions 生成 ASS 字幕的参数，零值表示使用默认值
+type ASSOptions struct {
+	Width          int           // 视频宽度，默认 1920
+	Height         int           // 视频高度，默认 1080
+	FontName       string        // 字体，默认 sans-serif
+	FontSize       int           // 字号，默认为视频高度的 1/20
+	Opacity        float64       // 不透明度，0 到 1，默认 0.8
+	ScrollDuration time.Duration // 滚动弹幕从右到左经过屏幕的时间，越短越快，默认 8 秒
+	FixedDuration  time.Duration // 置顶弹幕没有置顶时长时显示的时间，默认 5 秒
+	ScrollArea     float64       // 滚动弹幕占屏幕高度的比例，0 到 1，默认 1
+	MaxOnScreen    int           // 同时显示的滚动弹幕最多条数，0 表示只受行数限制
+}
+
+const (
+	defaultWidth          = 1920
+	defaultHeight         = 1080
+	defaultFontName       = "sans-serif"
+	defaultOpacity        = 0.8
+	defaultScrollDuration = 8 * time.Second
+	defaultFixedDuration  = 5 * time.Second
+)
+
+// withDefaults 返回填充了默认值的参数
+func (o ASSOptions) withDefaults() ASSOptions {
+	if o.Width <= 0 || o.Height <= 0 {
+		o.Width, o.Height = defaultWidth, defaultHeight
+	}
+	if o.FontName == "" {
+		o.FontName = defaultFontName
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = max(o.Height/20, 1)
+	}
+	if o.Opacity <= 0 || o.Opacity > 1 {
+		o.Opacity = defaultOpacity
+	}
+	if o.ScrollDuration <= 0 {
+		o.ScrollDuration = defaultScrollDuration
+	}
+	if o.FixedDuration <= 0 {
+		o.FixedDuration = defaultFixedDuration
+	}
+	if o.ScrollArea <= 0 || o.ScrollArea > 1 {
+		o.ScrollArea = 1
+	}
+	return o
+}
+
+// ParseResolution 解析 "1280x720" 格式的分辨率，即 StreamInfo.Resolution
+func ParseResolution(s string) (width int, height int, err error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	if ok {
+		width, err = strconv.Atoi(w)
+		if err == nil {
+			height, err = strconv.Atoi(h)
+		}
+	}
+	if !ok || err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("无效的分辨率: %q，格式应为 宽x高，如 1920x1080", s)
+	}
+	return width, height, nil
+}
+
+// scrollLane 一行滚动弹幕中最后一条弹幕的位置
+type scrollLane struct {
+	start time.Duration
+	speed float64 // 每秒移动的像素
+	width float64
+}
+
+// accepts 判断从 start 开始、速度为 speed 的弹幕放在这一行时是否会与上一条重叠：
+// 出现时上一条的尾部已经完全进入屏幕，并且在上一条离开屏幕之前追不上它
+func (l *scrollLane) accepts(start time.Duration, speed float64, screenWidth float64, duration time.Duration) bool {
+	if l.speed == 0 {
+		return true
+	}
+
+	elapsed := (start - l.start).Seconds()
+	if l.speed*elapsed < l.width {
+		return false
+	}
+	remaining := (l.start + duration - start).Seconds()
+	return remaining <= 0 || speed*remaining <= screenWidth
+}
+
+// WriteASS 将弹幕转换为 ASS 字幕写入 w
+// 滚动弹幕分配到互不重叠的行中，没有空闲的行或超过 MaxOnScreen 时丢弃，返回丢弃的条数；
+// 置顶的弹幕固定在顶部居中显示 EndTimeInSeconds 秒
+func WriteASS(w io.Writer, messages []video.Message, options ASSOptions) (dropped int, err error) {
+	o := options.withDefaults()
+
+	sorted := make([]video.Message, len(messages))
+	copy(sorted, messages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].PlaybackTime != sorted[j].PlaybackTime {
+			return sorted[i].PlaybackTime < sorted[j].PlaybackTime
+		}
+		return sorted[i].SentAt.Before(sorted[j].SentAt)
+	})
+
+	bw := bufio.NewWriter(w)
+	writeASSHeader(bw, o)
+
+	lineHeight := float64(o.FontSize) * 1.2
+	screenWidth := float64(o.Width)
+	scrollLanes := make([]scrollLane, max(int(float64(o.Height)*o.ScrollArea/lineHeight), 1))
+	fixedLanes := make([]time.Duration, max(int(float64(o.Height)/lineHeight), 1)) // 每行置顶弹幕结束的时间
+	var onScreen []time.Duration                                                   // 正在显示的滚动弹幕结束的时间
+
+	for _, message := range sorted {
+		start := time.Duration(message.PlaybackTime) * time.Second
+		text := escapeASS(message.Message)
+
+		if message.Priority {
+			duration := o.FixedDuration
+			if message.EndTimeInSeconds != nil && *message.EndTimeInSeconds > 0 {
+				duration = time.Duration(*message.EndTimeInSeconds) * time.Second
+			}
+
+			// 置顶弹幕不丢弃，没有空闲的行时使用最早空出来的行
+			lane := 0
+			for i, end := range fixedLanes {
+				if end <= start {
+					lane = i
+					break
+				}
+				if end < fixedLanes[lane] {
+					lane = i
+				}
+			}
+			fixedLanes[lane] = start + duration
+
+			fmt.Fprintf(bw, "Dialogue: 3,%s,%s,Danmaku,,0,0,0,,{\\an8\\pos(%d,%d)}%s\n",
+				assTime(start), assTime(start+duration), o.Width/2, int(float64(lane)*lineHeight), text)
+			continue
+		}
+
+		// 去掉已经离开屏幕的弹幕
+		visible := onScreen[:0]
+		for _, end := range onScreen {
+			if end > start {
+				visible = append(visible, end)
+			}
+		}
+		onScreen = visible
+		if o.MaxOnScreen > 0 && len(onScreen) >= o.MaxOnScreen {
+			dropped++
+			continue
+		}
+
+		width := textWidth(message.Message, o.FontSize)
+		speed := (screenWidth + width) / o.ScrollDuration.Seconds()
+		lane := -1
+		for i := range scrollLanes {
+			if scrollLanes[i].accepts(start, speed, screenWidth, o.ScrollDuration) {
+				lane = i
+				break
+			}
+		}
+		if lane < 0 {
+			dropped++
+			continue
+		}
+		scrollLanes[lane] = scrollLane{start: start, speed: speed, width: width}
+		onScreen = append(onScreen, start+o.ScrollDuration)
+
+		y := int(float64(lane) * lineHeight)
+		fmt.Fprintf(bw, "Dialogue: 2,%s,%s,Danmaku,,0,0,0,,{\\move(%d,%d,%d,%d)}%s\n",
+			assTime(start), assTime(start+o.ScrollDuration), o.Width, y, -int(math.Ceil(width)), y, text)
+	}
+
+	return dropped, bw.Flush()
+}
+
+// writeASSHeader 写入 [Script Info] 和 [V4+ Styles]
+func writeASSHeader(w io.Writer, o ASSOptions) {
+	// ASS 的透明度 00 为不透明，FF 为完全透明
+	alpha := fmt.Sprintf("%02X", int(math.Round((1-o.Opacity)*255)))
+
+	fmt.Fprintf(w, "[Script Info]\n")
+	fmt.Fprintf(w, "; Generated by ncpd\n")
+	fmt.Fprintf(w, "ScriptType: v4.00+\n")
+	fmt.Fprintf(w, "PlayResX: %d\n", o.Width)
+	fmt.Fprintf(w, "PlayResY: %d\n", o.Height)
+	fmt.Fprintf(w, "WrapStyle: 2\n")
+	fmt.Fprintf(w, "ScaledBorderAndShadow: yes\n\n")
+
+	fmt.Fprintf(w, "[V4+ Styles]\n")
+	fmt.Fprintf(w, "Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, "+
+		"Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, "+
+		"Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	fmt.Fprintf(w, "Style: Danmaku,%s,%d,&H%sFFFFFF,&H%sFFFFFF,&H%s000000,&H%s000000,0,0,0,0,100,100,0,0,1,%d,0,7,0,0,0,1\n\n",
+		o.FontName, o.FontSize, alpha, alpha, alpha, alpha, max(o.FontSize/25, 1))
+
+	fmt.Fprintf(w, "[Events]\n")
+	fmt.Fprintf(w, "Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+}
+
+// textWidth 估算文字的宽度，半角字符按半个字号计算
+func textWidth(s string, fontSize int) float64 {
+	var width float64
+	for _, r := range s {
+		if r < 0x80 || (r >= 0xFF61 && r <= 0xFF9F) {
+			width += 0.5
+		} else {
+			width++
+		}
+	}
+	return width * float64(fontSize)
+}
+
+// assEscaper 转义 ASS 中有特殊含义的字符，反斜杠后插入零宽空格避免被当作命令，换行转换为空格使弹幕保持单行
+var assEscaper = strings.NewReplacer(
+	`\`, "\\\u200b",
+	"{", `\{`,
+	"}", `\}`,
+	"\r\n", " ",
+	"\n", " ",
+)
+
+// escapeASS 转义弹幕内容
+func escapeASS(s string) string {
+	return assEscaper.Replace(s)
+}
+
+// assTime 将时间格式化为 ASS 的 h:mm:ss.cc
+func assTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
@@ -0,0 +1,160 @@
+package danmaku
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ncpd/internal/video"
+)
+
+var dialoguePattern = regexp.MustCompile(`^Dialogue: (\d),([\d:.]+),([\d:.]+),Danmaku,,0,0,0,,\{(.*?)\}(.*)$`)
+
+type dialogue struct {
+	layer      int
+	start, end string
+	tags, text string
+}
+
+func parseDialogues(t *testing.T, ass string) []dialogue {
+	t.Helper()
+
+	var dialogues []dialogue
+	for _, line := range strings.Split(ass, "\n") {
+		if !strings.HasPrefix(line, "Dialogue:") {
+			continue
+		}
+		m := dialoguePattern.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("无效的 Dialogue: %s", line)
+		}
+		layer, _ := strconv.Atoi(m[1])
+		dialogues = append(dialogues, dialogue{layer: layer, start: m[2], end: m[3], tags: m[4], text: m[5]})
+	}
+	return dialogues
+}
+
+// go test -v ./internal/danmaku -run TestWriteASS
+func TestWriteASS(t *testing.T) {
+	pinned := 30
+	messages := []video.Message{
+		{Message: "一", PlaybackTime: 10},
+		{Message: "二", PlaybackTime: 10},
+		{Message: "お知らせ", PlaybackTime: 5, Priority: true, EndTimeInSeconds: &pinned},
+		{Message: "{\\pos(0,0)}", PlaybackTime: 3700},
+	}
+
+	var buf bytes.Buffer
+	dropped, err := WriteASS(&buf, messages, ASSOptions{Width: 1280, Height: 720, Opacity: 0.5})
+	if err != nil {
+		t.Fatalf("生成 ASS 失败: %v", err)
+	}
+	if dropped != 0 {
+		t.Errorf("不应丢弃弹幕，实际丢弃 %d 条", dropped)
+	}
+
+	ass := buf.String()
+	for _, expected := range []string{"PlayResX: 1280", "PlayResY: 720", "Style: Danmaku,sans-serif,36,&H80FFFFFF"} {
+		if !strings.Contains(ass, expected) {
+			t.Errorf("缺少 %q:\n%s", expected, ass)
+		}
+	}
+
+	dialogues := parseDialogues(t, ass)
+	if len(dialogues) != 4 {
+		t.Fatalf("期望 4 条弹幕，实际 %d 条", len(dialogues))
+	}
+
+	// 置顶弹幕固定在顶部，显示置顶时长
+	if d := dialogues[0]; d.layer != 3 || d.start != "0:00:05.00" || d.end != "0:00:35.00" || d.tags != `\an8\pos(640,0)` {
+		t.Errorf("置顶弹幕错误: %+v", d)
+	}
+
+	// 同时出现的滚动弹幕分配到不同的行，从右侧移动到左侧
+	if d := dialogues[1]; d.start != "0:00:10.00" || d.end != "0:00:18.00" || d.tags != `\move(1280,0,-36,0)` {
+		t.Errorf("第一条滚动弹幕错误: %+v", d)
+	}
+	if d := dialogues[2]; d.tags != `\move(1280,43,-36,43)` {
+		t.Errorf("第二条滚动弹幕应在第二行: %+v", d)
+	}
+
+	// 弹幕中的 ASS 命令被转义，超过一小时的时间正确格式化
+	if d := dialogues[3]; d.start != "1:01:40.00" || d.text != "\\{\\\u200bpos(0,0)\\}" {
+		t.Errorf("转义或时间错误: %+v", d)
+	}
+}
+
+func TestWriteASSLanes(t *testing.T) {
+	// 只有两行，同一秒的第三条弹幕没有空闲的行
+	messages := []video.Message{
+		{Message: "aaaa", PlaybackTime: 0},
+		{Message: "bbbb", PlaybackTime: 0},
+		{Message: "cccc", PlaybackTime: 0},
+		// 上一条的尾部已进入屏幕，而且追不上上一条
+		{Message: "dd", PlaybackTime: 2},
+	}
+	options := ASSOptions{Width: 400, Height: 100, FontSize: 40}
+
+	var buf bytes.Buffer
+	dropped, err := WriteASS(&buf, messages, options)
+	if err != nil {
+		t.Fatalf("生成 ASS 失败: %v", err)
+	}
+	if dropped != 1 {
+		t.Errorf("期望丢弃 1 条，实际 %d 条", dropped)
+	}
+	dialogues := parseDialogues(t, buf.String())
+	if len(dialogues) != 3 || dialogues[2].text != "dd" || dialogues[2].tags != `\move(400,0,-40,0)` {
+		t.Errorf("弹幕分配错误: %+v", dialogues)
+	}
+
+	// 限制同时显示的条数
+	options.MaxOnScreen = 1
+	buf.Reset()
+	if dropped, _ := WriteASS(&buf, messages, options); dropped != 3 {
+		t.Errorf("MaxOnScreen 为 1 时期望丢弃 3 条，实际 %d 条", dropped)
+	}
+
+	// Write 返回 ASS 格式丢弃的条数
+	buf.Reset()
+	if dropped, err := Write(&buf, FormatASS, messages, options); err != nil || dropped != 3 {
+		t.Errorf("Write 期望丢弃 3 条，实际 %d 条: %v", dropped, err)
+	}
+}
+
+// accepts 的边界：速度更快的弹幕会在上一条离开屏幕前追上它
+func TestScrollLaneAccepts(t *testing.T) {
+	lane := scrollLane{start: 0, speed: 100, width: 100}
+	duration := 5 * time.Second
+
+	tests := []struct {
+		start    time.Duration
+		speed    float64
+		expected bool
+	}{
+		{500 * time.Millisecond, 100, false}, // 尾部还没有进入屏幕
+		{time.Second, 100, true},
+		{time.Second, 200, false}, // 剩余 4 秒内会移动 800 像素，追上上一条
+		{3 * time.Second, 200, true},
+		{6 * time.Second, 1000, true}, // 上一条已经离开屏幕
+	}
+	for _, tt := range tests {
+		if got := lane.accepts(tt.start, tt.speed, 500, duration); got != tt.expected {
+			t.Errorf("start=%s speed=%g: 期望 %v，实际 %v", tt.start, tt.speed, tt.expected, got)
+		}
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	if w, h, err := ParseResolution("1280x720"); err != nil || w != 1280 || h != 720 {
+		t.Errorf("解析错误: %d %d %v", w, h, err)
+	}
+	for _, s := range []string{"", "1280", "x720", "0x720", "axb"} {
+		if _, _, err := ParseResolution(s); err == nil {
+			t.Errorf("%q 应返回错误", s)
+		}
+	}
+}
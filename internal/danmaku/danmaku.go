@@ -0,0 +1,90 @@
+package danmaku
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"ncpd/internal/video"
+)
+
+// Format 弹幕文件的格式
+type Format string
+
+const (
+	FormatJSON Format = "json" // 接口返回的原始数据
+	FormatXML  Format = "xml"  // niconico 的 <packet><chat> 格式
+	FormatASS  Format = "ass"  // 可以在 mpv、VLC 中直接加载的 ASS 字幕
+)
+
+// Formats 支持的所有格式
+var Formats = []Format{FormatJSON, FormatXML, FormatASS}
+
+// Ext 返回格式对应的文件扩展名
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// ParseFormats 解析逗号分隔的格式列表，如 "json,xml"
+func ParseFormats(s string) ([]Format, error) {
+	var formats []Format
+	seen := make(map[Format]bool)
+	for _, name := range strings.Split(s, ",") {
+		format := Format(strings.ToLower(strings.TrimSpace(name)))
+		if format == "" || seen[format] {
+			continue
+		}
+		if !isSupported(format) {
+			return nil, fmt.Errorf("不支持的弹幕格式: %s，可选 %s", format, formatList())
+		}
+		seen[format] = true
+		formats = append(formats, format)
+	}
+
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("需要指定弹幕格式，可选 %s", formatList())
+	}
+	return formats, nil
+}
+
+func isSupported(format Format) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func formatList() string {
+	names := make([]string, len(Formats))
+	for i, f := range Formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names, "、")
+}
+
+// Write 将弹幕按指定格式写入 w，assOptions 只用于 ASS 格式
+// 返回 ASS 格式中因为没有空闲的行而丢弃的条数，其它格式不会丢弃弹幕
+func Write(w io.Writer, format Format, messages []video.Message, assOptions ASSOptions) (dropped int, err error) {
+	switch format {
+	case FormatJSON:
+		return 0, writeJSON(w, messages)
+	case FormatXML:
+		return 0, WriteXML(w, messages)
+	case FormatASS:
+		return WriteASS(w, messages, assOptions)
+	default:
+		return 0, fmt.Errorf("不支持的弹幕格式: %s", format)
+	}
+}
+
+func writeJSON(w io.Writer, messages []video.Message) error {
+	data, err := json.MarshalIndent(messages, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
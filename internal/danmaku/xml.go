@@ -0,0 +1,76 @@
+package danmaku
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"ncpd/internal/video"
+)
+
+// niconico 弹幕的 premium 属性，3 表示频道主（运营）发送的弹幕
+const premiumOwner = 3
+
+type xmlPacket struct {
+	XMLName xml.Name  `xml:"packet"`
+	Chats   []xmlChat `xml:"chat"`
+}
+
+// xmlChat 一条 niconico 格式的弹幕
+type xmlChat struct {
+	Thread   string `xml:"thread,attr"`
+	No       int    `xml:"no,attr"`
+	Vpos     int    `xml:"vpos,attr"` // 弹幕出现的时间点，单位为 1/100 秒
+	Date     int64  `xml:"date,attr"`
+	DateUsec int    `xml:"date_usec,attr"`
+	UserID   string `xml:"user_id,attr"`
+	Mail     string `xml:"mail,attr,omitempty"` // 弹幕命令，如 "ue" 表示固定在顶部
+	Premium  int    `xml:"premium,attr,omitempty"`
+	Content  string `xml:",chardata"`
+}
+
+// WriteXML 将弹幕转换为 niconico 兼容的 XML 格式写入 w，弹幕按出现时间排序
+// 置顶的弹幕转换为固定在顶部的频道主弹幕，置顶时长转换为 @秒数 命令
+func WriteXML(w io.Writer, messages []video.Message) error {
+	sorted := make([]video.Message, len(messages))
+	copy(sorted, messages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].PlaybackTime != sorted[j].PlaybackTime {
+			return sorted[i].PlaybackTime < sorted[j].PlaybackTime
+		}
+		return sorted[i].SentAt.Before(sorted[j].SentAt)
+	})
+
+	packet := xmlPacket{Chats: make([]xmlChat, len(sorted))}
+	for i, message := range sorted {
+		chat := xmlChat{
+			Thread:   message.GroupID,
+			No:       i + 1,
+			Vpos:     message.PlaybackTime * 100,
+			Date:     message.SentAt.Unix(),
+			DateUsec: message.SentAt.Nanosecond() / 1000,
+			UserID:   message.SenderID,
+			Content:  message.Message,
+		}
+		if message.Priority {
+			chat.Mail = "ue"
+			if message.EndTimeInSeconds != nil && *message.EndTimeInSeconds > 0 {
+				chat.Mail += fmt.Sprintf(" @%d", *message.EndTimeInSeconds)
+			}
+			chat.Premium = premiumOwner
+		}
+		packet.Chats[i] = chat
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(packet); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,70 @@
+package danmaku
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"ncpd/internal/video"
+)
+
+// go test -v ./internal/danmaku -run TestWriteXML
+func TestWriteXML(t *testing.T) {
+	pinned := 30
+	sentAt := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+	messages := []video.Message{
+		{GroupID: "group", ID: "2", Message: "後", PlaybackTime: 90, SenderID: "user-b", SentAt: sentAt.Add(time.Minute)},
+		{GroupID: "group", ID: "1", Message: "<こんにちは> & 草", PlaybackTime: 12, SenderID: "user-a", SentAt: sentAt},
+		{GroupID: "group", ID: "3", Message: "お知らせ", PlaybackTime: 90, SenderID: "owner", SentAt: sentAt, Priority: true, EndTimeInSeconds: &pinned},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXML(&buf, messages); err != nil {
+		t.Fatalf("转换失败: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("缺少 XML 声明:\n%s", buf.String())
+	}
+
+	var packet xmlPacket
+	if err := xml.Unmarshal(buf.Bytes(), &packet); err != nil {
+		t.Fatalf("生成的 XML 无效: %v\n%s", err, buf.String())
+	}
+
+	expected := []xmlChat{
+		{Thread: "group", No: 1, Vpos: 1200, Date: sentAt.Unix(), DateUsec: 123456, UserID: "user-a", Content: "<こんにちは> & 草"},
+		{Thread: "group", No: 2, Vpos: 9000, Date: sentAt.Unix(), DateUsec: 123456, UserID: "owner", Mail: "ue @30", Premium: premiumOwner, Content: "お知らせ"},
+		{Thread: "group", No: 3, Vpos: 9000, Date: sentAt.Add(time.Minute).Unix(), DateUsec: 123456, UserID: "user-b", Content: "後"},
+	}
+	if len(packet.Chats) != len(expected) {
+		t.Fatalf("期望 %d 条弹幕，实际 %d 条", len(expected), len(packet.Chats))
+	}
+	for i, chat := range packet.Chats {
+		if chat != expected[i] {
+			t.Errorf("第 %d 条弹幕错误:\n期望 %+v\n实际 %+v", i+1, expected[i], chat)
+		}
+	}
+
+	// 不修改传入的弹幕顺序
+	if messages[0].ID != "2" {
+		t.Error("WriteXML 不应修改传入的切片")
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	formats, err := ParseFormats(" JSON, xml,json ")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(formats) != 2 || formats[0] != FormatJSON || formats[1] != FormatXML {
+		t.Errorf("解析结果错误: %v", formats)
+	}
+
+	for _, s := range []string{"", "srt", "json,srt"} {
+		if _, err := ParseFormats(s); err == nil {
+			t.Errorf("%q 应返回错误", s)
+		}
+	}
+}
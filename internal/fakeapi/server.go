@@ -0,0 +1,543 @@
+// Package fakeapi 提供用于离线测试的假 Nicochannel+ 服务器，
+// 包括站点设置、认证服务器、频道和视频 API、弹幕 API 以及 HLS 源站，API 响应来自 testdata 中记录的数据
+package fakeapi
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ncpd/config"
+	"ncpd/internal/client"
+)
+
+//go:embed testdata/*.json
+var testdata embed.FS
+
+// 记录的数据中的频道、视频和文章
+const (
+	SiteID         = 387
+	ChannelURL     = "https://nicochannel.jp/test-channel"
+	VideoCode      = "smTestVideo01"
+	CommentGroupID = "comment-group-01"
+	ArticleCode    = "arTestNews01"
+
+	LiveCode           = "smTestLive01"       // 正在直播的生放送，弹幕由 PostLiveMessage 添加
+	LiveCommentGroupID = "comment-group-live" // LiveCode 的弹幕群组
+
+	VideoCount    = 12  // 频道的视频数
+	CommentCount  = 144 // VideoCode 的弹幕数
+	ArticleCount  = 3   // 频道的文章数
+	SegmentCount  = 3   // 媒体播放列表的分片数
+	ClientID      = "fake-client-id"
+	SessionID     = "fake-session-id"
+	CommentsToken = "fake-comments-token"
+)
+
+// Server 假 Nicochannel+ 服务器
+// 站点在 /，认证服务器在 /auth，API 在 /fc，弹幕 API 在 /comments，HLS 源站在 /hls
+type Server struct {
+	*httptest.Server
+	Platform *client.Platform // 指向该服务器的平台
+
+	mu            sync.Mutex
+	refreshToken  string // 当前有效的 refresh token，每次刷新后轮换
+	accessToken   string // 当前有效的 access token
+	authCode      string
+	tokenRequests int
+
+	liveMessages  []json.RawMessage // LiveCode 当前的弹幕，按发送顺序
+	liveScheduled bool              // LiveCode 还没有开始
+	liveFinished  bool
+}
+
+// New 启动假服务器，测试结束时自动关闭
+func New(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		refreshToken: "fake-refresh-token-0",
+		accessToken:  "fake-access-token-0",
+		authCode:     "fake-auth-code",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /site/settings.json", s.handleSettings)
+	mux.HandleFunc("POST /auth/oauth/token", s.handleToken)
+	mux.HandleFunc("GET /fc/content_providers/channels", s.handleFixture("channels.json"))
+	mux.HandleFunc("GET /fc/content_providers/channel_domain", s.handleChannelDomain)
+	mux.HandleFunc("GET /fc/fanclub_sites/{siteID}/page_base_info", s.handleSite(s.handleFixture("page_base_info.json")))
+	mux.HandleFunc("GET /fc/v2/fanclub_sites/{siteID}/video_pages", s.handleSite(s.handleVideoPages))
+	mux.HandleFunc("GET /fc/video_pages/{code}", s.handleVideo(s.handleVideoPage))
+	mux.HandleFunc("GET /fc/video_pages/{code}/comments_user_token", s.handleVideo(s.handleCommentsToken))
+	mux.HandleFunc("POST /fc/video_pages/{code}/session_ids", s.handleVideo(s.requireToken(s.handleSessionID)))
+	mux.HandleFunc("GET /fc/fanclub_sites/{siteID}/article_themes/news/articles", s.handleSite(s.handleFixture("articles.json")))
+	mux.HandleFunc("GET /fc/fanclub_sites/{siteID}/article_themes/news/articles/{code}", s.handleSite(s.handleArticle))
+	mux.HandleFunc("POST /comments/messages.history", s.handleMessages)
+	mux.HandleFunc("GET /hls/index.m3u8", s.handleIndex)
+	mux.HandleFunc("GET /hls/{quality}/playlist.m3u8", s.handlePlaylist)
+	mux.HandleFunc("GET /hls/{quality}/{segment}", s.handleSegment)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	s.Platform = &client.Platform{
+		Name:                "Fake",
+		Key:                 "fake",
+		Domain:              "nicochannel.jp",
+		DefaultAPIBaseURL:   s.URL + "/fc",
+		TemplateFile:        "assets/template_white_bg.html",
+		GalleryTemplateFile: "assets/gallery_white_bg.html",
+		SiteURL:             s.URL,
+		AuthURL:             s.URL + "/auth",
+	}
+	return s
+}
+
+// Config 返回请求失败时不重试、不限流的配置，refresh token 为当前有效的 token
+func (s *Server) Config() *config.Config {
+	return &config.Config{
+		NicoClientID:     ClientID,
+		NicoRefreshToken: s.RefreshToken(),
+		APITimeout:       5 * time.Second,
+	}
+}
+
+// Client 返回访问该服务器的 Client，需要认证的请求使用当前有效的 access token
+func (s *Server) Client() *client.Client {
+	c := client.New(s.Platform, s.Config())
+	c.Tokens = staticToken(s.AccessToken())
+	return c
+}
+
+// CommentsURL 返回弹幕 API 的地址
+func (s *Server) CommentsURL() string {
+	return s.URL + "/comments"
+}
+
+// IndexURL 返回获取 index.m3u8 的地址
+func (s *Server) IndexURL() string {
+	return s.URL + "/hls/index.m3u8"
+}
+
+// RefreshToken 返回当前有效的 refresh token
+func (s *Server) RefreshToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshToken
+}
+
+// AccessToken 返回当前有效的 access token
+func (s *Server) AccessToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accessToken
+}
+
+// AuthCode 返回登录时使用的授权码
+func (s *Server) AuthCode() string {
+	return s.authCode
+}
+
+// TokenRequests 返回 /oauth/token 被请求的次数
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenRequests
+}
+
+// RevokeAccessToken 让当前的 access token 失效，模拟服务器提前吊销 token
+func (s *Server) RevokeAccessToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = "revoked"
+}
+
+// PostLiveMessage 在 LiveCode 的直播中发送一条弹幕
+func (s *Server) PostLiveMessage(id string, message string, playbackTime int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sentAt := time.Date(2024, 4, 1, 20, 0, 0, 0, time.UTC).Add(time.Duration(playbackTime) * time.Second)
+	raw, _ := json.Marshal(map[string]any{
+		"created_at":          sentAt,
+		"end_time_in_seconds": nil,
+		"group_id":            LiveCommentGroupID,
+		"id":                  id,
+		"mentions":            []any{},
+		"message":             message,
+		"nickname":            "viewer",
+		"playback_time":       playbackTime,
+		"priority":            false,
+		"sender_id":           "sender-live",
+		"sent_at":             sentAt,
+		"updated_at":          sentAt,
+	})
+	s.liveMessages = append(s.liveMessages, raw)
+}
+
+// DeleteLiveMessage 删除直播中的一条弹幕，模拟被管理员删除
+func (s *Server) DeleteLiveMessage(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, raw := range s.liveMessages {
+		var m struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(raw, &m) == nil && m.ID == id {
+			s.liveMessages = append(s.liveMessages[:i:i], s.liveMessages[i+1:]...)
+			return
+		}
+	}
+}
+
+// ScheduleLive 让 LiveCode 回到预定开始、还没有开始直播的状态
+func (s *Server) ScheduleLive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveScheduled = true
+}
+
+// StartLive 开始 LiveCode 的直播，New 创建的服务器中直播已经开始
+func (s *Server) StartLive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveScheduled = false
+}
+
+// FinishLive 结束 LiveCode 的直播，之后视频详情的 live_finished_at 不再为空
+func (s *Server) FinishLive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveFinished = true
+}
+
+// SegmentData 返回第 i 个分片的内容
+func SegmentData(i int) []byte {
+	return []byte(fmt.Sprintf("segment-%d;", i))
+}
+
+// staticToken 固定的 access token
+type staticToken string
+
+func (t staticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+func (t staticToken) Refresh(ctx context.Context, stale string) (string, error) {
+	return "", fmt.Errorf("fakeapi: 固定的 token 不能刷新")
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, client.SiteSettings{
+		PlatformID:     "fake",
+		FanclubSiteID:  "1",
+		FanclubGroupID: "1",
+		APIBaseURL:     s.URL + "/fc",
+	})
+}
+
+// handleToken 处理 refresh_token 和 authorization_code 两种授权，每次都会轮换 refresh token
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenRequests++
+
+	if r.FormValue("client_id") != ClientID {
+		writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	switch r.FormValue("grant_type") {
+	case "refresh_token":
+		if r.FormValue("refresh_token") != s.refreshToken {
+			writeError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+	case "authorization_code":
+		if r.FormValue("code") != s.authCode || r.FormValue("code_verifier") == "" {
+			writeError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	s.accessToken = fmt.Sprintf("fake-access-token-%d", s.tokenRequests)
+	s.refreshToken = fmt.Sprintf("fake-refresh-token-%d", s.tokenRequests)
+	writeJSON(w, map[string]any{
+		"access_token":  s.accessToken,
+		"refresh_token": s.refreshToken,
+		"expires_in":    3600,
+		"token_type":    "Bearer",
+	})
+}
+
+func (s *Server) handleChannelDomain(w http.ResponseWriter, r *http.Request) {
+	var channels struct {
+		Data struct {
+			ContentProviders []json.RawMessage `json:"content_providers"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(fixture("channels.json"), &channels); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	domain := r.URL.Query().Get("current_site_domain")
+	for _, provider := range channels.Data.ContentProviders {
+		var p struct {
+			Domain string `json:"domain"`
+		}
+		if json.Unmarshal(provider, &p) == nil && p.Domain == domain {
+			writeJSON(w, map[string]any{"data": map[string]any{"content_providers": provider}})
+			return
+		}
+	}
+	writeJSON(w, map[string]any{"data": map[string]any{"content_providers": nil}})
+}
+
+// handleVideoPages 按 per_page 和 page 分页返回视频列表
+func (s *Server) handleVideoPages(w http.ResponseWriter, r *http.Request) {
+	var pages struct {
+		Data struct {
+			VideoPages struct {
+				List  []json.RawMessage `json:"list"`
+				Total int               `json:"total"`
+			} `json:"video_pages"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(fixture("video_pages.json"), &pages); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	list := pages.Data.VideoPages.List
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if perPage <= 0 || page <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid page")
+		return
+	}
+
+	start := min((page-1)*perPage, len(list))
+	end := min(start+perPage, len(list))
+	pages.Data.VideoPages.List = list[start:end]
+	writeJSON(w, pages)
+}
+
+// handleVideoPage 返回视频详情，LiveCode 是以 VideoCode 为基础修改的生放送
+func (s *Server) handleVideoPage(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("code") != LiveCode {
+		s.handleFixture("video_page.json")(w, r)
+		return
+	}
+
+	var page map[string]any
+	json.Unmarshal(fixture("video_page.json"), &page)
+	details := page["data"].(map[string]any)["video_page"].(map[string]any)
+	details["content_code"] = LiveCode
+	details["title"] = "テスト生放送"
+	details["live_scheduled_start_at"] = "2024-04-01 20:00:00"
+	details["live_started_at"] = "2024-04-01 20:00:00"
+	details["video_comment_setting"] = map[string]any{"comment_group_id": LiveCommentGroupID}
+
+	s.mu.Lock()
+	if s.liveScheduled {
+		details["live_started_at"] = nil
+	}
+	if s.liveFinished {
+		details["live_finished_at"] = "2024-04-01 22:00:00"
+	}
+	s.mu.Unlock()
+	writeJSON(w, page)
+}
+
+func (s *Server) handleCommentsToken(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{"data": map[string]any{"access_token": CommentsToken}})
+}
+
+func (s *Server) handleSessionID(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{"data": map[string]any{"session_id": SessionID}})
+}
+
+// handleArticle 返回文章详情，没有 token 时会员限定的内容为空
+func (s *Server) handleArticle(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("code") != ArticleCode {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if !s.authorized(r) {
+		var article map[string]any
+		json.Unmarshal(fixture("article.json"), &article)
+		article["data"].(map[string]any)["article"].(map[string]any)["article"].(map[string]any)["contents"] = ""
+		writeJSON(w, article)
+		return
+	}
+	s.handleFixture("article.json")(w, r)
+}
+
+// handleMessages 返回 oldest_playback_time 及之后的最多 limit 条弹幕
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token   string `json:"token"`
+		GroupID string `json:"group_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token != CommentsToken {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	var raws []json.RawMessage
+	switch body.GroupID {
+	case CommentGroupID:
+		if err := json.Unmarshal(fixture("messages.json"), &raws); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case LiveCommentGroupID:
+		s.mu.Lock()
+		raws = append(raws, s.liveMessages...)
+		s.mu.Unlock()
+	}
+
+	type message struct {
+		PlaybackTime int `json:"playback_time"`
+		raw          json.RawMessage
+	}
+	var messages []message
+	for _, raw := range raws {
+		m := message{raw: raw}
+		json.Unmarshal(raw, &m)
+		messages = append(messages, m)
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].PlaybackTime < messages[j].PlaybackTime
+	})
+
+	oldest, _ := strconv.Atoi(r.URL.Query().Get("oldest_playback_time"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	result := []json.RawMessage{}
+	for _, m := range messages {
+		if m.PlaybackTime >= oldest && len(result) < limit {
+			result = append(result, m.raw)
+		}
+	}
+	writeJSON(w, result)
+}
+
+// handleIndex 返回包含两种画质的 index.m3u8
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("session_id") != SessionID {
+		writeError(w, http.StatusForbidden, "invalid session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	fmt.Fprint(w, "#EXTM3U\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360,FRAME-RATE=29.970\n"+
+		"360p/playlist.m3u8\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=4000000,RESOLUTION=1280x720,FRAME-RATE=29.970\n"+
+		"720p/playlist.m3u8\n")
+}
+
+// handlePlaylist 返回包含 SegmentCount 个分片的媒体播放列表
+func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:0\n")
+	for i := 0; i < SegmentCount; i++ {
+		fmt.Fprintf(&b, "#EXTINF:6.000,\nseg_%d.ts\n", i)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	fmt.Fprint(w, b.String())
+}
+
+func (s *Server) handleSegment(w http.ResponseWriter, r *http.Request) {
+	var i int
+	if _, err := fmt.Sscanf(r.PathValue("segment"), "seg_%d.ts", &i); err != nil || i < 0 || i >= SegmentCount {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	w.Write(SegmentData(i))
+}
+
+// handleFixture 返回记录的响应
+func (s *Server) handleFixture(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(fixture(name))
+	}
+}
+
+// handleSite 只接受记录的数据中的频道
+func (s *Server) handleSite(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("siteID") != strconv.Itoa(SiteID) {
+			writeError(w, http.StatusNotFound, "fanclub site not found")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleVideo 只接受记录的数据中的视频和 LiveCode
+func (s *Server) handleVideo(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if code := r.PathValue("code"); code != VideoCode && code != LiveCode {
+			writeError(w, http.StatusNotFound, "video not found")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireToken 需要有效的 access token，否则返回 401
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return r.Header.Get("Authorization") == "Bearer "+s.accessToken
+}
+
+// fixture 读取记录的响应
+func fixture(name string) []byte {
+	data, err := testdata.ReadFile("testdata/" + name)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
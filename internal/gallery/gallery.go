@@ -0,0 +1,210 @@
+package gallery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 生成的网站中的文件
+const (
+	IndexFile = "index.html" // 视频和生放送的列表
+	NewsFile  = "news.html"  // 新闻的列表
+	videosDir = "videos"     // 每个视频的页面
+)
+
+// indexPage 视频列表页的数据
+type indexPage struct {
+	Channel  string
+	Root     string // 到网站目录的相对路径
+	Videos   []videoCard
+	Lives    int
+	Articles int
+}
+
+// videoCard 视频列表中的一项
+type videoCard struct {
+	Title     string
+	Date      string
+	Live      bool
+	Page      string
+	Thumbnail string
+}
+
+// videoPage 视频页的数据
+type videoPage struct {
+	Channel     string
+	Root        string
+	Code        string
+	Title       string
+	Date        string
+	Description string
+	Live        bool
+	Source      string
+	Type        string
+	Thumbnail   string
+	Comments    []Comment
+}
+
+// newsPage 新闻列表页的数据
+type newsPage struct {
+	Channel  string
+	Root     string
+	Articles []articleLink
+}
+
+// articleLink 新闻列表中的一项
+type articleLink struct {
+	Title string
+	Date  string
+	Page  string
+}
+
+// Generate 使用 templateHTML 将频道的内容生成为 outDir 中的静态网站，返回无法读取弹幕的视频等警告
+//
+// templateHTML 中需要定义 index、video、news 三个模板，页面中使用相对路径引用频道目录中的文件，
+// 网站需要和频道目录放在一起浏览
+func Generate(ch *Channel, templateHTML string, outDir string) ([]string, error) {
+	tmpl, err := template.New("gallery").Parse(templateHTML)
+	if err != nil {
+		return nil, fmt.Errorf("解析网站模板失败: %w", err)
+	}
+	for _, name := range []string{"index", "video", "news"} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("网站模板中没有定义 %s", name)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(outDir, videosDir), 0755); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	// 从网站目录和视频页所在目录到频道目录的相对路径
+	root, err := relativeURL(outDir, ch.Dir)
+	if err != nil {
+		return nil, err
+	}
+	videoRoot := "../" + root
+
+	var warnings []string
+	index := indexPage{Channel: ch.Name, Articles: len(ch.Articles)}
+	used := make(map[string]bool)
+	for _, v := range ch.Videos {
+		page := pageName(v, used)
+		card := videoCard{Title: v.Title, Date: displayDate(v.Date), Live: v.Live, Page: videosDir + "/" + page}
+		if v.Thumbnail != "" {
+			card.Thumbnail = root + escapePath(v.Thumbnail)
+		}
+		index.Videos = append(index.Videos, card)
+		if v.Live {
+			index.Lives++
+		}
+
+		data := videoPage{
+			Channel:     ch.Name,
+			Root:        "../",
+			Code:        v.Code,
+			Title:       v.Title,
+			Date:        v.Date,
+			Description: v.Description,
+			Live:        v.Live,
+			Source:      videoRoot + escapePath(v.File),
+			Type:        "video/mp4",
+		}
+		if strings.EqualFold(path.Ext(v.File), ".ts") {
+			data.Type = "video/mp2t"
+		}
+		if v.Thumbnail != "" {
+			data.Thumbnail = videoRoot + escapePath(v.Thumbnail)
+		}
+		if v.Danmaku != "" {
+			comments, err := readComments(filepath.Join(ch.Dir, filepath.FromSlash(v.Danmaku)))
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("读取 %s 的弹幕失败: %v", v.Title, err))
+			}
+			data.Comments = comments
+		}
+		if err := render(tmpl, "video", data, filepath.Join(outDir, videosDir, page)); err != nil {
+			return warnings, err
+		}
+	}
+	if err := render(tmpl, "index", index, filepath.Join(outDir, IndexFile)); err != nil {
+		return warnings, err
+	}
+
+	news := newsPage{Channel: ch.Name}
+	for _, article := range ch.Articles {
+		news.Articles = append(news.Articles, articleLink{
+			Title: article.Title,
+			Date:  displayDate(article.Date),
+			Page:  root + escapePath(article.Page),
+		})
+	}
+	if err := render(tmpl, "news", news, filepath.Join(outDir, NewsFile)); err != nil {
+		return warnings, err
+	}
+	return warnings, nil
+}
+
+// render 执行模板并保存为 file
+func render(tmpl *template.Template, name string, data any, file string) error {
+	var b strings.Builder
+	if err := tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		return fmt.Errorf("生成 %s 失败: %w", filepath.Base(file), err)
+	}
+	if err := os.WriteFile(file, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("保存 %s 失败: %w", filepath.Base(file), err)
+	}
+	return nil
+}
+
+// pageName 返回视频页的文件名，使用视频代码，没有视频代码时使用视频文件路径的哈希
+func pageName(v Video, used map[string]bool) string {
+	name := v.Code
+	if name == "" || used[name] {
+		sum := sha256.Sum256([]byte(v.File))
+		name = hex.EncodeToString(sum[:6])
+	}
+	used[name] = true
+	return name + ".html"
+}
+
+// relativeURL 返回从 from 目录到 to 目录的相对 URL，以 / 结尾
+func relativeURL(from string, to string) (string, error) {
+	absFrom, err := filepath.Abs(from)
+	if err != nil {
+		return "", err
+	}
+	absTo, err := filepath.Abs(to)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absFrom, absTo)
+	if err != nil {
+		return "", fmt.Errorf("无法从 %s 引用频道目录 %s: %w", from, to, err)
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return escapePath(filepath.ToSlash(rel)) + "/", nil
+}
+
+// escapePath 转义以 / 分隔的路径中的每一级，文件名中可能有 #、? 和空格
+func escapePath(p string) string {
+	elements := strings.Split(p, "/")
+	for i, element := range elements {
+		elements[i] = url.PathEscape(element)
+	}
+	return strings.Join(elements, "/")
+}
+
+// displayDate 只保留日期部分
+func displayDate(date string) string {
+	day, _, _ := strings.Cut(date, " ")
+	return day
+}
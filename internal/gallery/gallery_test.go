@@ -0,0 +1,118 @@
+package gallery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ncpd/internal/archive"
+	"ncpd/internal/video"
+)
+
+// writeFile 在频道目录中创建文件
+func writeFile(t *testing.T, dir string, rel string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// go test -v ./internal/gallery
+func TestGallery(t *testing.T) {
+	dir := t.TempDir()
+
+	// 账本中记录的视频
+	details, _ := json.Marshal(video.VideoDetails{ContentCode: "sm1", Title: "テスト #1", DisplayDate: "2024-03-12 20:00:00", Description: "<p>説明</p>"})
+	messages, _ := json.Marshal([]video.Message{{Message: "二つ目", PlaybackTime: 5}, {Message: "</script>", PlaybackTime: 1}})
+	ledger, err := archive.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kind, rel := range map[archive.Kind]string{
+		archive.KindVideo:     "動画/テスト #1/テスト #1.ts",
+		archive.KindDetails:   "動画/テスト #1/video_details.json",
+		archive.KindThumbnail: "動画/テスト #1/thumbnail.jpg",
+		archive.KindDanmaku:   "動画/テスト #1/danmaku.json",
+	} {
+		content := "data"
+		switch kind {
+		case archive.KindDetails:
+			content = string(details)
+		case archive.KindDanmaku:
+			content = string(messages)
+		}
+		path := writeFile(t, dir, rel, content)
+		if _, err := ledger.Record(archive.Key{Platform: "qlover", FcSiteID: 1, Code: "sm1", Kind: kind}, "2024-03-12 20:00:00", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 使用账本之前下载的生放送和新闻，以及还没有下载完成的视频
+	writeFile(t, dir, "生放送/ライブ/ライブ.mp4", "data")
+	writeFile(t, dir, "生放送/ライブ/live_chat.jsonl", `{"message":"こんばんは","playback_time":3}`+"\n"+`{"message":`)
+	writeFile(t, dir, "NEWS/[2024-02-10] お知らせ/お知らせ.html", `<div class="Article"><div class="Title"><h6> お知らせ </h6></div><div class="PublishAt"><span>2024-02-10</span></div></div>`)
+	writeFile(t, dir, "動画/途中/途中.ts", "data")
+	writeFile(t, dir, "動画/途中/途中.download.json", "{}")
+
+	outDir := filepath.Join(dir, "site")
+	writeFile(t, outDir, "index.html", `<div class="Article"><div class="Title"><h6>生成的网站</h6></div></div>`)
+
+	ch, err := Scan(dir, outDir)
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if ch.Platform != "qlover" || len(ch.Videos) != 2 || len(ch.Articles) != 1 {
+		t.Fatalf("读取的内容错误: %+v", ch)
+	}
+	if v := ch.Videos[0]; v.Code != "sm1" || v.Description != "説明" || v.Danmaku == "" || v.Live {
+		t.Errorf("账本中的视频错误: %+v", v)
+	}
+	if v := ch.Videos[1]; v.Title != "ライブ" || !v.Live || v.Danmaku != "生放送/ライブ/live_chat.jsonl" {
+		t.Errorf("扫描到的生放送错误: %+v", v)
+	}
+	if a := ch.Articles[0]; a.Title != "お知らせ" || a.Date != "2024-02-10" {
+		t.Errorf("扫描到的新闻错误: %+v", a)
+	}
+
+	template, err := os.ReadFile("../../assets/gallery_white_bg.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := Generate(ch, string(template), outDir)
+	if err != nil || len(warnings) > 0 {
+		t.Fatalf("生成失败: %v %v", err, warnings)
+	}
+
+	read := func(rel string) string {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	index := read(IndexFile)
+	if !strings.Contains(index, `href="videos/sm1.html"`) || !strings.Contains(index, "%23") || strings.Index(index, "テスト #1") > strings.Index(index, "ライブ") {
+		t.Errorf("视频列表错误:\n%s", index)
+	}
+	page := read("videos/sm1.html")
+	if !strings.Contains(page, `src="../../%E5%8B%95%E7%94%BB/%E3%83%86%E3%82%B9%E3%83%88%20%231/`) {
+		t.Errorf("视频页中的视频路径错误:\n%s", page)
+	}
+	// .ts 在多数浏览器中无法播放，页面中需要有提示
+	if !strings.Contains(page, `type="video/mp2t"`) || !strings.Contains(page, `class="Notice"`) || !strings.Contains(page, "canPlayType") {
+		t.Errorf("视频页中没有无法播放时的提示:\n%s", page)
+	}
+	if strings.Contains(page, "</script>\"") || !strings.Contains(page, "二つ目") {
+		t.Errorf("视频页中的弹幕错误:\n%s", page)
+	}
+	if news := read(NewsFile); !strings.Contains(news, "お知らせ") || !strings.Contains(news, `href="../NEWS/`) {
+		t.Errorf("新闻列表错误:\n%s", news)
+	}
+}
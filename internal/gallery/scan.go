@@ -0,0 +1,362 @@
+// Package gallery 将频道目录中已经保存的视频、弹幕和新闻生成为可以离线浏览的静态网站
+package gallery
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"ncpd/internal/archive"
+	"ncpd/internal/hls"
+	"ncpd/internal/nfo"
+	"ncpd/internal/video"
+)
+
+// Video 频道目录中的一个视频，路径都相对于频道目录并使用 / 分隔
+type Video struct {
+	Code        string // 视频代码，没有记录时为空
+	Title       string
+	Date        string // 接口返回的 "2006-01-02 15:04:05" 格式
+	Description string // 纯文本的简介
+	Live        bool   // 是否为生放送アーカイブ
+	File        string // 视频文件
+	Thumbnail   string // 缩略图，没有时为空
+	Danmaku     string // JSON 数组或 JSON Lines 格式的弹幕，没有时为空
+}
+
+// Article 频道目录中的一篇新闻
+type Article struct {
+	Code  string // 文章代码，没有记录时为空
+	Title string
+	Date  string
+	Page  string // 新闻的 HTML
+}
+
+// Channel 频道目录中已经保存的内容，视频和新闻都按日期从新到旧排序
+type Channel struct {
+	Dir      string
+	Name     string
+	Platform string // 平台的 Key，账本中没有记录时为空
+	Videos   []Video
+	Articles []Article
+}
+
+// 默认模板下视频目录中相关文件的名称，用于没有账本记录的视频
+const (
+	detailsName   = "video_details.json"
+	thumbnailName = "thumbnail.jpg"
+	danmakuName   = "danmaku.json"
+	liveChatName  = "live_chat.jsonl"
+)
+
+// Scan 读取频道目录中的内容，skipDir 为不需要扫描的目录（如生成的网站）
+//
+// 先使用账本和同步记录中的信息，再扫描目录找出账本中没有记录的视频和新闻（如使用账本之前下载的内容）
+func Scan(dir string, skipDir string) (*Channel, error) {
+	ch := &Channel{Dir: dir, Name: filepath.Base(filepath.Clean(dir))}
+	var show nfo.TVShow
+	if data, err := os.ReadFile(filepath.Join(dir, nfo.ShowFile)); err == nil && xml.Unmarshal(data, &show) == nil && show.Title != "" {
+		ch.Name = show.Title
+	}
+
+	ledger, err := archive.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := archive.LoadSyncState(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	videos := make(map[string]*Video)     // 视频代码或视频文件 → 视频
+	articles := make(map[string]*Article) // 文章代码或 HTML 文件 → 文章
+	known := make(map[string]bool)        // 账本中记录的文件
+	getVideo := func(code string) *Video {
+		if videos[code] == nil {
+			videos[code] = &Video{Code: code}
+		}
+		return videos[code]
+	}
+
+	for _, entry := range ledger.Entries() {
+		if ch.Platform == "" {
+			ch.Platform = entry.Platform
+		}
+		if len(entry.Files) == 0 {
+			continue
+		}
+		for _, file := range entry.Files {
+			known[file.Path] = true
+		}
+		first := entry.Files[0].Path
+
+		switch entry.Kind {
+		case archive.KindVideo:
+			getVideo(entry.Code).File = first
+		case archive.KindThumbnail:
+			getVideo(entry.Code).Thumbnail = first
+		case archive.KindNFO:
+			// NFO 的缩略图在没有单独下载缩略图时使用
+			if v := getVideo(entry.Code); v.Thumbnail == "" && len(entry.Files) > 1 {
+				v.Thumbnail = entry.Files[1].Path
+			}
+		case archive.KindDanmaku:
+			for _, file := range entry.Files {
+				if path.Ext(file.Path) == ".json" {
+					getVideo(entry.Code).Danmaku = file.Path
+				}
+			}
+		case archive.KindLiveChat:
+			if v := getVideo(entry.Code); v.Danmaku == "" {
+				v.Danmaku = first
+			}
+		case archive.KindDetails:
+			if details, err := readDetails(filepath.Join(dir, filepath.FromSlash(first))); err == nil {
+				applyDetails(getVideo(entry.Code), details)
+			}
+		case archive.KindNews:
+			articles[entry.Code] = &Article{Code: entry.Code, Page: first}
+		}
+	}
+
+	// 扫描账本中没有记录的视频和新闻
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if skipDir != "" && sameDir(p, skipDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if known[rel] {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".ts", ".mp4":
+			scanVideo(dir, rel, videos)
+		case ".html":
+			if article := scanArticle(p); article != nil {
+				article.Page = rel
+				articles[rel] = article
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for code, v := range videos {
+		// 只保存了弹幕、缩略图等，没有视频文件的不显示
+		if v.File == "" {
+			continue
+		}
+		if item, ok := state.Videos[code]; ok {
+			if v.Title == "" {
+				v.Title = item.Title
+			}
+			if v.Date == "" {
+				v.Date = item.Date
+			}
+			v.Live = v.Live || item.Status == "archived"
+		}
+		if v.Title == "" {
+			v.Title = strings.TrimSuffix(path.Base(v.File), path.Ext(v.File))
+		}
+		ch.Videos = append(ch.Videos, *v)
+	}
+	for code, article := range articles {
+		if item, ok := state.Articles[code]; ok {
+			if article.Title == "" {
+				article.Title = item.Title
+			}
+			if article.Date == "" {
+				article.Date = item.Date
+			}
+		}
+		if article.Title == "" || article.Date == "" {
+			if scanned := scanArticle(filepath.Join(dir, filepath.FromSlash(article.Page))); scanned != nil {
+				article.Title = cmp.Or(article.Title, scanned.Title)
+				article.Date = cmp.Or(article.Date, scanned.Date)
+			}
+		}
+		if article.Title == "" {
+			article.Title = strings.TrimSuffix(path.Base(article.Page), ".html")
+		}
+		ch.Articles = append(ch.Articles, *article)
+	}
+
+	sort.Slice(ch.Videos, func(i, j int) bool {
+		a, b := ch.Videos[i], ch.Videos[j]
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+		return a.File < b.File
+	})
+	sort.Slice(ch.Articles, func(i, j int) bool {
+		a, b := ch.Articles[i], ch.Articles[j]
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+		return a.Page < b.Page
+	})
+	return ch, nil
+}
+
+// scanVideo 添加账本中没有记录的视频文件，使用同一目录中默认名称的视频详情、缩略图和弹幕
+func scanVideo(dir string, rel string, videos map[string]*Video) {
+	abs := filepath.Join(dir, filepath.FromSlash(rel))
+	saveDir, saveName := filepath.Split(abs)
+	saveName = strings.TrimSuffix(saveName, filepath.Ext(saveName))
+	// 还没有下载完成
+	if _, err := os.Stat(hls.JournalPath(saveDir, saveName)); err == nil {
+		return
+	}
+
+	v := &Video{File: rel, Live: strings.Contains("/"+rel, "/生放送/")}
+	if details, err := readDetails(filepath.Join(saveDir, detailsName)); err == nil && details.ContentCode != "" {
+		if existing, ok := videos[details.ContentCode]; ok {
+			// 账本中有这个视频的其它内容，但没有视频文件
+			if existing.File == "" {
+				existing.File = rel
+			}
+			return
+		}
+		v.Code = details.ContentCode
+		applyDetails(v, details)
+	}
+
+	relDir := path.Dir(rel)
+	if fileExists(filepath.Join(saveDir, thumbnailName)) {
+		v.Thumbnail = path.Join(relDir, thumbnailName)
+	}
+	for _, name := range []string{danmakuName, liveChatName} {
+		if fileExists(filepath.Join(saveDir, name)) {
+			v.Danmaku = path.Join(relDir, name)
+			break
+		}
+	}
+
+	key := v.Code
+	if key == "" {
+		key = rel
+	}
+	videos[key] = v
+}
+
+// scanArticle 读取新闻 HTML 中的标题和发布日期，不是新闻模板生成的 HTML 时返回 nil
+func scanArticle(p string) *Article {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	doc, err := goquery.NewDocumentFromReader(file)
+	if err != nil {
+		return nil
+	}
+	title := doc.Find(".Article .Title h6")
+	if title.Length() == 0 {
+		return nil
+	}
+	return &Article{
+		Title: strings.TrimSpace(title.Text()),
+		Date:  strings.TrimSpace(doc.Find(".Article .PublishAt span").Text()),
+	}
+}
+
+// readDetails 读取保存的视频详情
+func readDetails(p string) (*video.VideoDetails, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var details video.VideoDetails
+	if err := json.Unmarshal(data, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// applyDetails 使用视频详情中的标题、日期和简介
+func applyDetails(v *Video, details *video.VideoDetails) {
+	v.Title = details.Title
+	v.Date = details.DisplayDate
+	if v.Date == "" {
+		v.Date = details.ReleasedAt
+	}
+	v.Description = nfo.PlainText(details.Description)
+	v.Live = details.LiveStartedAt != nil ||
+		details.ActiveVideoFilename != nil && details.ActiveVideoFilename.VideoFilenameType != nil &&
+			details.ActiveVideoFilename.VideoFilenameType.Value == "archived"
+}
+
+// Comment 显示在视频上的一条弹幕
+type Comment struct {
+	Time int    `json:"t"` // 弹幕出现的时间点，单位秒
+	Text string `json:"m"`
+}
+
+// readComments 读取 JSON 数组（下载的弹幕）或 JSON Lines（直播中录制的弹幕）格式的弹幕，按时间排序
+func readComments(p string) ([]Comment, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []video.Message
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var message video.Message
+			// 录制中断时最后一行可能不完整
+			if json.Unmarshal(scanner.Bytes(), &message) == nil {
+				messages = append(messages, message)
+			}
+		}
+	}
+
+	comments := make([]Comment, 0, len(messages))
+	for _, m := range messages {
+		if m.Message != "" {
+			comments = append(comments, Comment{Time: m.PlaybackTime, Text: m.Message})
+		}
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].Time < comments[j].Time })
+	return comments, nil
+}
+
+// sameDir 判断两个路径是否为同一个目录
+func sameDir(a string, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -0,0 +1,62 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"ncpd/internal/m3u8"
+)
+
+// decryptSegment 根据分片的 #EXT-X-KEY 解密分片数据
+func decryptSegment(ctx context.Context, segment m3u8.Segment, data []byte, keys *keyCache) ([]byte, error) {
+	if segment.Key == nil {
+		return data, nil
+	}
+	if !segment.Key.IsIdentity() {
+		return nil, fmt.Errorf("%w: KEYFORMAT %s", ErrUnsupported, segment.Key.KeyFormat)
+	}
+
+	key, err := keys.get(ctx, segment.Key.URL)
+	if err != nil {
+		return nil, err
+	}
+	iv := segmentIV(segment.Key, segment.Sequence)
+
+	switch segment.Key.Method {
+	case "AES-128":
+		return decryptAES128(data, key, iv)
+	case "SAMPLE-AES":
+		return decryptSampleAES(data, key, iv)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, segment.Key.Method)
+	}
+}
+
+// decryptAES128 使用 AES-128-CBC 解密整个分片，并去除 PKCS#7 填充
+func decryptAES128(data []byte, key []byte, iv []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("密文长度 %d 不是 %d 的整数倍", len(data), aes.BlockSize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// 去除 PKCS#7 填充
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, fmt.Errorf("无效的填充，密钥可能不正确")
+	}
+	if !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("无效的填充，密钥可能不正确")
+	}
+
+	return plain[:len(plain)-padding], nil
+}
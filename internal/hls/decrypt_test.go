@@ -0,0 +1,180 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"ncpd/internal/m3u8"
+)
+
+// encryptAES128 使用 AES-128-CBC 和 PKCS#7 填充加密
+func encryptAES128(data, key, iv []byte) []byte {
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	plain := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, _ := aes.NewCipher(key)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+	return encrypted
+}
+
+func TestDecryptAES128(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := []byte("fedcba9876543210")
+	plain := []byte("segment data that is not block aligned")
+
+	decrypted, err := decryptAES128(encryptAES128(plain, key, iv), key, iv)
+	if err != nil {
+		t.Fatalf("解密失败: %v", err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Errorf("解密结果错误: %s", decrypted)
+	}
+
+	// 密钥错误时填充校验应失败
+	if _, err := decryptAES128(encryptAES128(plain, key, iv), []byte("wrong key 123456"), iv); err == nil {
+		t.Error("期望密钥错误时返回错误")
+	}
+}
+
+func TestSegmentIV(t *testing.T) {
+	explicit := &m3u8.Key{IV: bytes.Repeat([]byte{0x01}, 16)}
+	if !bytes.Equal(segmentIV(explicit, 5), explicit.IV) {
+		t.Error("应优先使用指定的 IV")
+	}
+
+	iv := segmentIV(&m3u8.Key{}, 0x0102)
+	expected := append(make([]byte, 14), 0x01, 0x02)
+	if !bytes.Equal(iv, expected) {
+		t.Errorf("媒体序列号 IV 错误: %x", iv)
+	}
+}
+
+// 同一个密钥只请求一次，等待慢的密钥时不阻塞其它密钥
+func TestKeyCache(t *testing.T) {
+	release := make(chan struct{})
+	var slowRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			slowRequests.Add(1)
+			<-release
+		}
+		w.Write(bytes.Repeat([]byte{0x01}, 16))
+	}))
+	defer server.Close()
+
+	keys := newKeyCache(New().Client)
+	ctx := context.Background()
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := keys.get(ctx, server.URL+"/slow")
+			results <- err
+		}()
+	}
+
+	if _, err := keys.get(ctx, server.URL+"/fast"); err != nil {
+		t.Fatalf("获取密钥失败: %v", err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("获取密钥失败: %v", err)
+		}
+	}
+	if n := slowRequests.Load(); n != 1 {
+		t.Errorf("同一个密钥应只请求一次，实际 %d 次", n)
+	}
+}
+
+// DRM 格式的密钥无法解密
+func TestDownloadDRM(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n"+
+			`#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key",KEYFORMAT="com.apple.streamingkeydelivery"`+"\n"+
+			"#EXTINF:6.0,\nseg_0.ts\n#EXT-X-ENDLIST\n")
+	}))
+	defer server.Close()
+
+	err := New().Download(context.Background(), server.URL+"/index.m3u8", t.TempDir(), "video")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("期望返回 ErrUnsupported，实际 %v", err)
+	}
+}
+
+// go test -v ./internal/hls -run TestDownloadEncrypted
+func TestDownloadEncrypted(t *testing.T) {
+	keys := map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("abcdef0123456789"),
+	}
+	explicitIV := []byte("fedcba9876543210")
+	segments := []string{"first segment", "second segment", "third segment", "fourth segment"}
+
+	var keyRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/key/", func(w http.ResponseWriter, r *http.Request) {
+		keyRequests.Add(1)
+		w.Write(keys[strings.TrimPrefix(r.URL.Path, "/key/")])
+	})
+	mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		// 前两个分片使用 k1 + 媒体序列号 IV，之后轮换为 k2 + 指定 IV
+		fmt.Fprintf(w, `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-KEY:METHOD=AES-128,URI="/key/k1"
+#EXTINF:6.0,
+seg_0.ts
+#EXTINF:6.0,
+seg_1.ts
+#EXT-X-KEY:METHOD=AES-128,URI="/key/k2",IV=0x%s
+#EXTINF:6.0,
+seg_2.ts
+#EXTINF:6.0,
+seg_3.ts
+#EXT-X-ENDLIST
+`, hex.EncodeToString(explicitIV))
+	})
+	for i, data := range segments {
+		key, iv := keys["k1"], segmentIV(&m3u8.Key{}, 10+i)
+		if i >= 2 {
+			key, iv = keys["k2"], explicitIV
+		}
+		encrypted := encryptAES128([]byte(data), key, iv)
+		mux.HandleFunc(fmt.Sprintf("/seg_%d.ts", i), func(w http.ResponseWriter, r *http.Request) {
+			w.Write(encrypted)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	saveDir := t.TempDir()
+	if err := New().Download(context.Background(), server.URL+"/playlist.m3u8", saveDir, "video"); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(saveDir, "video.ts"))
+	if err != nil {
+		t.Fatalf("读取输出文件失败: %v", err)
+	}
+	if string(data) != strings.Join(segments, "") {
+		t.Errorf("解密结果错误: %s", data)
+	}
+
+	// 每个密钥只应请求一次
+	if n := keyRequests.Load(); n != 2 {
+		t.Errorf("期望请求 2 次密钥，实际请求 %d 次", n)
+	}
+}
@@ -0,0 +1,331 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"ncpd/config"
+	"ncpd/internal/client"
+	"ncpd/internal/m3u8"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	// UserAgent 下载分片时使用的 User-Agent
+	UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36"
+
+	// DefaultConcurrency 默认的分片并发下载数
+	DefaultConcurrency = 8
+)
+
+// ErrUnsupported 表示内置下载器暂不支持的格式
+var ErrUnsupported = errors.New("hls: 暂不支持的格式")
+
+// ErrOutputExists 表示没有录制进度时输出文件已经存在，为避免覆盖已有的录制不会重新开始
+var ErrOutputExists = errors.New("hls: 输出文件已存在")
+
+// Downloader 下载 HLS 媒体播放列表中的所有分片，并合并为单个 .ts 文件
+type Downloader struct {
+	Client      *resty.Client // 用于获取播放列表的客户端
+	MediaClient *resty.Client // 用于下载分片的客户端
+	Concurrency int           // 分片并发下载数
+
+	// OnProgress 每完成一个分片时调用，可为空
+	OnProgress func(done, total int)
+	// OnResume 从上次中断处继续下载时调用，可为空
+	OnResume func(done, total int)
+	// OnLiveSegment 录制直播时每写入一个分片调用，参数为已录制的分片数和字节数，可为空
+	OnLiveSegment func(count int, bytes int64)
+	// OnLiveGap 录制直播时分片在下载前就离开了播放列表的滑动窗口时调用，参数为缺失的分片数，可为空
+	OnLiveGap func(missed int)
+}
+
+// New 创建使用默认配置的下载器，分片请求失败时按 .env 中的 API_RETRY_* 重试
+func New() *Downloader {
+	mediaClient := client.NewMediaClient(config.Load()).
+		SetHeader("User-Agent", UserAgent).
+		SetTimeout(2 * time.Minute)
+
+	return &Downloader{
+		Client:      client.Get(),
+		MediaClient: mediaClient,
+		Concurrency: DefaultConcurrency,
+	}
+}
+
+// Download 下载 playlistURL 对应的媒体播放列表，输出为 saveDir/saveName.ts
+// 下载进度会记录到 JournalPath(saveDir, saveName)，中断后再次调用会从缺失的分片继续下载
+// ctx 取消时停止下载，保存已完成的进度后返回 ctx.Err()
+func (d *Downloader) Download(ctx context.Context, playlistURL string, saveDir string, saveName string) error {
+	// 获取并解析媒体播放列表
+	resp, err := d.Client.R().SetContext(ctx).Get(playlistURL)
+	if err != nil {
+		return fmt.Errorf("获取播放列表失败: %w", err)
+	}
+
+	playlist, err := m3u8.ParseMediaPlaylist(resp.String(), playlistURL)
+	if err != nil {
+		return fmt.Errorf("解析播放列表失败: %w", err)
+	}
+
+	segments := playlist.Segments
+	if len(segments) == 0 {
+		return fmt.Errorf("播放列表中没有分片")
+	}
+	if err := checkSegments(segments); err != nil {
+		return err
+	}
+
+	// 分片先保存到临时目录，全部完成后再合并
+	segmentDir := filepath.Join(saveDir, saveName+".segments")
+	journalPath := JournalPath(saveDir, saveName)
+
+	// 读取上次的下载记录，播放列表一致时继续下载，否则重新开始
+	journal, err := loadJournal(journalPath)
+	if err != nil || journal == nil || !journal.matches(playlist) {
+		if err := os.RemoveAll(segmentDir); err != nil {
+			return fmt.Errorf("清理分片目录失败: %w", err)
+		}
+		journal = newJournal(playlistURL, resp.String(), playlist)
+	} else {
+		journal.verify(segmentDir)
+		journal.PlaylistURL = playlistURL
+		journal.Playlist = resp.String()
+		if d.OnResume != nil && len(journal.Segments) > 0 {
+			d.OnResume(len(journal.Segments), len(segments))
+		}
+	}
+
+	if err := os.MkdirAll(segmentDir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	if err := journal.save(journalPath); err != nil {
+		return fmt.Errorf("保存下载记录失败: %w", err)
+	}
+
+	err = d.downloadSegments(ctx, segments, journal, segmentDir, newKeyCache(d.Client), func() error {
+		return journal.save(journalPath)
+	})
+	if ctx.Err() != nil {
+		// 被取消时再保存一次进度，下次从未完成的分片继续
+		if err := journal.save(journalPath); err != nil {
+			return fmt.Errorf("保存下载记录失败: %w", err)
+		}
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	outputFile := filepath.Join(saveDir, saveName+".ts")
+	if err := mergeSegments(segmentDir, len(segments), outputFile); err != nil {
+		return fmt.Errorf("合并分片失败: %w", err)
+	}
+
+	if err := os.RemoveAll(segmentDir); err != nil {
+		return err
+	}
+	return os.Remove(journalPath)
+}
+
+// downloadSegments 并发下载记录中尚未完成的分片，每完成一个分片调用 checkpoint 保存进度
+// 任意分片失败或 ctx 取消时停止派发新任务并返回第一个错误
+func (d *Downloader) downloadSegments(ctx context.Context, segments []m3u8.Segment, journal *Journal, segmentDir string, keys *keyCache, checkpoint func() error) error {
+	concurrency := d.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	jobs := make(chan int)
+	stop := make(chan struct{})
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		done     = len(journal.Segments)
+		firstErr error
+		stopOnce sync.Once
+	)
+
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+		stopOnce.Do(func() { close(stop) })
+	}
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// 已有分片失败时跳过剩余任务
+				select {
+				case <-stop:
+					continue
+				default:
+				}
+
+				size, err := d.downloadSegment(ctx, segments[i], segmentPath(segmentDir, i), keys)
+
+				mu.Lock()
+				if err != nil && ctx.Err() != nil {
+					// 被取消导致的失败不算分片错误，未完成的分片留到下次下载
+					fail(ctx.Err())
+				} else if err != nil {
+					fail(fmt.Errorf("下载第 %d 个分片失败: %w", i+1, err))
+				} else {
+					journal.complete(i, size)
+					if err := checkpoint(); err != nil {
+						fail(fmt.Errorf("保存下载记录失败: %w", err))
+					}
+					done++
+					if d.OnProgress != nil {
+						d.OnProgress(done, len(segments))
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for _, i := range journal.pending() {
+		select {
+		case jobs <- i:
+		case <-stop:
+			break dispatch
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// downloadSegment 下载单个分片，先写入 .part 文件，完成后再重命名
+// 加密的分片需要完整读入内存解密后再写入
+// 返回写入的字节数
+func (d *Downloader) downloadSegment(ctx context.Context, segment m3u8.Segment, filePath string, keys *keyCache) (int64, error) {
+	body, err := d.openSegment(ctx, segment.URL)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	var reader io.Reader = body
+	if segment.Key != nil {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return 0, fmt.Errorf("读取分片失败: %w", err)
+		}
+		data, err = decryptSegment(ctx, segment, data, keys)
+		if err != nil {
+			return 0, fmt.Errorf("解密分片失败: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	partPath := filePath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return 0, fmt.Errorf("创建文件失败: %w", err)
+	}
+
+	size, err := io.Copy(file, reader)
+	if err != nil {
+		file.Close()
+		return 0, fmt.Errorf("写入文件失败: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("写入文件失败: %w", err)
+	}
+
+	return size, os.Rename(partPath, filePath)
+}
+
+// openSegment 请求分片，返回响应内容，调用方负责关闭
+func (d *Downloader) openSegment(ctx context.Context, segmentURL string) (io.ReadCloser, error) {
+	resp, err := d.MediaClient.R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		Get(segmentURL)
+	if err != nil {
+		return nil, err
+	}
+	body := resp.RawBody()
+
+	if resp.IsError() {
+		body.Close()
+		return nil, &client.HTTPError{
+			StatusCode: resp.StatusCode(),
+			StatusText: http.StatusText(resp.StatusCode()),
+			URL:        segmentURL,
+		}
+	}
+	return body, nil
+}
+
+// mergeSegments 按顺序将所有分片合并为一个文件
+func mergeSegments(segmentDir string, count int, outputFile string) error {
+	partPath := outputFile + ".part"
+	output, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		if err := appendFile(output, segmentPath(segmentDir, i)); err != nil {
+			output.Close()
+			return err
+		}
+	}
+
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(partPath, outputFile)
+}
+
+// appendFile 将 path 的内容追加写入 w
+func appendFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// segmentPath 返回第 i 个分片的保存路径
+func segmentPath(segmentDir string, i int) string {
+	return filepath.Join(segmentDir, fmt.Sprintf("%05d.ts", i))
+}
+
+// checkSegments 检查分片是否都可以由内置下载器处理：不支持 fMP4 和需要 DRM 的密钥
+func checkSegments(segments []m3u8.Segment) error {
+	for _, segment := range segments {
+		if segment.Map != nil {
+			return fmt.Errorf("%w: fMP4 (#EXT-X-MAP)", ErrUnsupported)
+		}
+		if segment.Key != nil && !segment.Key.IsIdentity() {
+			return fmt.Errorf("%w: KEYFORMAT %s", ErrUnsupported, segment.Key.KeyFormat)
+		}
+	}
+	return nil
+}
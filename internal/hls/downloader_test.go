@@ -0,0 +1,131 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestServer 创建一个提供媒体播放列表和分片的 HLS 源站
+func newTestServer(t *testing.T, segments []string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:6\n")
+		for i := range segments {
+			fmt.Fprintf(&b, "#EXTINF:6.000,\nseg_%d.ts\n", i)
+		}
+		b.WriteString("#EXT-X-ENDLIST\n")
+		w.Write([]byte(b.String()))
+	})
+	for i, data := range segments {
+		data := data
+		mux.HandleFunc(fmt.Sprintf("/stream/seg_%d.ts", i), func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(data))
+		})
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fastRetry 缩短测试中分片重试的等待时间，需要在 New 之前调用
+func fastRetry(t *testing.T) {
+	t.Setenv("API_RETRY_COUNT", "3")
+	t.Setenv("API_RETRY_WAIT", "1ms")
+	t.Setenv("API_RETRY_MAX_WAIT", "10ms")
+}
+
+// go test -v ./internal/hls
+func TestDownload(t *testing.T) {
+	segments := []string{"aaaa", "bbbb", "cccc", "dddd", "eeee"}
+	server := newTestServer(t, segments)
+
+	saveDir := t.TempDir()
+	d := New()
+	d.Concurrency = 2
+
+	var progress int
+	d.OnProgress = func(done, total int) {
+		progress = done
+	}
+
+	if err := d.Download(context.Background(), server.URL+"/stream/playlist.m3u8", saveDir, "video"); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(saveDir, "video.ts"))
+	if err != nil {
+		t.Fatalf("读取输出文件失败: %v", err)
+	}
+
+	if string(data) != strings.Join(segments, "") {
+		t.Errorf("合并结果错误: %s", data)
+	}
+	if progress != len(segments) {
+		t.Errorf("期望进度为 %d，实际为 %d", len(segments), progress)
+	}
+
+	// 临时分片目录应被删除
+	if _, err := os.Stat(filepath.Join(saveDir, "video.segments")); !os.IsNotExist(err) {
+		t.Errorf("分片目录未被清理")
+	}
+}
+
+func TestDownloadSegmentError(t *testing.T) {
+	server := newTestServer(t, []string{"aaaa"})
+
+	// 播放列表中引用了不存在的分片
+	mux := http.NewServeMux()
+	mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "#EXTM3U\n#EXTINF:6.0,\n%s/stream/seg_0.ts\n#EXTINF:6.0,\n%s/stream/missing.ts\n", server.URL, server.URL)
+	})
+	playlistServer := httptest.NewServer(mux)
+	defer playlistServer.Close()
+
+	saveDir := t.TempDir()
+	err := New().Download(context.Background(), playlistServer.URL+"/playlist.m3u8", saveDir, "video")
+	if err == nil {
+		t.Fatal("期望下载失败")
+	}
+
+	if _, err := os.Stat(filepath.Join(saveDir, "video.ts")); !os.IsNotExist(err) {
+		t.Errorf("下载失败时不应生成输出文件")
+	}
+}
+
+// 分片遇到临时错误时重试，不中断整个下载
+func TestDownloadSegmentRetry(t *testing.T) {
+	fastRetry(t)
+	var attempts atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.000,\nseg_0.ts\n#EXT-X-ENDLIST\n"))
+	})
+	mux.HandleFunc("/seg_0.ts", func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("aaaa"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	saveDir := t.TempDir()
+	if err := New().Download(context.Background(), server.URL+"/playlist.m3u8", saveDir, "video"); err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(saveDir, "video.ts")); string(data) != "aaaa" || attempts.Load() != 3 {
+		t.Errorf("期望重试后成功，请求 %d 次，结果 %q", attempts.Load(), data)
+	}
+}
@@ -0,0 +1,121 @@
+package hls
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ncpd/internal/m3u8"
+)
+
+// Journal 记录单个视频的下载进度，保存在输出文件旁边，用于中断后继续下载
+type Journal struct {
+	PlaylistURL  string        `json:"playlist_url"`
+	Playlist     string        `json:"playlist"`      // 媒体播放列表快照
+	Segments     map[int]int64 `json:"segments"`      // 已完成的分片序号 → 字节数
+	TotalBytes   int64         `json:"total_bytes"`   // 已完成分片的总字节数
+	SegmentCount int           `json:"segment_count"` // 分片总数
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// JournalPath 返回 saveDir/saveName 对应的下载记录文件路径
+func JournalPath(saveDir string, saveName string) string {
+	return filepath.Join(saveDir, saveName+".download.json")
+}
+
+// newJournal 为新的下载创建记录
+func newJournal(playlistURL string, content string, playlist *m3u8.MediaPlaylist) *Journal {
+	return &Journal{
+		PlaylistURL:  playlistURL,
+		Playlist:     content,
+		Segments:     make(map[int]int64),
+		SegmentCount: len(playlist.Segments),
+	}
+}
+
+// loadJournal 读取下载记录，文件不存在时返回 nil
+func loadJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var journal Journal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("下载记录已损坏: %w", err)
+	}
+	if journal.Segments == nil {
+		journal.Segments = make(map[int]int64)
+	}
+
+	return &journal, nil
+}
+
+// save 原子地写入下载记录
+func (j *Journal) save(path string) error {
+	j.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// matches 检查记录中的播放列表快照与新获取的播放列表是否为同一个视频
+// 分片地址中通常带有会话参数，因此只比较分片数量和时长
+func (j *Journal) matches(playlist *m3u8.MediaPlaylist) bool {
+	snapshot, err := m3u8.ParseMediaPlaylist(j.Playlist, j.PlaylistURL)
+	if err != nil || len(snapshot.Segments) != len(playlist.Segments) {
+		return false
+	}
+
+	for i, segment := range snapshot.Segments {
+		if segment.Duration != playlist.Segments[i].Duration {
+			return false
+		}
+	}
+	return true
+}
+
+// verify 检查已完成的分片文件是否存在且大小与记录一致，不一致的分片需要重新下载
+func (j *Journal) verify(segmentDir string) {
+	for i, size := range j.Segments {
+		info, err := os.Stat(segmentPath(segmentDir, i))
+		if err != nil || info.Size() != size {
+			j.TotalBytes -= size
+			delete(j.Segments, i)
+		}
+	}
+}
+
+// complete 记录第 i 个分片已完成
+func (j *Journal) complete(i int, size int64) {
+	if old, ok := j.Segments[i]; ok {
+		j.TotalBytes -= old
+	}
+	j.Segments[i] = size
+	j.TotalBytes += size
+}
+
+// pending 返回尚未完成的分片序号
+func (j *Journal) pending() []int {
+	var pending []int
+	for i := 0; i < j.SegmentCount; i++ {
+		if _, ok := j.Segments[i]; !ok {
+			pending = append(pending, i)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,181 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"ncpd/internal/m3u8"
+)
+
+// go test -v ./internal/hls -run TestDownloadResume
+func TestDownloadResume(t *testing.T) {
+	fastRetry(t)
+	segments := []string{"aaaa", "bbbb", "cccc", "dddd", "eeee"}
+
+	var (
+		mu       sync.Mutex
+		requests = make(map[int]int)
+		failing  = true // 第一次下载时第 4 个分片失败
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:6\n")
+		for i := range segments {
+			fmt.Fprintf(&b, "#EXTINF:6.000,\nseg_%d.ts\n", i)
+		}
+		b.WriteString("#EXT-X-ENDLIST\n")
+		w.Write([]byte(b.String()))
+	})
+	for i, data := range segments {
+		i, data := i, data
+		mux.HandleFunc(fmt.Sprintf("/seg_%d.ts", i), func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[i]++
+			fail := failing && i == 3
+			mu.Unlock()
+
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(data))
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	saveDir := t.TempDir()
+	d := New()
+	d.Concurrency = 1
+
+	// 第一次下载失败，下载记录和已完成的分片应保留
+	if err := d.Download(context.Background(), server.URL+"/playlist.m3u8", saveDir, "video"); err == nil {
+		t.Fatal("期望第一次下载失败")
+	}
+
+	journal, err := loadJournal(JournalPath(saveDir, "video"))
+	if err != nil || journal == nil {
+		t.Fatalf("下载记录未保存: %v", err)
+	}
+	if len(journal.Segments) != 3 || journal.TotalBytes != 12 {
+		t.Fatalf("下载记录错误: %+v", journal.Segments)
+	}
+
+	// 破坏第 2 个分片，继续下载时应按大小校验并重新下载
+	if err := os.WriteFile(segmentPath(filepath.Join(saveDir, "video.segments"), 1), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+
+	var resumed int
+	d.OnResume = func(done, total int) {
+		resumed = done
+	}
+	if err := d.Download(context.Background(), server.URL+"/playlist.m3u8", saveDir, "video"); err != nil {
+		t.Fatalf("继续下载失败: %v", err)
+	}
+
+	if resumed != 2 {
+		t.Errorf("期望从 2 个已完成的分片继续，实际为 %d", resumed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(saveDir, "video.ts"))
+	if err != nil {
+		t.Fatalf("读取输出文件失败: %v", err)
+	}
+	if string(data) != strings.Join(segments, "") {
+		t.Errorf("合并结果错误: %s", data)
+	}
+
+	// 已完成且完好的分片不应重复下载
+	mu.Lock()
+	defer mu.Unlock()
+	// 第 4 个分片第一次下载时重试了 3 次
+	if requests[0] != 1 || requests[2] != 1 || requests[1] != 2 || requests[3] != 5 || requests[4] != 1 {
+		t.Errorf("分片请求次数错误: %v", requests)
+	}
+
+	if _, err := os.Stat(JournalPath(saveDir, "video")); !os.IsNotExist(err) {
+		t.Errorf("下载完成后应删除下载记录")
+	}
+}
+
+// go test -v ./internal/hls -run TestDownloadCancel
+func TestDownloadCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#EXTM3U\n#EXTINF:6.0,\nseg_0.ts\n#EXTINF:6.0,\nseg_1.ts\n#EXTINF:6.0,\nseg_2.ts\n#EXT-X-ENDLIST\n"))
+	})
+	mux.HandleFunc("/seg_0.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("aaaa"))
+	})
+	// 下载第 2 个分片时取消，请求一直等到被中断
+	mux.HandleFunc("/seg_1.ts", func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	saveDir := t.TempDir()
+	d := New()
+	d.Concurrency = 1
+
+	err := d.Download(ctx, server.URL+"/playlist.m3u8", saveDir, "video")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望返回 context.Canceled，实际 %v", err)
+	}
+
+	// 已完成的分片应保存在下载记录中
+	journal, err := loadJournal(JournalPath(saveDir, "video"))
+	if err != nil || journal == nil {
+		t.Fatalf("下载记录未保存: %v", err)
+	}
+	if len(journal.Segments) != 1 || journal.TotalBytes != 4 {
+		t.Errorf("下载记录错误: %+v", journal.Segments)
+	}
+}
+
+func TestJournalMatches(t *testing.T) {
+	content := "#EXTM3U\n#EXTINF:6.0,\na.ts\n#EXTINF:4.0,\nb.ts\n"
+	playlistURL := "https://example.com/playlist.m3u8?session=1"
+
+	journal := &Journal{PlaylistURL: playlistURL, Playlist: content}
+
+	// 会话参数不同但分片相同
+	same := "#EXTM3U\n#EXTINF:6.0,\na.ts?token=2\n#EXTINF:4.0,\nb.ts?token=2\n"
+	if !journal.matches(mustParseMedia(t, same)) {
+		t.Error("分片相同时应视为同一个视频")
+	}
+
+	different := "#EXTM3U\n#EXTINF:6.0,\na.ts\n"
+	if journal.matches(mustParseMedia(t, different)) {
+		t.Error("分片数量不同时不应视为同一个视频")
+	}
+}
+
+func mustParseMedia(t *testing.T, content string) *m3u8.MediaPlaylist {
+	t.Helper()
+
+	playlist, err := m3u8.ParseMediaPlaylist(content, "https://example.com/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("解析播放列表失败: %v", err)
+	}
+	return playlist
+}
@@ -0,0 +1,90 @@
+package hls
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"ncpd/internal/m3u8"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// keyCache 缓存已获取的解密密钥，同一个 URI 的密钥只请求一次
+// 密钥轮换时 #EXT-X-KEY 的 URI 会改变，此时会请求新的密钥
+type keyCache struct {
+	client *resty.Client
+
+	mu   sync.Mutex
+	keys map[string]*keyEntry
+}
+
+// keyEntry 一个 URI 的密钥，done 关闭后 key 和 err 可用
+type keyEntry struct {
+	done chan struct{}
+	key  []byte
+	err  error
+}
+
+func newKeyCache(client *resty.Client) *keyCache {
+	return &keyCache{
+		client: client,
+		keys:   make(map[string]*keyEntry),
+	}
+}
+
+// get 返回 keyURL 对应的密钥，缓存中没有时请求并缓存
+// 同一个 URI 同时只有一个请求，其它分片等待它的结果，不同 URI 的请求互不阻塞；请求失败时不缓存，之后重新请求
+func (c *keyCache) get(ctx context.Context, keyURL string) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.keys[keyURL]
+	if !ok {
+		entry = &keyEntry{done: make(chan struct{})}
+		c.keys[keyURL] = entry
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		entry.key, entry.err = c.fetch(ctx, keyURL)
+		if entry.err != nil {
+			c.mu.Lock()
+			delete(c.keys, keyURL)
+			c.mu.Unlock()
+		}
+		close(entry.done)
+	}
+
+	select {
+	case <-entry.done:
+		return entry.key, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch 请求 keyURL 对应的密钥
+func (c *keyCache) fetch(ctx context.Context, keyURL string) ([]byte, error) {
+	resp, err := c.client.R().SetContext(ctx).Get(keyURL)
+	if err != nil {
+		return nil, fmt.Errorf("获取密钥失败: %w", err)
+	}
+
+	key := resp.Body()
+	if len(key) != 16 {
+		return nil, fmt.Errorf("密钥长度应为 16 字节，实际为 %d 字节", len(key))
+	}
+	return key, nil
+}
+
+// segmentIV 返回分片的 IV：优先使用 #EXT-X-KEY 中指定的 IV，
+// 否则使用分片的媒体序列号（128 位大端整数）
+func segmentIV(key *m3u8.Key, sequence int) []byte {
+	if key.IV != nil {
+		return key.IV
+	}
+
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+	return iv
+}
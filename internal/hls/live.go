@@ -0,0 +1,280 @@
+package hls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ncpd/internal/client"
+	"ncpd/internal/m3u8"
+)
+
+const (
+	// defaultTargetDuration 播放列表没有 #EXT-X-TARGETDURATION 时使用的重新加载间隔
+	defaultTargetDuration = 6 * time.Second
+	// liveStallReloads 连续多少次重新加载没有新分片时检查直播是否已经结束
+	liveStallReloads = 6
+	// maxLiveFailures 连续失败超过该次数时停止录制
+	maxLiveFailures = 5
+)
+
+// LiveSource 直播的媒体播放列表
+type LiveSource struct {
+	// PlaylistURL 返回媒体播放列表的地址，session 过期导致请求被拒绝时会再次调用获取新的地址
+	PlaylistURL func(ctx context.Context) (string, error)
+	// Finished 播放列表长时间没有新分片时调用，返回直播是否已经结束，可为空
+	Finished func(ctx context.Context) (bool, error)
+	// ReloadInterval 重新加载播放列表的间隔，默认使用 #EXT-X-TARGETDURATION，没有新分片时减半
+	ReloadInterval time.Duration
+}
+
+// liveState 直播录制的进度，保存在输出文件旁边，中断后再次录制时从下一个分片继续追加
+type liveState struct {
+	LastSequence int       `json:"last_sequence"` // 最后写入的分片的媒体序列号，-1 表示还没有写入
+	Segments     int       `json:"segments"`      // 已写入的分片数
+	Bytes        int64     `json:"bytes"`         // 已写入输出文件的字节数
+	Missed       int       `json:"missed"`        // 离开滑动窗口而缺失的分片数
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// LiveStatePath 返回 saveDir/saveName 对应的直播录制进度文件路径，文件存在时表示录制尚未完成
+func LiveStatePath(saveDir string, saveName string) string {
+	return filepath.Join(saveDir, saveName+".live.json")
+}
+
+// loadLiveState 读取录制进度，文件不存在时返回 nil
+func loadLiveState(path string) (*liveState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state liveState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("录制进度已损坏: %w", err)
+	}
+	return &state, nil
+}
+
+// save 原子地写入录制进度
+func (s *liveState) save(path string) error {
+	s.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// RecordLive 录制直播，按媒体序列号依次下载滑动播放列表中的新分片，追加写入 saveDir/saveName.ts
+// 播放列表出现 #EXT-X-ENDLIST 或 source.Finished 返回直播已结束时完成录制
+// 录制进度记录到 LiveStatePath(saveDir, saveName)，中断后再次调用会从下一个分片继续，已经离开滑动窗口的分片无法补录
+// ctx 取消时保存进度后返回 ctx.Err()
+func (d *Downloader) RecordLive(ctx context.Context, source LiveSource, saveDir string, saveName string) error {
+	outputPath := filepath.Join(saveDir, saveName+".ts")
+	statePath := LiveStatePath(saveDir, saveName)
+
+	// 进度不存在或已损坏时重新开始，但不覆盖已经存在的文件
+	flag := os.O_CREATE | os.O_WRONLY
+	state, err := loadLiveState(statePath)
+	if err != nil || state == nil {
+		state = &liveState{LastSequence: -1}
+		flag |= os.O_EXCL
+	}
+
+	output, err := os.OpenFile(outputPath, flag, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s 已存在且没有录制进度，请先移动或删除该文件", ErrOutputExists, outputPath)
+	}
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %w", err)
+	}
+	defer output.Close()
+
+	// 丢弃上次中断时写了一半的分片
+	if err := output.Truncate(state.Bytes); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := state.save(statePath); err != nil {
+		return fmt.Errorf("保存录制进度失败: %w", err)
+	}
+
+	playlistURL, err := source.PlaylistURL(ctx)
+	if err != nil {
+		return fmt.Errorf("获取播放列表地址失败: %w", err)
+	}
+
+	keys := newKeyCache(d.Client)
+	failures, idle := 0, 0
+	for {
+		playlist, err := d.getLivePlaylist(ctx, playlistURL)
+		written := 0
+		if err == nil {
+			written, err = d.recordLiveSegments(ctx, playlist, state, output, statePath, keys)
+		}
+
+		if errors.Is(err, ErrUnsupported) {
+			return err
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failures++
+			if failures > maxLiveFailures {
+				return err
+			}
+			// session 过期时获取新的播放列表地址，分片和密钥的地址也会随之更新
+			if isAuthError(err) {
+				if newURL, err := source.PlaylistURL(ctx); err == nil {
+					playlistURL = newURL
+				}
+			}
+		} else {
+			failures = 0
+			if playlist.EndList {
+				break
+			}
+		}
+
+		if written > 0 {
+			idle = 0
+		} else {
+			idle++
+		}
+		if idle >= liveStallReloads && source.Finished != nil {
+			idle = 0
+			if finished, err := source.Finished(ctx); err == nil && finished {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(liveReloadInterval(source, playlist, written > 0)):
+		}
+	}
+
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if state.Segments == 0 {
+		os.Remove(outputPath)
+		os.Remove(statePath)
+		return fmt.Errorf("直播已结束，没有录制到任何分片")
+	}
+	return os.Remove(statePath)
+}
+
+// getLivePlaylist 获取并解析直播的媒体播放列表
+func (d *Downloader) getLivePlaylist(ctx context.Context, playlistURL string) (*m3u8.MediaPlaylist, error) {
+	resp, err := d.Client.R().SetContext(ctx).Get(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("获取播放列表失败: %w", err)
+	}
+
+	playlist, err := m3u8.ParseMediaPlaylist(resp.String(), playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("解析播放列表失败: %w", err)
+	}
+	if err := checkSegments(playlist.Segments); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// recordLiveSegments 按顺序下载播放列表中媒体序列号大于 state.LastSequence 的分片并写入 output，
+// 每写入一个分片保存一次进度，返回本次写入的分片数
+func (d *Downloader) recordLiveSegments(ctx context.Context, playlist *m3u8.MediaPlaylist, state *liveState, output io.WriterAt, statePath string, keys *keyCache) (int, error) {
+	written := 0
+	for _, segment := range playlist.Segments {
+		if segment.Sequence <= state.LastSequence {
+			continue
+		}
+
+		// 重新加载得太慢，或者中断的时间太长，中间的分片已经不在播放列表中
+		if state.LastSequence >= 0 && segment.Sequence > state.LastSequence+1 {
+			missed := segment.Sequence - state.LastSequence - 1
+			state.Missed += missed
+			if d.OnLiveGap != nil {
+				d.OnLiveGap(missed)
+			}
+		}
+
+		data, err := d.readSegment(ctx, segment, keys)
+		if err != nil {
+			return written, fmt.Errorf("下载分片 %d 失败: %w", segment.Sequence, err)
+		}
+
+		// 按进度中的位置写入，写入失败后重试时会覆盖不完整的数据
+		if _, err := output.WriteAt(data, state.Bytes); err != nil {
+			return written, fmt.Errorf("写入文件失败: %w", err)
+		}
+		state.LastSequence = segment.Sequence
+		state.Segments++
+		state.Bytes += int64(len(data))
+		if err := state.save(statePath); err != nil {
+			return written, fmt.Errorf("保存录制进度失败: %w", err)
+		}
+
+		written++
+		if d.OnLiveSegment != nil {
+			d.OnLiveSegment(state.Segments, state.Bytes)
+		}
+	}
+	return written, nil
+}
+
+// readSegment 下载并解密单个分片
+func (d *Downloader) readSegment(ctx context.Context, segment m3u8.Segment, keys *keyCache) ([]byte, error) {
+	body, err := d.openSegment(ctx, segment.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("读取分片失败: %w", err)
+	}
+	return decryptSegment(ctx, segment, data, keys)
+}
+
+// liveReloadInterval 返回下一次重新加载播放列表前等待的时间，播放列表没有变化时等待一半的时间
+func liveReloadInterval(source LiveSource, playlist *m3u8.MediaPlaylist, changed bool) time.Duration {
+	interval := source.ReloadInterval
+	if interval <= 0 {
+		interval = defaultTargetDuration
+		if playlist != nil && playlist.TargetDuration > 0 {
+			interval = time.Duration(playlist.TargetDuration) * time.Second
+		}
+	}
+	if !changed {
+		interval /= 2
+	}
+	return interval
+}
+
+// isAuthError 判断是否为 session 过期导致的请求被拒绝
+func isAuthError(err error) bool {
+	var httpErr *client.HTTPError
+	return errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden)
+}
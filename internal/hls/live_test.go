@@ -0,0 +1,239 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// liveServer 模拟直播的 HLS 源站，每次成功获取播放列表后滑动窗口前进 step 个分片
+type liveServer struct {
+	*httptest.Server
+	total  int // 直播结束时的分片总数
+	window int // 播放列表中的分片数
+	step   int
+
+	mu        sync.Mutex
+	start     int    // 当前窗口中第一个分片的媒体序列号
+	session   string // 当前有效的 session
+	endList   bool   // 最后一个分片出现后是否添加 #EXT-X-ENDLIST
+	playlists int    // 成功获取播放列表的次数
+}
+
+func newLiveServer(t *testing.T, total int, window int, step int) *liveServer {
+	t.Helper()
+
+	s := &liveServer{total: total, window: window, step: step, session: "s1", endList: true}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live/playlist.m3u8", s.handlePlaylist)
+	mux.HandleFunc("/live/{segment}", func(w http.ResponseWriter, r *http.Request) {
+		if !s.valid(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var i int
+		fmt.Sscanf(r.PathValue("segment"), "seg_%d.ts", &i)
+		fmt.Fprintf(w, "seg-%d;", i)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *liveServer) valid(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return r.URL.Query().Get("session") == s.session
+}
+
+func (s *liveServer) handlePlaylist(w http.ResponseWriter, r *http.Request) {
+	if !s.valid(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := min(s.start+s.window, s.total)
+	fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:%d\n", s.start)
+	for i := s.start; i < end; i++ {
+		fmt.Fprintf(w, "#EXTINF:2.000,\nseg_%d.ts?session=%s\n", i, s.session)
+	}
+	if end == s.total && s.endList {
+		fmt.Fprintf(w, "#EXT-X-ENDLIST\n")
+	}
+
+	s.playlists++
+	if end < s.total {
+		s.start = min(s.start+s.step, s.total-s.window)
+	}
+}
+
+// expire 让当前的 session 失效，之后需要使用 newSession 返回的 session
+func (s *liveServer) expire(newSession string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = newSession
+}
+
+// go test -v ./internal/hls -run TestRecordLive
+func TestRecordLive(t *testing.T) {
+	server := newLiveServer(t, 8, 3, 1)
+	saveDir := t.TempDir()
+
+	// 第二次获取播放列表后 session 过期
+	var urlCalls int
+	source := LiveSource{
+		PlaylistURL: func(ctx context.Context) (string, error) {
+			urlCalls++
+			return fmt.Sprintf("%s/live/playlist.m3u8?session=s%d", server.URL, urlCalls), nil
+		},
+		ReloadInterval: 10 * time.Millisecond,
+	}
+
+	d := New()
+	var count int
+	d.OnLiveSegment = func(n int, bytes int64) {
+		count = n
+		if n == 2 {
+			server.expire("s2")
+		}
+	}
+	d.OnLiveGap = func(missed int) {
+		t.Errorf("不应缺失分片，实际缺失 %d 个", missed)
+	}
+
+	if err := d.RecordLive(context.Background(), source, saveDir, "live"); err != nil {
+		t.Fatalf("录制失败: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(saveDir, "live.ts"))
+	if err != nil {
+		t.Fatalf("读取输出文件失败: %v", err)
+	}
+	var expected strings.Builder
+	for i := 0; i < 8; i++ {
+		fmt.Fprintf(&expected, "seg-%d;", i)
+	}
+	if string(data) != expected.String() {
+		t.Errorf("录制结果错误: %s", data)
+	}
+	if count != 8 {
+		t.Errorf("期望录制 8 个分片，实际 %d 个", count)
+	}
+	if urlCalls != 2 {
+		t.Errorf("session 过期后应重新获取播放列表地址，实际获取 %d 次", urlCalls)
+	}
+	if _, err := os.Stat(LiveStatePath(saveDir, "live")); !os.IsNotExist(err) {
+		t.Error("录制完成后应删除录制进度")
+	}
+}
+
+// 从上次中断处继续，窗口前进太快时记录缺失的分片，没有 #EXT-X-ENDLIST 时由 Finished 判断直播结束
+func TestRecordLiveResume(t *testing.T) {
+	server := newLiveServer(t, 8, 2, 3)
+	server.endList = false
+	saveDir := t.TempDir()
+
+	// 上次中断时已写入第 0 个分片，第 1 个分片只写了一半
+	state := &liveState{LastSequence: 0, Segments: 1, Bytes: int64(len("seg-0;"))}
+	if err := state.save(LiveStatePath(saveDir, "live")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(saveDir, "live.ts"), []byte("seg-0;se"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var finishedCalls int
+	source := LiveSource{
+		PlaylistURL: func(ctx context.Context) (string, error) {
+			return server.URL + "/live/playlist.m3u8?session=s1", nil
+		},
+		Finished: func(ctx context.Context) (bool, error) {
+			finishedCalls++
+			return true, nil
+		},
+		ReloadInterval: 10 * time.Millisecond,
+	}
+
+	d := New()
+	var missed int
+	d.OnLiveGap = func(n int) {
+		missed += n
+	}
+	if err := d.RecordLive(context.Background(), source, saveDir, "live"); err != nil {
+		t.Fatalf("录制失败: %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(saveDir, "live.ts"))
+	if string(data) != "seg-0;seg-1;seg-3;seg-4;seg-6;seg-7;" {
+		t.Errorf("录制结果错误: %s", data)
+	}
+	if missed != 2 {
+		t.Errorf("期望缺失 2 个分片，实际 %d 个", missed)
+	}
+	if finishedCalls != 1 {
+		t.Errorf("期望检查 1 次直播是否结束，实际 %d 次", finishedCalls)
+	}
+}
+
+func TestRecordLiveCancel(t *testing.T) {
+	server := newLiveServer(t, 100, 3, 0)
+	saveDir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	source := LiveSource{
+		PlaylistURL: func(ctx context.Context) (string, error) {
+			return server.URL + "/live/playlist.m3u8?session=s1", nil
+		},
+		ReloadInterval: 10 * time.Millisecond,
+	}
+	d := New()
+	d.OnLiveSegment = func(n int, bytes int64) {
+		if n == 3 {
+			cancel()
+		}
+	}
+
+	if err := d.RecordLive(ctx, source, saveDir, "live"); err != context.Canceled {
+		t.Fatalf("期望返回 context.Canceled，实际 %v", err)
+	}
+	state, err := loadLiveState(LiveStatePath(saveDir, "live"))
+	if err != nil || state == nil || state.LastSequence != 2 || state.Bytes != int64(len("seg-0;seg-1;seg-2;")) {
+		t.Errorf("中断后应保存录制进度: %+v %v", state, err)
+	}
+}
+
+// 没有录制进度时不覆盖已经存在的文件
+func TestRecordLiveExistingOutput(t *testing.T) {
+	saveDir := t.TempDir()
+	outputPath := filepath.Join(saveDir, "live.ts")
+	if err := os.WriteFile(outputPath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := LiveSource{
+		PlaylistURL: func(ctx context.Context) (string, error) {
+			t.Error("不应开始录制")
+			return "", context.Canceled
+		},
+	}
+	if err := New().RecordLive(context.Background(), source, saveDir, "live"); !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("期望返回 ErrOutputExists，实际 %v", err)
+	}
+	if data, _ := os.ReadFile(outputPath); string(data) != "old" {
+		t.Errorf("已有的文件被修改: %q", data)
+	}
+	if _, err := os.Stat(LiveStatePath(saveDir, "live")); !os.IsNotExist(err) {
+		t.Error("不应创建录制进度")
+	}
+}
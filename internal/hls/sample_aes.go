@@ -0,0 +1,562 @@
+package hls
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// SAMPLE-AES 解密，参考 Apple "MPEG-2 Stream Encryption Format for HTTP Live Streaming"
+// 只加密了 H.264 的 slice NAL 单元和 AAC 的 ADTS 帧，TS/PES 结构本身是明文
+// H.264 解密时需要先去掉防竞争字节（emulation prevention bytes），解密后再重新插入，
+// 因此 PES 长度可能变化，需要重新分配到原来的 TS 包中
+
+const (
+	tsPacketSize  = 188
+	tsPayloadSize = 184
+)
+
+// sampleAESStreamTypes 加密流的 stream_type 与解密后标准 stream_type 的对应关系
+var sampleAESStreamTypes = map[byte]byte{
+	0xdb: 0x1b, // H.264
+	0xcf: 0x0f, // AAC (ADTS)
+}
+
+// sampleAESUnsupportedTypes 暂不支持解密的加密流
+var sampleAESUnsupportedTypes = map[byte]string{
+	0xc1: "AC-3",
+	0xc2: "E-AC-3",
+}
+
+// pesUnit 表示一个 PES 包，以及承载它的 TS 包序号
+type pesUnit struct {
+	pid        uint16
+	streamType byte
+	packets    []int
+}
+
+// decryptSampleAES 解密 SAMPLE-AES 加密的 MPEG-TS 分片
+func decryptSampleAES(data []byte, key []byte, iv []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return nil, fmt.Errorf("分片长度 %d 不是有效的 MPEG-TS", len(data))
+	}
+
+	packets := make([][]byte, 0, len(data)/tsPacketSize)
+	for i := 0; i < len(data); i += tsPacketSize {
+		packet := data[i : i+tsPacketSize]
+		if packet[0] != 0x47 {
+			return nil, fmt.Errorf("第 %d 个 TS 包的同步字节错误", len(packets)+1)
+		}
+		packets = append(packets, packet)
+	}
+
+	pmtPIDs, streamTypes, err := parseProgramTables(packets)
+	if err != nil {
+		return nil, err
+	}
+	for _, streamType := range streamTypes {
+		if name, ok := sampleAESUnsupportedTypes[streamType]; ok {
+			return nil, fmt.Errorf("%w: SAMPLE-AES %s", ErrUnsupported, name)
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解密每个 PES，并记录替换后的 TS 包
+	replaced := make(map[int][]byte)
+	extra := make(map[int][][]byte) // PES 变长时追加在最后一个 TS 包之后的新包
+	for _, unit := range collectPESUnits(packets, streamTypes) {
+		var pes []byte
+		for _, idx := range unit.packets {
+			pes = append(pes, packets[idx][payloadOffset(packets[idx]):]...)
+		}
+
+		newPES, err := decryptPES(pes, unit.streamType, block, iv)
+		if err != nil {
+			return nil, fmt.Errorf("PID 0x%x: %w", unit.pid, err)
+		}
+
+		newPackets, err := repacketize(packets, unit.packets, newPES)
+		if err != nil {
+			return nil, fmt.Errorf("PID 0x%x: %w", unit.pid, err)
+		}
+
+		for j, idx := range unit.packets {
+			replaced[idx] = newPackets[j]
+		}
+		if len(newPackets) > len(unit.packets) {
+			extra[unit.packets[len(unit.packets)-1]] = newPackets[len(unit.packets):]
+		}
+	}
+
+	// 输出，插入新包的 PID 之后的连续计数器需要顺延
+	out := make([]byte, 0, len(data))
+	ccOffset := make(map[uint16]byte)
+	for i, packet := range packets {
+		if newPacket, ok := replaced[i]; ok {
+			packet = newPacket
+		}
+		if pmtPIDs[packetPID(packet)] {
+			packet = rewritePMT(packet)
+		}
+		out = append(out, shiftContinuity(packet, ccOffset[packetPID(packet)])...)
+
+		for _, extraPacket := range extra[i] {
+			pid := packetPID(extraPacket)
+			out = append(out, shiftContinuity(extraPacket, ccOffset[pid])...)
+			ccOffset[pid]++
+		}
+	}
+
+	return out, nil
+}
+
+// packetPID 返回 TS 包的 PID
+func packetPID(packet []byte) uint16 {
+	return binary.BigEndian.Uint16(packet[1:3]) & 0x1fff
+}
+
+// payloadStart 返回 TS 包是否设置了 payload_unit_start_indicator
+func payloadStart(packet []byte) bool {
+	return packet[1]&0x40 != 0
+}
+
+// hasPayload 返回 TS 包是否带有负载
+func hasPayload(packet []byte) bool {
+	return packet[3]&0x10 != 0
+}
+
+// payloadOffset 返回 TS 包负载的起始位置，没有负载时返回包长度
+func payloadOffset(packet []byte) int {
+	if !hasPayload(packet) {
+		return tsPacketSize
+	}
+	if packet[3]&0x20 == 0 {
+		return 4
+	}
+	offset := 5 + int(packet[4])
+	if offset > tsPacketSize {
+		return tsPacketSize
+	}
+	return offset
+}
+
+// shiftContinuity 将带负载的 TS 包的 continuity_counter 增加 offset
+func shiftContinuity(packet []byte, offset byte) []byte {
+	if offset == 0 || !hasPayload(packet) {
+		return packet
+	}
+	shifted := append([]byte(nil), packet...)
+	shifted[3] = shifted[3]&0xf0 | (shifted[3]+offset)&0x0f
+	return shifted
+}
+
+// psiSection 返回 TS 包中 PSI 表（PAT/PMT）的范围，表跨包时返回 false
+func psiSection(packet []byte, tableID byte) (int, int, bool) {
+	if !payloadStart(packet) || !hasPayload(packet) {
+		return 0, 0, false
+	}
+	offset := payloadOffset(packet)
+	if offset >= tsPacketSize {
+		return 0, 0, false
+	}
+	start := offset + 1 + int(packet[offset]) // 跳过 pointer_field
+	if start+3 > tsPacketSize || packet[start] != tableID {
+		return 0, 0, false
+	}
+	sectionLength := int(binary.BigEndian.Uint16(packet[start+1:start+3]) & 0x0fff)
+	end := start + 3 + sectionLength
+	if end > tsPacketSize || sectionLength < 9 {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// parseProgramTables 解析 PAT 和 PMT，返回 PMT 的 PID 集合和各 PID 的 stream_type
+func parseProgramTables(packets [][]byte) (map[uint16]bool, map[uint16]byte, error) {
+	pmtPIDs := make(map[uint16]bool)
+	for _, packet := range packets {
+		if packetPID(packet) != 0 {
+			continue
+		}
+		start, end, ok := psiSection(packet, 0x00)
+		if !ok {
+			continue
+		}
+		for i := start + 8; i+4 <= end-4; i += 4 {
+			programNumber := binary.BigEndian.Uint16(packet[i : i+2])
+			if programNumber != 0 {
+				pmtPIDs[binary.BigEndian.Uint16(packet[i+2:i+4])&0x1fff] = true
+			}
+		}
+		break
+	}
+	if len(pmtPIDs) == 0 {
+		return nil, nil, fmt.Errorf("分片中没有 PAT")
+	}
+
+	streamTypes := make(map[uint16]byte)
+	for _, packet := range packets {
+		if !pmtPIDs[packetPID(packet)] {
+			continue
+		}
+		start, end, ok := psiSection(packet, 0x02)
+		if !ok {
+			continue
+		}
+		programInfoLength := int(binary.BigEndian.Uint16(packet[start+10:start+12]) & 0x0fff)
+		for i := start + 12 + programInfoLength; i+5 <= end-4; {
+			pid := binary.BigEndian.Uint16(packet[i+1:i+3]) & 0x1fff
+			streamTypes[pid] = packet[i]
+			i += 5 + int(binary.BigEndian.Uint16(packet[i+3:i+5])&0x0fff)
+		}
+	}
+	if len(streamTypes) == 0 {
+		return nil, nil, fmt.Errorf("分片中没有 PMT")
+	}
+
+	return pmtPIDs, streamTypes, nil
+}
+
+// rewritePMT 将 PMT 中加密流的 stream_type 改回标准值，并重新计算 CRC
+func rewritePMT(packet []byte) []byte {
+	start, end, ok := psiSection(packet, 0x02)
+	if !ok {
+		return packet
+	}
+
+	rewritten := append([]byte(nil), packet...)
+	programInfoLength := int(binary.BigEndian.Uint16(rewritten[start+10:start+12]) & 0x0fff)
+	for i := start + 12 + programInfoLength; i+5 <= end-4; {
+		if clearType, ok := sampleAESStreamTypes[rewritten[i]]; ok {
+			rewritten[i] = clearType
+		}
+		i += 5 + int(binary.BigEndian.Uint16(rewritten[i+3:i+5])&0x0fff)
+	}
+	binary.BigEndian.PutUint32(rewritten[end-4:end], crc32MPEG2(rewritten[start:end-4]))
+
+	return rewritten
+}
+
+// crc32MPEG2 计算 PSI 表使用的 CRC-32/MPEG-2
+func crc32MPEG2(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// collectPESUnits 收集加密流中所有完整的 PES 包
+// 分片开头不以 payload_unit_start_indicator 开始的残缺 PES 无法解密，保持原样
+func collectPESUnits(packets [][]byte, streamTypes map[uint16]byte) []*pesUnit {
+	var units []*pesUnit
+	current := make(map[uint16]*pesUnit)
+
+	for i, packet := range packets {
+		pid := packetPID(packet)
+		streamType, ok := streamTypes[pid]
+		if !ok || !hasPayload(packet) || payloadOffset(packet) >= tsPacketSize {
+			continue
+		}
+		if _, encrypted := sampleAESStreamTypes[streamType]; !encrypted {
+			continue
+		}
+
+		if payloadStart(packet) {
+			unit := &pesUnit{pid: pid, streamType: streamType}
+			units = append(units, unit)
+			current[pid] = unit
+		}
+		if unit := current[pid]; unit != nil {
+			unit.packets = append(unit.packets, i)
+		}
+	}
+
+	return units
+}
+
+// decryptPES 解密 PES 包中的基本流数据
+func decryptPES(pes []byte, streamType byte, block cipher.Block, iv []byte) ([]byte, error) {
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return nil, fmt.Errorf("无效的 PES 头")
+	}
+	headerLength := 9 + int(pes[8])
+	if headerLength > len(pes) {
+		return nil, fmt.Errorf("无效的 PES 头长度")
+	}
+
+	var es []byte
+	var err error
+	switch streamType {
+	case 0xdb:
+		es = decryptH264(pes[headerLength:], block, iv)
+	case 0xcf:
+		es, err = decryptADTS(pes[headerLength:], block, iv)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	newPES := append(append([]byte(nil), pes[:headerLength]...), es...)
+
+	// PES_packet_length 不为 0 时需要更新
+	if binary.BigEndian.Uint16(newPES[4:6]) != 0 {
+		length := len(newPES) - 6
+		if length > 0xffff {
+			length = 0
+		}
+		binary.BigEndian.PutUint16(newPES[4:6], uint16(length))
+	}
+
+	return newPES, nil
+}
+
+// decryptH264 解密 Annex B 格式的 H.264 基本流
+// 只有长度大于 48 字节的 slice NAL 单元（类型 1 和 5）被加密
+func decryptH264(es []byte, block cipher.Block, iv []byte) []byte {
+	out := make([]byte, 0, len(es)+16)
+
+	prev := 0 // 尚未输出的数据起点
+	for pos := 0; ; {
+		start := findStartCode(es, pos)
+		if start == -1 {
+			break
+		}
+		nalStart := start + 3
+		next := findStartCode(es, nalStart)
+		nalEnd := len(es)
+		if next != -1 {
+			nalEnd = next
+		}
+		// 4 字节起始码的前导 0 以及 trailing_zero_8bits 不属于 NAL 单元
+		for nalEnd > nalStart && es[nalEnd-1] == 0 {
+			nalEnd--
+		}
+
+		nal := es[nalStart:nalEnd]
+		out = append(out, es[prev:nalStart]...)
+		if len(nal) > 48 && (nal[0]&0x1f == 1 || nal[0]&0x1f == 5) {
+			raw := removeEmulationPrevention(nal)
+			decryptNALPattern(raw[32:], block, iv)
+			out = append(out, addEmulationPrevention(raw)...)
+		} else {
+			out = append(out, nal...)
+		}
+		prev = nalEnd
+
+		if next == -1 {
+			break
+		}
+		pos = next
+	}
+
+	return append(out, es[prev:]...)
+}
+
+// findStartCode 查找从 from 开始的第一个 00 00 01 起始码
+func findStartCode(data []byte, from int) int {
+	for i := from; i+2 < len(data); i++ {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// decryptNALPattern 按 1:9 的模式解密：每 16 字节加密块之后最多跟 144 字节明文
+// 同一个 NAL 单元内的加密块共用一个 CBC 链，剩余不足 16 字节（含恰好 16 字节）时不加密
+func decryptNALPattern(data []byte, block cipher.Block, iv []byte) {
+	mode := cipher.NewCBCDecrypter(block, iv)
+	for pos := 0; pos < len(data); {
+		if len(data)-pos > aes.BlockSize {
+			mode.CryptBlocks(data[pos:pos+aes.BlockSize], data[pos:pos+aes.BlockSize])
+			pos += aes.BlockSize
+		}
+		pos += min(144, len(data)-pos)
+	}
+}
+
+// removeEmulationPrevention 去掉 NAL 单元中的防竞争字节（00 00 03 中的 03）
+func removeEmulationPrevention(nal []byte) []byte {
+	raw := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		raw = append(raw, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return raw
+}
+
+// addEmulationPrevention 在 00 00 后跟 00~03 的位置插入防竞争字节
+func addEmulationPrevention(raw []byte) []byte {
+	nal := make([]byte, 0, len(raw)+len(raw)/64)
+	zeros := 0
+	for _, b := range raw {
+		if zeros >= 2 && b <= 3 {
+			nal = append(nal, 3)
+			zeros = 0
+		}
+		nal = append(nal, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return nal
+}
+
+// decryptADTS 解密 ADTS 格式的 AAC 基本流
+// 每帧的 ADTS 头和之后 16 字节为明文，其余完整的 16 字节块加密，每帧重新使用 IV
+func decryptADTS(es []byte, block cipher.Block, iv []byte) ([]byte, error) {
+	out := append([]byte(nil), es...)
+
+	for pos := 0; pos < len(out); {
+		if pos+7 > len(out) || out[pos] != 0xff || out[pos+1]&0xf0 != 0xf0 {
+			return nil, fmt.Errorf("无效的 ADTS 帧")
+		}
+
+		headerLength := 7
+		if out[pos+1]&0x01 == 0 {
+			headerLength = 9 // 带 CRC
+		}
+		frameLength := int(out[pos+3]&0x03)<<11 | int(out[pos+4])<<3 | int(out[pos+5])>>5
+		if frameLength < headerLength || pos+frameLength > len(out) {
+			return nil, fmt.Errorf("无效的 ADTS 帧长度 %d", frameLength)
+		}
+
+		encrypted := out[pos+headerLength : pos+frameLength]
+		if len(encrypted) > 16 {
+			encrypted = encrypted[16:]
+			n := len(encrypted) / aes.BlockSize * aes.BlockSize
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(encrypted[:n], encrypted[:n])
+		}
+
+		pos += frameLength
+	}
+
+	return out, nil
+}
+
+// repacketize 将新的 PES 数据重新分配到原来的 TS 包中
+// 保留原有适配域（去掉填充字节），空间不足时在最后追加新包，多余空间用填充字节补齐
+func repacketize(packets [][]byte, indexes []int, pes []byte) ([][]byte, error) {
+	if len(pes) < len(indexes) {
+		return nil, fmt.Errorf("PES 长度 %d 不足以填充 %d 个 TS 包", len(pes), len(indexes))
+	}
+
+	result := make([][]byte, 0, len(indexes)+1)
+	remaining := pes
+	for j, idx := range indexes {
+		adaptation := minimalAdaptation(packets[idx])
+		capacity := tsPayloadSize - adaptationSize(adaptation)
+
+		// 保证后面的每个包至少分到 1 字节，避免出现无负载的包
+		n := min(capacity, len(remaining)-(len(indexes)-j-1))
+		result = append(result, buildPacket(packets[idx][:4], adaptation, remaining[:n]))
+		remaining = remaining[n:]
+	}
+
+	// PES 变长，追加新包
+	last := packets[indexes[len(indexes)-1]]
+	for cc := last[3] & 0x0f; len(remaining) > 0; {
+		cc = (cc + 1) & 0x0f
+		header := []byte{0x47, last[1] &^ 0x40, last[2], last[3]&0xc0 | cc}
+		n := min(tsPayloadSize, len(remaining))
+		result = append(result, buildPacket(header, nil, remaining[:n]))
+		remaining = remaining[n:]
+	}
+
+	return result, nil
+}
+
+// minimalAdaptation 返回去掉填充字节后的适配域内容（不含长度字节），不需要适配域时返回 nil
+func minimalAdaptation(packet []byte) []byte {
+	if packet[3]&0x20 == 0 || packet[4] == 0 {
+		return nil
+	}
+
+	field := packet[5 : 5+min(int(packet[4]), tsPacketSize-5)]
+	flags := field[0]
+	if flags == 0 {
+		return nil
+	}
+
+	// 计算各可选字段的长度
+	length := 1
+	if flags&0x10 != 0 { // PCR
+		length += 6
+	}
+	if flags&0x08 != 0 { // OPCR
+		length += 6
+	}
+	if flags&0x04 != 0 { // splice_countdown
+		length++
+	}
+	if flags&0x02 != 0 && length < len(field) { // transport_private_data
+		length += 1 + int(field[length])
+	}
+	if flags&0x01 != 0 && length < len(field) { // adaptation_field_extension
+		length += 1 + int(field[length])
+	}
+	if length > len(field) {
+		length = len(field)
+	}
+
+	return field[:length]
+}
+
+// adaptationSize 返回适配域在 TS 包中占用的字节数（含长度字节）
+func adaptationSize(adaptation []byte) int {
+	if adaptation == nil {
+		return 0
+	}
+	return 1 + len(adaptation)
+}
+
+// buildPacket 使用给定的包头、适配域和负载构建 TS 包，不足部分在适配域中填充
+func buildPacket(header []byte, adaptation []byte, payload []byte) []byte {
+	packet := make([]byte, tsPacketSize)
+	copy(packet, header)
+
+	fieldSize := tsPayloadSize - len(payload) // 适配域总长度（含长度字节）
+	if fieldSize == 0 {
+		packet[3] = packet[3]&0xcf | 0x10
+	} else {
+		packet[3] = packet[3]&0xcf | 0x30
+		packet[4] = byte(fieldSize - 1)
+		if fieldSize > 1 {
+			n := copy(packet[5:4+fieldSize], adaptation)
+			if n == 0 {
+				packet[5] = 0x00 // 只有填充时 flags 为 0
+				n = 1
+			}
+			for i := 5 + n; i < 4+fieldSize; i++ {
+				packet[i] = 0xff
+			}
+		}
+	}
+	copy(packet[4+fieldSize:], payload)
+
+	return packet
+}
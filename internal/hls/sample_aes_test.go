@@ -0,0 +1,256 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x0100
+	testAudioPID = 0x0101
+)
+
+// buildPSIPacket 构建承载单个 PSI 表的 TS 包
+func buildPSIPacket(pid uint16, section []byte) []byte {
+	packet := bytes.Repeat([]byte{0xff}, tsPacketSize)
+	packet[0] = 0x47
+	packet[1] = 0x40 | byte(pid>>8)
+	packet[2] = byte(pid)
+	packet[3] = 0x10
+	packet[4] = 0x00 // pointer_field
+	copy(packet[5:], section)
+	return packet
+}
+
+// buildSection 补全 PSI 表的 section_length 和 CRC
+func buildSection(tableID byte, body []byte) []byte {
+	length := len(body) + 4
+	section := append([]byte{tableID, 0xb0 | byte(length>>8), byte(length)}, body...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32MPEG2(section))
+	return append(section, crc...)
+}
+
+func buildPAT() []byte {
+	body := []byte{0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xe0 | byte(testPMTPID>>8), byte(testPMTPID & 0xff)}
+	return buildPSIPacket(0, buildSection(0x00, body))
+}
+
+func buildPMT(videoType, audioType byte) []byte {
+	body := []byte{0x00, 0x01, 0xc1, 0x00, 0x00, 0xe0 | byte(testVideoPID>>8), byte(testVideoPID & 0xff), 0xf0, 0x00}
+	body = append(body, videoType, 0xe0|byte(testVideoPID>>8), byte(testVideoPID&0xff), 0xf0, 0x00)
+	body = append(body, audioType, 0xe0|byte(testAudioPID>>8), byte(testAudioPID&0xff), 0xf0, 0x00)
+	return buildPSIPacket(testPMTPID, buildSection(0x02, body))
+}
+
+// packetizePES 将 PES 拆分为 TS 包，第一个包带 random_access_indicator，最后一个包用填充补齐
+func packetizePES(pid uint16, pes []byte) [][]byte {
+	var packets [][]byte
+	for cc := 0; len(pes) > 0; cc++ {
+		var adaptation []byte
+		if cc == 0 {
+			adaptation = []byte{0x40}
+		}
+		header := []byte{0x47, byte(pid >> 8), byte(pid), byte(cc & 0x0f)}
+		if cc == 0 {
+			header[1] |= 0x40
+		}
+		n := min(tsPayloadSize-adaptationSize(adaptation), len(pes))
+		packets = append(packets, buildPacket(header, adaptation, pes[:n]))
+		pes = pes[n:]
+	}
+	return packets
+}
+
+// buildTS 拼接 PAT、PMT 和音视频 PES
+func buildTS(videoType, audioType byte, videoPES, audioPES []byte) []byte {
+	ts := append(buildPAT(), buildPMT(videoType, audioType)...)
+	for _, packet := range packetizePES(testVideoPID, videoPES) {
+		ts = append(ts, packet...)
+	}
+	for _, packet := range packetizePES(testAudioPID, audioPES) {
+		ts = append(ts, packet...)
+	}
+	return ts
+}
+
+func buildPES(streamID byte, es []byte, withLength bool) []byte {
+	pes := []byte{0x00, 0x00, 0x01, streamID, 0x00, 0x00, 0x80, 0x80, 0x05, 0x21, 0x00, 0x01, 0x00, 0x01}
+	if withLength {
+		binary.BigEndian.PutUint16(pes[4:6], uint16(len(pes)-6+len(es)))
+	}
+	return append(pes, es...)
+}
+
+// buildADTSFrame 构建负载长度为 n 的 ADTS 帧
+func buildADTSFrame(r *rand.Rand, n int) []byte {
+	length := 7 + n
+	frame := []byte{0xff, 0xf1, 0x50, 0x80 | byte(length>>11)&0x03, byte(length >> 3), byte(length&0x07)<<5 | 0x1f, 0xfc}
+	payload := make([]byte, n)
+	r.Read(payload)
+	return append(frame, payload...)
+}
+
+// encryptNALPattern 与 decryptNALPattern 相反的加密过程
+func encryptNALPattern(data []byte, block cipher.Block, iv []byte) {
+	mode := cipher.NewCBCEncrypter(block, iv)
+	for pos := 0; pos < len(data); {
+		if len(data)-pos > aes.BlockSize {
+			mode.CryptBlocks(data[pos:pos+aes.BlockSize], data[pos:pos+aes.BlockSize])
+			pos += aes.BlockSize
+		}
+		pos += min(144, len(data)-pos)
+	}
+}
+
+// encryptVideoES 按 SAMPLE-AES 规则加密 "起始码 + NAL" 序列
+func encryptVideoES(nals [][]byte, block cipher.Block, iv []byte) ([]byte, []byte) {
+	var plain, encrypted []byte
+	for _, nal := range nals {
+		plain = append(plain, 0x00, 0x00, 0x00, 0x01)
+		plain = append(plain, nal...)
+
+		encrypted = append(encrypted, 0x00, 0x00, 0x00, 0x01)
+		if len(nal) > 48 && (nal[0]&0x1f == 1 || nal[0]&0x1f == 5) {
+			raw := removeEmulationPrevention(nal)
+			encryptNALPattern(raw[32:], block, iv)
+			encrypted = append(encrypted, addEmulationPrevention(raw)...)
+		} else {
+			encrypted = append(encrypted, nal...)
+		}
+	}
+	return plain, encrypted
+}
+
+// encryptAudioES 按 SAMPLE-AES 规则加密 ADTS 帧
+func encryptAudioES(frames [][]byte, block cipher.Block, iv []byte) ([]byte, []byte) {
+	var plain, encrypted []byte
+	for _, frame := range frames {
+		plain = append(plain, frame...)
+
+		frame = append([]byte(nil), frame...)
+		data := frame[7+16:]
+		n := len(data) / aes.BlockSize * aes.BlockSize
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(data[:n], data[:n])
+		encrypted = append(encrypted, frame...)
+	}
+	return plain, encrypted
+}
+
+// demuxPES 按 PID 拼接 TS 包的负载，并检查连续计数器
+func demuxPES(t *testing.T, ts []byte) map[uint16][]byte {
+	t.Helper()
+
+	payloads := make(map[uint16][]byte)
+	lastCC := make(map[uint16]int)
+	for i := 0; i < len(ts); i += tsPacketSize {
+		packet := ts[i : i+tsPacketSize]
+		pid := packetPID(packet)
+		if !hasPayload(packet) {
+			continue
+		}
+		cc := int(packet[3] & 0x0f)
+		if last, ok := lastCC[pid]; ok && cc != (last+1)&0x0f {
+			t.Errorf("PID 0x%x 的连续计数器不连续: %d -> %d", pid, last, cc)
+		}
+		lastCC[pid] = cc
+		payloads[pid] = append(payloads[pid], packet[payloadOffset(packet):]...)
+	}
+	return payloads
+}
+
+// go test -v ./internal/hls -run TestDecryptSampleAES
+func TestDecryptSampleAES(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	key := make([]byte, 16)
+	iv := make([]byte, 16)
+	r.Read(key)
+	r.Read(iv)
+	block, _ := aes.NewCipher(key)
+
+	// 调整 IDR 的长度，使加密后的视频 PES 恰好填满 TS 包（第一个包有 2 字节适配域），
+	// 解密后插入防竞争字节导致 PES 变长，需要追加新的 TS 包
+	var plainVideoPES, encryptedVideoPES []byte
+	for size := 600; ; size++ {
+		sps := []byte{0x67, 0x64, 0x00, 0x28, 0xac, 0xd9}
+		raw := make([]byte, size)
+		r.Read(raw)
+		raw[0] = 0x65
+		copy(raw[40:], []byte{0x00, 0x00, 0x02}) // 位于第一个加密块中，转义后多出一个字节
+		idr := addEmulationPrevention(raw)
+
+		plainES, encryptedES := encryptVideoES([][]byte{sps, idr}, block, iv)
+		plainVideoPES = buildPES(0xe0, plainES, false)
+		encryptedVideoPES = buildPES(0xe0, encryptedES, false)
+		if (len(encryptedVideoPES)+2)%tsPayloadSize == 0 && len(plainVideoPES) > len(encryptedVideoPES) {
+			break
+		}
+	}
+
+	plainAudioES, encryptedAudioES := encryptAudioES([][]byte{buildADTSFrame(r, 100), buildADTSFrame(r, 57)}, block, iv)
+	plainAudioPES := buildPES(0xc0, plainAudioES, true)
+	encryptedAudioPES := buildPES(0xc0, encryptedAudioES, true)
+
+	encryptedTS := buildTS(0xdb, 0xcf, encryptedVideoPES, encryptedAudioPES)
+
+	decrypted, err := decryptSampleAES(encryptedTS, key, iv)
+	if err != nil {
+		t.Fatalf("解密失败: %v", err)
+	}
+	if len(decrypted)%tsPacketSize != 0 || len(decrypted) <= len(encryptedTS) {
+		t.Fatalf("解密后的长度错误: %d", len(decrypted))
+	}
+
+	payloads := demuxPES(t, decrypted)
+	if !bytes.Equal(payloads[testVideoPID], plainVideoPES) {
+		t.Errorf("视频 PES 解密结果错误")
+	}
+	if !bytes.Equal(payloads[testAudioPID], plainAudioPES) {
+		t.Errorf("音频 PES 解密结果错误")
+	}
+
+	// PMT 中的 stream_type 应改回标准值，且 CRC 正确
+	_, streamTypes, err := parseProgramTables([][]byte{decrypted[:tsPacketSize], decrypted[tsPacketSize : 2*tsPacketSize]})
+	if err != nil {
+		t.Fatalf("解析 PMT 失败: %v", err)
+	}
+	if streamTypes[testVideoPID] != 0x1b || streamTypes[testAudioPID] != 0x0f {
+		t.Errorf("stream_type 未改回标准值: %v", streamTypes)
+	}
+	pmt := decrypted[tsPacketSize : 2*tsPacketSize]
+	start, end, _ := psiSection(pmt, 0x02)
+	if crc32MPEG2(pmt[start:end]) != 0 {
+		t.Errorf("PMT 的 CRC 错误")
+	}
+
+	// 第一个视频包的 random_access_indicator 应保留
+	first := decrypted[2*tsPacketSize : 3*tsPacketSize]
+	if first[3]&0x20 == 0 || first[5]&0x40 == 0 {
+		t.Errorf("适配域未保留")
+	}
+}
+
+func TestDecryptSampleAESUnsupported(t *testing.T) {
+	ts := append(buildPAT(), buildPMT(0xdb, 0xc1)...)
+	if _, err := decryptSampleAES(ts, make([]byte, 16), make([]byte, 16)); err == nil {
+		t.Fatal("期望 AC-3 返回错误")
+	}
+}
+
+func TestEmulationPrevention(t *testing.T) {
+	raw := []byte{0x65, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x03, 0xaa}
+	escaped := addEmulationPrevention(raw)
+
+	expected := []byte{0x65, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x01, 0x00, 0x00, 0x03, 0x03, 0xaa}
+	if !bytes.Equal(escaped, expected) {
+		t.Errorf("插入防竞争字节错误: %x", escaped)
+	}
+	if !bytes.Equal(removeEmulationPrevention(escaped), raw) {
+		t.Errorf("去除防竞争字节错误: %x", removeEmulationPrevention(escaped))
+	}
+}
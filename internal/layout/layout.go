@@ -0,0 +1,209 @@
+// Package layout 根据路径模板生成频道、视频及相关文件、新闻的保存位置
+//
+// 模板中的 / 分隔目录，{字段} 会被替换为对应的值，日期字段可以用 {字段:格式} 指定 Go 的时间格式，
+// 如 {display_date:2006-01-02}，未指定时为 2006-01-02。替换后的值中不能用于文件名的字符会被替换为 _
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ncpd/config"
+	"ncpd/internal/client"
+)
+
+// 模板中可以使用的字段
+const (
+	FieldPlatform    = "platform"     // 平台的 Key，如 nicochannel
+	FieldChannel     = "channel"      // 频道名
+	FieldChannelID   = "channel_id"   // 频道 ID
+	FieldContentCode = "content_code" // 视频代码
+	FieldArticleCode = "article_code" // 文章代码
+	FieldTitle       = "title"        // 视频或文章的标题
+	FieldType        = "type"         // 動画、生放送 或 NEWS
+	FieldResolution  = "resolution"   // 视频最高画质的分辨率，如 1920x1080
+	FieldDisplayDate = "display_date" // 视频的显示日期
+	FieldReleasedAt  = "released_at"  // 视频的公开日期
+	FieldPublishDate = "publish_date" // 文章的发布日期
+)
+
+var (
+	channelFields = []string{FieldPlatform, FieldChannel, FieldChannelID}
+	videoFields   = append(channelFields[:len(channelFields):len(channelFields)], FieldContentCode, FieldTitle, FieldType, FieldResolution, FieldDisplayDate, FieldReleasedAt)
+	newsFields    = append(channelFields[:len(channelFields):len(channelFields)], FieldArticleCode, FieldTitle, FieldType, FieldPublishDate)
+
+	dateFields = map[string]bool{FieldDisplayDate: true, FieldReleasedAt: true, FieldPublishDate: true}
+)
+
+// defaultDateFormat 日期字段未指定格式时使用的格式
+const defaultDateFormat = "2006-01-02"
+
+// Values 模板字段的值，日期字段为接口返回的 "2006-01-02 15:04:05" 格式
+type Values map[string]string
+
+// Template 解析后的路径模板
+type Template struct {
+	text     string
+	segments []segment
+}
+
+// segment 模板中的一段文本或一个字段
+type segment struct {
+	text   string // 字段为空时是原样输出的文本
+	field  string
+	format string // 日期字段的格式
+}
+
+var placeholder = regexp.MustCompile(`\{([a-z_]+)(?::([^{}]+))?\}`)
+
+// Parse 解析模板，fields 为可以使用的字段
+func Parse(text string, fields []string) (*Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("路径模板不能为空")
+	}
+	if strings.HasPrefix(text, "/") || strings.HasSuffix(text, "/") {
+		return nil, fmt.Errorf("路径模板 %q 不能以 / 开头或结尾", text)
+	}
+
+	t := &Template{text: text}
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(text, -1) {
+		t.segments = append(t.segments, segment{text: text[last:m[0]]})
+		field := text[m[2]:m[3]]
+		if !slices.Contains(fields, field) {
+			return nil, fmt.Errorf("路径模板 %q 中的字段 {%s} 无效，可以使用: %s", text, field, strings.Join(fields, "、"))
+		}
+		seg := segment{field: field}
+		if m[4] >= 0 {
+			if !dateFields[field] {
+				return nil, fmt.Errorf("路径模板 %q 中的字段 {%s} 不是日期，不能指定格式", text, field)
+			}
+			seg.format = text[m[4]:m[5]]
+		} else if dateFields[field] {
+			seg.format = defaultDateFormat
+		}
+		t.segments = append(t.segments, seg)
+		last = m[1]
+	}
+	t.segments = append(t.segments, segment{text: text[last:]})
+
+	for _, seg := range t.segments {
+		if strings.ContainsAny(seg.text, "{}") {
+			return nil, fmt.Errorf("路径模板 %q 中有无效的 {}", text)
+		}
+	}
+	return t, nil
+}
+
+// String 返回模板的原文
+func (t *Template) String() string {
+	return t.text
+}
+
+// Uses 判断模板是否使用了 field
+func (t *Template) Uses(field string) bool {
+	for _, seg := range t.segments {
+		if seg.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute 使用 values 生成以 / 分隔的相对路径，每一级目录和文件名都是合法的文件名
+func (t *Template) Execute(values Values) string {
+	var b strings.Builder
+	for _, seg := range t.segments {
+		if seg.field == "" {
+			b.WriteString(seg.text)
+			continue
+		}
+		value := values[seg.field]
+		if seg.format != "" {
+			value = formatDate(value, seg.format)
+		}
+		b.WriteString(invalidChars.ReplaceAllString(value, "_"))
+	}
+
+	elements := strings.Split(b.String(), "/")
+	for i, element := range elements {
+		elements[i] = cleanElement(element)
+	}
+	return strings.Join(elements, "/")
+}
+
+// formatDate 将接口返回的日本时间按 format 格式化，无法解析时返回原值
+func formatDate(value string, format string) string {
+	date, err := time.ParseInLocation("2006-01-02 15:04:05", value, client.JST)
+	if err != nil {
+		return value
+	}
+	return date.Format(format)
+}
+
+// Layout 所有保存位置的模板
+type Layout struct {
+	Channel   *Template // 频道的保存目录，相对于输出目录
+	Video     *Template // 视频文件，相对于频道目录，不含扩展名
+	Thumbnail *Template // 缩略图，相对于频道目录，不含扩展名
+	Danmaku   *Template // 弹幕，相对于频道目录，不含扩展名，每种格式使用各自的扩展名
+	Details   *Template // 视频详情，相对于频道目录，不含扩展名
+	News      *Template // 新闻的 HTML，相对于频道目录，不含扩展名，图片保存在同一个目录中
+}
+
+// Load 解析配置中的路径模板，默认的模板与使用模板之前的目录结构相同
+func Load(cfg *config.Config) (*Layout, error) {
+	l := &Layout{}
+	for _, t := range []struct {
+		dst    **Template
+		name   string
+		text   string
+		fields []string
+	}{
+		{&l.Channel, "PATH_TEMPLATE_CHANNEL", cfg.PathTemplateChannel, channelFields},
+		{&l.Video, "PATH_TEMPLATE_VIDEO", cfg.PathTemplateVideo, videoFields},
+		{&l.Thumbnail, "PATH_TEMPLATE_THUMBNAIL", cfg.PathTemplateThumbnail, videoFields},
+		{&l.Danmaku, "PATH_TEMPLATE_DANMAKU", cfg.PathTemplateDanmaku, videoFields},
+		{&l.Details, "PATH_TEMPLATE_DETAILS", cfg.PathTemplateDetails, videoFields},
+		{&l.News, "PATH_TEMPLATE_NEWS", cfg.PathTemplateNews, newsFields},
+	} {
+		template, err := Parse(t.text, t.fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+		*t.dst = template
+	}
+	return l, nil
+}
+
+// 不允许出现在文件名中的字符（适用于 Windows、macOS、Linux）
+var invalidChars = regexp.MustCompile(`[<>:"|?*\x00-\x1f\x7f/\\]`)
+
+// maxNameLength 文件名的最大字节数，避免路径过长
+const maxNameLength = 200
+
+// SanitizeName 清理文件名，替换不允许的字符，移除开头和结尾的空格、点号，清理后为空时返回 _
+func SanitizeName(name string) string {
+	return cleanElement(invalidChars.ReplaceAllString(name, "_"))
+}
+
+// cleanElement 清理路径中的一级，不会得到 . 或 .. 这样的路径
+func cleanElement(element string) string {
+	element = strings.Trim(element, " .")
+	if len(element) > maxNameLength {
+		// 不截断多字节字符
+		cut := maxNameLength
+		for cut > 0 && !utf8.RuneStart(element[cut]) {
+			cut--
+		}
+		element = strings.TrimRight(element[:cut], " .")
+	}
+	if element == "" {
+		return "_"
+	}
+	return element
+}
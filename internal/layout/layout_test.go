@@ -0,0 +1,72 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"ncpd/config"
+)
+
+// go test -v ./internal/layout
+func TestExecute(t *testing.T) {
+	template, err := Parse("{type}/[{display_date:20060102}] {title} ({content_code})/{title}_{resolution}", videoFields)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	got := template.Execute(Values{
+		FieldType:        "動画",
+		FieldDisplayDate: "2024-03-12 20:00:00",
+		FieldTitle:       `a/b: "c"?.`,
+		FieldContentCode: "sm1",
+		FieldResolution:  "1920x1080",
+	})
+	if want := `動画/[20240312] a_b_ _c__. (sm1)/a_b_ _c__._1920x1080`; got != want {
+		t.Errorf("期望 %s，实际 %s", want, got)
+	}
+	if !template.Uses(FieldResolution) || template.Uses(FieldReleasedAt) {
+		t.Error("Uses 结果错误")
+	}
+
+	// 日期默认只保留日期部分，空的一级不会变成 . 或 ..
+	template, _ = Parse("{publish_date}/{title}", newsFields)
+	if got := template.Execute(Values{FieldPublishDate: "2024-02-10 12:00:00", FieldTitle: ".."}); got != "2024-02-10/_" {
+		t.Errorf("生成的路径错误: %s", got)
+	}
+
+	// 过长的标题按字符截断
+	template, _ = Parse("{title}", videoFields)
+	if got := template.Execute(Values{FieldTitle: strings.Repeat("あ", 100)}); len(got) > maxNameLength || !strings.HasPrefix(got, "あ") || strings.ContainsRune(got, '�') {
+		t.Errorf("截断错误: %q", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{"", "/{title}", "{title}/", "{unknown}", "{title:2006}", "{title", "{publish_date}"} {
+		if _, err := Parse(text, videoFields); err == nil {
+			t.Errorf("%q 应返回错误", text)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	cfg := &config.Config{
+		PathTemplateChannel:   "{platform}/{channel}",
+		PathTemplateVideo:     "{title}",
+		PathTemplateThumbnail: "{title}",
+		PathTemplateDanmaku:   "{title}",
+		PathTemplateDetails:   "{title}",
+		PathTemplateNews:      "{content_code}",
+	}
+	if _, err := Load(cfg); err == nil || !strings.Contains(err.Error(), "PATH_TEMPLATE_NEWS") {
+		t.Errorf("新闻模板不能使用视频的字段: %v", err)
+	}
+
+	cfg.PathTemplateNews = "{article_code}"
+	l, err := Load(cfg)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if got := l.Channel.Execute(Values{FieldPlatform: "qlover", FieldChannel: "テスト"}); got != "qlover/テスト" {
+		t.Errorf("频道目录错误: %s", got)
+	}
+}
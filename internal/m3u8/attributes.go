@@ -0,0 +1,105 @@
+package m3u8
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseAttributeList 解析形如 KEY=VALUE,KEY="VALUE" 的属性列表
+// 属性顺序任意，带引号的值中允许出现逗号，返回的值已去掉引号
+func parseAttributeList(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+
+	for i := 0; i < len(s); {
+		// 读取属性名
+		eq := strings.IndexByte(s[i:], '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("属性缺少 '=': %q", s[i:])
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		if name == "" {
+			return nil, fmt.Errorf("属性名为空: %q", s)
+		}
+		i += eq + 1
+
+		// 读取属性值
+		var value string
+		if i < len(s) && s[i] == '"' {
+			end := strings.IndexByte(s[i+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("属性 %s 的引号未闭合", name)
+			}
+			value = s[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			end := strings.IndexByte(s[i:], ',')
+			if end == -1 {
+				end = len(s) - i
+			}
+			value = strings.TrimSpace(s[i : i+end])
+			i += end
+		}
+
+		if _, ok := attrs[name]; ok {
+			return nil, fmt.Errorf("属性 %s 重复", name)
+		}
+		attrs[name] = value
+
+		// 跳过分隔符
+		if i < len(s) {
+			if s[i] != ',' {
+				return nil, fmt.Errorf("属性 %s 后缺少 ','", name)
+			}
+			i++
+		}
+	}
+
+	return attrs, nil
+}
+
+// attrInt 读取十进制整数属性，属性不存在时返回 0
+func attrInt(attrs map[string]string, name string) (int, error) {
+	value, ok := attrs[name]
+	if !ok {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("属性 %s 不是有效的整数: %q", name, value)
+	}
+	return n, nil
+}
+
+// attrBool 读取 YES/NO 枚举属性，属性不存在时返回 false
+func attrBool(attrs map[string]string, name string) (bool, error) {
+	switch value := attrs[name]; value {
+	case "", "NO":
+		return false, nil
+	case "YES":
+		return true, nil
+	default:
+		return false, fmt.Errorf("属性 %s 不是有效的 YES/NO: %q", name, value)
+	}
+}
+
+// attrHex 读取以 0x 开头的十六进制属性（如 IV），属性不存在时返回 nil
+func attrHex(attrs map[string]string, name string) ([]byte, error) {
+	value, ok := attrs[name]
+	if !ok {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	if trimmed == value {
+		return nil, fmt.Errorf("属性 %s 缺少 0x 前缀: %q", name, value)
+	}
+
+	b, err := hex.DecodeString(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("属性 %s 不是有效的十六进制: %q", name, value)
+	}
+	return b, nil
+}
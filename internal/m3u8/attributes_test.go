@@ -0,0 +1,54 @@
+package m3u8
+
+import (
+	"testing"
+)
+
+func TestParseAttributeList(t *testing.T) {
+	attrs, err := parseAttributeList(`RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2",BANDWIDTH=2000000,NAME="a=b"`)
+	if err != nil {
+		t.Fatalf("解析属性列表失败: %v", err)
+	}
+
+	expected := map[string]string{
+		"RESOLUTION": "1920x1080",
+		"CODECS":     "avc1.640028,mp4a.40.2",
+		"BANDWIDTH":  "2000000",
+		"NAME":       "a=b",
+	}
+	for name, value := range expected {
+		if attrs[name] != value {
+			t.Errorf("属性 %s 期望为 %q，实际为 %q", name, value, attrs[name])
+		}
+	}
+}
+
+func TestParseAttributeListMalformed(t *testing.T) {
+	cases := []string{
+		`BANDWIDTH`,                   // 缺少 '='
+		`CODECS="avc1.640028`,         // 引号未闭合
+		`CODECS="avc1"RESOLUTION=1x1`, // 缺少 ','
+		`BANDWIDTH=1,BANDWIDTH=2`,     // 属性重复
+		`=1`,                          // 属性名为空
+	}
+
+	for _, c := range cases {
+		if _, err := parseAttributeList(c); err == nil {
+			t.Errorf("期望 %q 解析失败", c)
+		}
+	}
+}
+
+func TestAttrHex(t *testing.T) {
+	iv, err := attrHex(map[string]string{"IV": "0x000102030405060708090A0B0C0D0E0F"}, "IV")
+	if err != nil {
+		t.Fatalf("解析 IV 失败: %v", err)
+	}
+	if len(iv) != 16 || iv[15] != 0x0f {
+		t.Errorf("IV 解析错误: %x", iv)
+	}
+
+	if _, err := attrHex(map[string]string{"IV": "000102"}, "IV"); err == nil {
+		t.Error("缺少 0x 前缀时应返回错误")
+	}
+}
@@ -1,9 +1,9 @@
 package m3u8
 
 import (
-	"regexp"
-	"strconv"
-	"strings"
+	"context"
+	"fmt"
+	"net/url"
 
 	"ncpd/internal/client"
 )
@@ -15,45 +15,25 @@ type StreamInfo struct {
 	Codecs           string `json:"codecs"`
 	Resolution       string `json:"resolution"`
 	FrameRate        string `json:"frame_rate"`
+	Audio            string `json:"audio"`           // 关联的 #EXT-X-MEDIA 音轨组
+	Video            string `json:"video"`           // 关联的 #EXT-X-MEDIA 视频组
+	Subtitles        string `json:"subtitles"`       // 关联的 #EXT-X-MEDIA 字幕组
+	ClosedCaptions   string `json:"closed_captions"` // 关联的 #EXT-X-MEDIA 隐藏字幕组
 	URL              string `json:"url"`
 }
 
-// ParseIndexM3U8 解析 index.m3u8 文件内容，提取所有流信息
-func ParseIndexM3U8(content string) []StreamInfo {
-	lines := strings.Split(content, "\n")
-	var streams []StreamInfo
-	var currentStream StreamInfo
-
-	// 匹配EXT-X-STREAM-INF行的正则表达式
-	streamInfRegex := regexp.MustCompile(`BANDWIDTH=(\d+),AVERAGE-BANDWIDTH=(\d+),CODECS="([^"]+)",RESOLUTION=(\d+x\d+),FRAME-RATE=([\d.]+)`)
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// 检查是否是EXT-X-STREAM-INF行
-		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
-			matches := streamInfRegex.FindStringSubmatch(line)
-			if len(matches) == 6 {
-				bandwidth, _ := strconv.Atoi(matches[1])
-				avgBandwidth, _ := strconv.Atoi(matches[2])
-
-				currentStream = StreamInfo{
-					Bandwidth:        bandwidth,
-					AverageBandwidth: avgBandwidth,
-					Codecs:           matches[3],
-					Resolution:       matches[4],
-					FrameRate:        matches[5],
-				}
-			}
-		} else if strings.HasPrefix(line, "http") && currentStream.Resolution != "" {
-			// 这是URL行，且前面有流信息
-			currentStream.URL = line
-			streams = append(streams, currentStream)
-			currentStream = StreamInfo{} // 重置
-		}
+// ParseIndexM3U8 解析 index.m3u8 文件内容，提取所有流信息，相对地址基于 indexURL 解析
+func ParseIndexM3U8(content string, indexURL string) ([]StreamInfo, error) {
+	playlist, err := ParseMasterPlaylist(content, indexURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(playlist.Variants) == 0 {
+		return nil, fmt.Errorf("m3u8: index.m3u8 中没有流信息")
 	}
 
-	return streams
+	return playlist.Variants, nil
 }
 
 // GetBestQuality 从流列表中获取最佳画质（最高分辨率）
@@ -71,14 +51,57 @@ func GetBestQuality(streams []StreamInfo) *StreamInfo {
 	return &bestStream
 }
 
+// DefaultIndexURL 获取 index.m3u8 的地址
+const DefaultIndexURL = "https://hls-auth.cloud.stream.co.jp/auth/index.m3u8"
+
+// IndexURL 返回 sessionID 对应的 index.m3u8 地址
+func IndexURL(sessionID string) string {
+	return indexURL(DefaultIndexURL, sessionID)
+}
+
+func indexURL(base string, sessionID string) string {
+	return base + "?session_id=" + url.QueryEscape(sessionID)
+}
+
+// Client 使用指定的 API 客户端获取播放列表
+type Client struct {
+	*client.Client
+	IndexURL string // 获取 index.m3u8 的地址
+}
+
+// NewClient 创建使用 c 的播放列表客户端
+func NewClient(c *client.Client) *Client {
+	return &Client{Client: c, IndexURL: DefaultIndexURL}
+}
+
 // GetIndex 获取index.m3u8文件内容
-func GetIndex(sessionID string) (string, error) {
-	client := client.Get()
+func GetIndex(ctx context.Context, sessionID string) (string, error) {
+	return NewClient(client.Default()).GetIndex(ctx, sessionID)
+}
+
+// GetPlaylist 获取播放列表文件内容
+func GetPlaylist(ctx context.Context, playlistURL string) (string, error) {
+	return NewClient(client.Default()).GetPlaylist(ctx, playlistURL)
+}
+
+// IndexFor 返回 sessionID 对应的 index.m3u8 地址，解析 index.m3u8 时作为相对地址的基准
+func (c *Client) IndexFor(sessionID string) string {
+	return indexURL(c.IndexURL, sessionID)
+}
+
+// GetIndex 获取index.m3u8文件内容
+func (c *Client) GetIndex(ctx context.Context, sessionID string) (string, error) {
+	resp, err := c.R(ctx).Get(c.IndexFor(sessionID))
+	if err != nil {
+		return "", err
+	}
 
-	resp, err := client.R().
-		SetPathParam("sessionId", sessionID).
-		Get("https://hls-auth.cloud.stream.co.jp/auth/index.m3u8?session_id={sessionId}")
+	return resp.String(), nil
+}
 
+// GetPlaylist 获取播放列表文件内容
+func (c *Client) GetPlaylist(ctx context.Context, playlistURL string) (string, error) {
+	resp, err := c.R(ctx).Get(playlistURL)
 	if err != nil {
 		return "", err
 	}
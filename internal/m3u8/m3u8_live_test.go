@@ -0,0 +1,50 @@
+//go:build live
+
+package m3u8
+
+import (
+	"context"
+	"testing"
+
+	"ncpd/internal/auth"
+	"ncpd/internal/video"
+)
+
+// go test -tags live -v ./internal/m3u8/ -run TestM3U8WorkflowLive
+func TestM3U8WorkflowLive(t *testing.T) {
+	videoList, err := video.GetVideoList(context.Background(), 387)
+	if err != nil {
+		t.Fatalf("获取视频列表失败: %v", err)
+	}
+
+	for i, video := range videoList {
+		sessionID, err := auth.GetSessionID(context.Background(), video.ContentCode)
+		if err != nil {
+			t.Logf("获取 session ID 失败: %v", err)
+			continue
+		}
+
+		index, err := GetIndex(context.Background(), sessionID)
+		if err != nil {
+			t.Logf("获取 index.m3u8 失败: %v", err)
+			continue
+		}
+
+		streamInfo, err := ParseIndexM3U8(index, IndexURL(sessionID))
+		if err != nil {
+			t.Logf("解析 index.m3u8 失败: %v", err)
+			continue
+		}
+		bestQuality := GetBestQuality(streamInfo)
+
+		if bestQuality == nil {
+			t.Logf("未找到最佳画质信息")
+			continue
+		}
+
+		t.Logf("  %d. %s", i+1, video.Title)
+		t.Logf("   视频代码: %s", video.ContentCode)
+		t.Logf("   最高画质: %s %s", bestQuality.Resolution, bestQuality.FrameRate)
+		t.Logf("   下载地址: %s", bestQuality.URL)
+	}
+}
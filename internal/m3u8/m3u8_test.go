@@ -1,52 +1,12 @@
 package m3u8
 
 import (
+	"context"
 	"testing"
 
-	"ncpd/internal/auth"
-	"ncpd/internal/video"
+	"ncpd/internal/fakeapi"
 )
 
-// go test -v ./internal/m3u8/
-func TestM3U8Workflow(t *testing.T) {
-	videoList, err := video.GetVideoList(387)
-	if err != nil {
-		t.Fatalf("获取视频列表失败: %v", err)
-	}
-
-	token, err := auth.GetToken()
-	if err != nil {
-		t.Fatal("获取 token 失败")
-	}
-
-	for i, video := range videoList {
-		sessionID, err := auth.GetSessionID(video.ContentCode, token)
-		if err != nil {
-			t.Logf("获取 session ID 失败: %v", err)
-			continue
-		}
-
-		index, err := GetIndex(sessionID)
-		if err != nil {
-			t.Logf("获取 index.m3u8 失败: %v", err)
-			continue
-		}
-
-		streamInfo := ParseIndexM3U8(index)
-		bestQuality := GetBestQuality(streamInfo)
-
-		if bestQuality == nil {
-			t.Logf("未找到最佳画质信息")
-			continue
-		}
-
-		t.Logf("  %d. %s", i+1, video.Title)
-		t.Logf("   视频代码: %s", video.ContentCode)
-		t.Logf("   最高画质: %s %s", bestQuality.Resolution, bestQuality.FrameRate)
-		t.Logf("   下载地址: %s", bestQuality.URL)
-	}
-}
-
 func TestParseIndexM3U8(t *testing.T) {
 	// 测试数据
 	testM3U8Content := `#EXTM3U
@@ -55,7 +15,10 @@ https://example.com/stream_720p.m3u8
 #EXT-X-STREAM-INF:BANDWIDTH=2000000,AVERAGE-BANDWIDTH=1900000,CODECS="avc1.640028,mp4a.40.2",RESOLUTION=1920x1080,FRAME-RATE=30.000
 https://example.com/stream_1080p.m3u8`
 
-	streams := ParseIndexM3U8(testM3U8Content)
+	streams, err := ParseIndexM3U8(testM3U8Content, "https://example.com/index.m3u8")
+	if err != nil {
+		t.Fatalf("解析 index.m3u8 失败: %v", err)
+	}
 
 	if len(streams) != 2 {
 		t.Fatalf("期望解析出 2 个流，实际解析出 %d 个", len(streams))
@@ -67,6 +30,16 @@ https://example.com/stream_1080p.m3u8`
 	}
 }
 
+func TestParseIndexM3U8Malformed(t *testing.T) {
+	// STREAM-INF 后缺少 URI 时应返回错误，而不是静默丢弃
+	testM3U8Content := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=1280x720`
+
+	if _, err := ParseIndexM3U8(testM3U8Content, "https://example.com/index.m3u8"); err == nil {
+		t.Fatal("期望返回错误")
+	}
+}
+
 func TestGetBestQuality(t *testing.T) {
 	streams := []StreamInfo{
 		{Bandwidth: 1000000, Resolution: "1280x720", FrameRate: "30.000"},
@@ -81,3 +54,41 @@ func TestGetBestQuality(t *testing.T) {
 
 	t.Logf("最佳画质: %s %s", bestQuality.Resolution, bestQuality.FrameRate)
 }
+
+// go test -v ./internal/m3u8/ -run TestM3U8Workflow
+func TestM3U8Workflow(t *testing.T) {
+	fake := fakeapi.New(t)
+	c := NewClient(fake.Client())
+	c.IndexURL = fake.IndexURL()
+
+	index, err := c.GetIndex(context.Background(), fakeapi.SessionID)
+	if err != nil {
+		t.Fatalf("获取 index.m3u8 失败: %v", err)
+	}
+
+	streams, err := ParseIndexM3U8(index, c.IndexFor(fakeapi.SessionID))
+	if err != nil {
+		t.Fatalf("解析 index.m3u8 失败: %v", err)
+	}
+	bestQuality := GetBestQuality(streams)
+	if bestQuality == nil || bestQuality.Resolution != "1280x720" {
+		t.Fatalf("最佳画质错误: %+v", bestQuality)
+	}
+
+	playlist, err := c.GetPlaylist(context.Background(), bestQuality.URL)
+	if err != nil {
+		t.Fatalf("获取播放列表失败: %v", err)
+	}
+	media, err := ParseMediaPlaylist(playlist, bestQuality.URL)
+	if err != nil {
+		t.Fatalf("解析播放列表失败: %v", err)
+	}
+	if len(media.Segments) != fakeapi.SegmentCount {
+		t.Errorf("期望 %d 个分片，实际 %d 个", fakeapi.SegmentCount, len(media.Segments))
+	}
+
+	// session ID 无效时服务器拒绝请求
+	if _, err := c.GetIndex(context.Background(), "invalid"); err == nil {
+		t.Error("无效的 session ID 应返回错误")
+	}
+}
@@ -0,0 +1,477 @@
+package m3u8
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MasterPlaylist 表示主播放列表（index.m3u8），包含各码率版本和备选音轨/字幕
+type MasterPlaylist struct {
+	Version  int          `json:"version"`
+	Variants []StreamInfo `json:"variants"`
+	Media    []Rendition  `json:"media"`
+}
+
+// Rendition 表示 #EXT-X-MEDIA 描述的备选音轨、视频或字幕
+type Rendition struct {
+	Type       string `json:"type"` // AUDIO / VIDEO / SUBTITLES / CLOSED-CAPTIONS
+	GroupID    string `json:"group_id"`
+	Name       string `json:"name"`
+	Language   string `json:"language"`
+	Default    bool   `json:"default"`
+	AutoSelect bool   `json:"autoselect"`
+	URL        string `json:"url"` // CLOSED-CAPTIONS 或与主流合并时为空
+}
+
+// MediaPlaylist 表示媒体播放列表，即分片列表
+type MediaPlaylist struct {
+	Version               int       `json:"version"`
+	TargetDuration        int       `json:"target_duration"`
+	MediaSequence         int       `json:"media_sequence"`
+	DiscontinuitySequence int       `json:"discontinuity_sequence"`
+	PlaylistType          string    `json:"playlist_type"` // VOD / EVENT，直播时为空
+	EndList               bool      `json:"end_list"`      // 是否出现 #EXT-X-ENDLIST
+	Segments              []Segment `json:"segments"`
+}
+
+// Segment 表示媒体播放列表中的单个分片
+type Segment struct {
+	Sequence      int     `json:"sequence"` // 媒体序列号
+	Duration      float64 `json:"duration"`
+	Title         string  `json:"title"`
+	URL           string  `json:"url"`
+	Discontinuity bool    `json:"discontinuity"` // 分片前是否有 #EXT-X-DISCONTINUITY
+	Key           *Key    `json:"key"`           // 未加密时为空
+	Map           *Map    `json:"map"`           // 没有初始化分片时为空
+}
+
+// Key 表示 #EXT-X-KEY 描述的加密信息
+type Key struct {
+	Method            string `json:"method"` // AES-128 / SAMPLE-AES
+	URL               string `json:"url"`
+	IV                []byte `json:"iv"` // 未指定时为空，此时使用媒体序列号作为 IV
+	KeyFormat         string `json:"keyformat"`
+	KeyFormatVersions string `json:"keyformatversions"`
+}
+
+// IsIdentity 判断密钥是否为可以直接用于解密的 identity 格式（省略 KEYFORMAT 时的默认值），
+// 其它格式（如 FairPlay 的 com.apple.streamingkeydelivery）需要 DRM
+func (k *Key) IsIdentity() bool {
+	return k.KeyFormat == "" || k.KeyFormat == "identity"
+}
+
+// Map 表示 #EXT-X-MAP 描述的初始化分片
+type Map struct {
+	URL       string `json:"url"`
+	ByteRange string `json:"byterange"`
+}
+
+// ParseError 表示播放列表格式错误
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("m3u8: 第 %d 行: %s", e.Line, e.Msg)
+}
+
+// playlistLine 表示去掉空行后的一行内容及其行号
+type playlistLine struct {
+	num  int
+	text string
+}
+
+// readLines 读取所有非空行，并检查 #EXTM3U 头
+func readLines(content string) ([]playlistLine, error) {
+	var lines []playlistLine
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for num := 1; scanner.Scan(); num++ {
+		text := strings.TrimSpace(scanner.Text())
+		if num == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if text != "" {
+			lines = append(lines, playlistLine{num: num, text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || lines[0].text != "#EXTM3U" {
+		return nil, &ParseError{Line: 1, Msg: "缺少 #EXTM3U 头"}
+	}
+
+	return lines[1:], nil
+}
+
+// splitTag 将 "#EXT-X-NAME:VALUE" 拆分为标签名和值
+func splitTag(line string) (string, string) {
+	if idx := strings.IndexByte(line, ':'); idx != -1 {
+		return line[:idx], line[idx+1:]
+	}
+	return line, ""
+}
+
+// resolveURL 将 ref 基于 base 解析为绝对地址
+func resolveURL(base *url.URL, ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+// ParseMasterPlaylist 解析主播放列表，相对地址基于 playlistURL 解析
+func ParseMasterPlaylist(content string, playlistURL string) (*MasterPlaylist, error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("m3u8: 解析播放列表地址失败: %w", err)
+	}
+
+	lines, err := readLines(content)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist := &MasterPlaylist{}
+	var pending *StreamInfo // 等待 URI 行的码率版本
+	var pendingLine int
+
+	for _, line := range lines {
+		fail := func(format string, args ...any) error {
+			return &ParseError{Line: line.num, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		if !strings.HasPrefix(line.text, "#") {
+			// URI 行
+			if pending == nil {
+				return nil, fail("URI 前缺少 #EXT-X-STREAM-INF")
+			}
+			pending.URL, err = resolveURL(base, line.text)
+			if err != nil {
+				return nil, fail("无效的地址 %q", line.text)
+			}
+			playlist.Variants = append(playlist.Variants, *pending)
+			pending = nil
+			continue
+		}
+
+		tag, value := splitTag(line.text)
+		if pending != nil && tag != "#EXT-X-STREAM-INF" && strings.HasPrefix(tag, "#EXT") {
+			// 规范要求 STREAM-INF 的下一行必须是 URI
+			return nil, &ParseError{Line: pendingLine, Msg: "#EXT-X-STREAM-INF 后缺少 URI"}
+		}
+
+		switch tag {
+		case "#EXT-X-VERSION":
+			if playlist.Version, err = strconv.Atoi(value); err != nil {
+				return nil, fail("无效的版本号 %q", value)
+			}
+
+		case "#EXT-X-STREAM-INF":
+			if pending != nil {
+				return nil, &ParseError{Line: pendingLine, Msg: "#EXT-X-STREAM-INF 后缺少 URI"}
+			}
+			stream, err := parseStreamInf(value)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			pending = stream
+			pendingLine = line.num
+
+		case "#EXT-X-MEDIA":
+			rendition, err := parseMedia(value, base)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			playlist.Media = append(playlist.Media, *rendition)
+
+		case "#EXTINF", "#EXT-X-TARGETDURATION", "#EXT-X-MEDIA-SEQUENCE":
+			return nil, fail("这是媒体播放列表，不是主播放列表")
+		}
+	}
+
+	if pending != nil {
+		return nil, &ParseError{Line: pendingLine, Msg: "#EXT-X-STREAM-INF 后缺少 URI"}
+	}
+
+	return playlist, nil
+}
+
+// parseStreamInf 解析 #EXT-X-STREAM-INF 的属性列表
+func parseStreamInf(value string) (*StreamInfo, error) {
+	attrs, err := parseAttributeList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := attrs["BANDWIDTH"]; !ok {
+		return nil, fmt.Errorf("#EXT-X-STREAM-INF 缺少 BANDWIDTH")
+	}
+
+	stream := &StreamInfo{
+		Codecs:         attrs["CODECS"],
+		Resolution:     attrs["RESOLUTION"],
+		FrameRate:      attrs["FRAME-RATE"],
+		Audio:          attrs["AUDIO"],
+		Video:          attrs["VIDEO"],
+		Subtitles:      attrs["SUBTITLES"],
+		ClosedCaptions: attrs["CLOSED-CAPTIONS"],
+	}
+	if stream.Bandwidth, err = attrInt(attrs, "BANDWIDTH"); err != nil {
+		return nil, err
+	}
+	if stream.AverageBandwidth, err = attrInt(attrs, "AVERAGE-BANDWIDTH"); err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// parseMedia 解析 #EXT-X-MEDIA 的属性列表
+func parseMedia(value string, base *url.URL) (*Rendition, error) {
+	attrs, err := parseAttributeList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	rendition := &Rendition{
+		Type:     attrs["TYPE"],
+		GroupID:  attrs["GROUP-ID"],
+		Name:     attrs["NAME"],
+		Language: attrs["LANGUAGE"],
+	}
+
+	switch rendition.Type {
+	case "AUDIO", "VIDEO", "SUBTITLES", "CLOSED-CAPTIONS":
+	default:
+		return nil, fmt.Errorf("#EXT-X-MEDIA 的 TYPE 无效: %q", rendition.Type)
+	}
+	if rendition.GroupID == "" || rendition.Name == "" {
+		return nil, fmt.Errorf("#EXT-X-MEDIA 缺少 GROUP-ID 或 NAME")
+	}
+
+	if rendition.Default, err = attrBool(attrs, "DEFAULT"); err != nil {
+		return nil, err
+	}
+	if rendition.AutoSelect, err = attrBool(attrs, "AUTOSELECT"); err != nil {
+		return nil, err
+	}
+
+	if uri, ok := attrs["URI"]; ok {
+		if rendition.URL, err = resolveURL(base, uri); err != nil {
+			return nil, fmt.Errorf("无效的地址 %q", uri)
+		}
+	}
+
+	return rendition, nil
+}
+
+// ParseMediaPlaylist 解析媒体播放列表，相对地址基于 playlistURL 解析
+func ParseMediaPlaylist(content string, playlistURL string) (*MediaPlaylist, error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("m3u8: 解析播放列表地址失败: %w", err)
+	}
+
+	lines, err := readLines(content)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist := &MediaPlaylist{}
+
+	// 以下状态作用于下一个分片
+	var (
+		current       *Segment // 已读取 #EXTINF，等待 URI 行
+		currentLine   int
+		key           *Key // KEY 和 MAP 对之后的所有分片生效，直到被替换
+		keyTags       bool // 上一个分片之后是否已经有 #EXT-X-KEY
+		initMap       *Map
+		discontinuity bool
+	)
+
+	for _, line := range lines {
+		fail := func(format string, args ...any) error {
+			return &ParseError{Line: line.num, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		if !strings.HasPrefix(line.text, "#") {
+			// URI 行
+			if current == nil {
+				return nil, fail("URI 前缺少 #EXTINF")
+			}
+			if current.URL, err = resolveURL(base, line.text); err != nil {
+				return nil, fail("无效的地址 %q", line.text)
+			}
+			current.Sequence = playlist.MediaSequence + len(playlist.Segments)
+			current.Key = key
+			current.Map = initMap
+			current.Discontinuity = discontinuity
+			playlist.Segments = append(playlist.Segments, *current)
+
+			current = nil
+			discontinuity = false
+			keyTags = false
+			continue
+		}
+
+		tag, value := splitTag(line.text)
+		switch tag {
+		case "#EXT-X-VERSION":
+			if playlist.Version, err = strconv.Atoi(value); err != nil {
+				return nil, fail("无效的版本号 %q", value)
+			}
+
+		case "#EXT-X-TARGETDURATION":
+			if playlist.TargetDuration, err = strconv.Atoi(value); err != nil {
+				return nil, fail("无效的 TARGETDURATION %q", value)
+			}
+
+		case "#EXT-X-MEDIA-SEQUENCE":
+			if len(playlist.Segments) > 0 {
+				return nil, fail("#EXT-X-MEDIA-SEQUENCE 必须出现在第一个分片之前")
+			}
+			if playlist.MediaSequence, err = strconv.Atoi(value); err != nil {
+				return nil, fail("无效的 MEDIA-SEQUENCE %q", value)
+			}
+
+		case "#EXT-X-DISCONTINUITY-SEQUENCE":
+			if playlist.DiscontinuitySequence, err = strconv.Atoi(value); err != nil {
+				return nil, fail("无效的 DISCONTINUITY-SEQUENCE %q", value)
+			}
+
+		case "#EXT-X-PLAYLIST-TYPE":
+			if value != "VOD" && value != "EVENT" {
+				return nil, fail("无效的 PLAYLIST-TYPE %q", value)
+			}
+			playlist.PlaylistType = value
+
+		case "#EXTINF":
+			if current != nil {
+				return nil, &ParseError{Line: currentLine, Msg: "#EXTINF 后缺少 URI"}
+			}
+			current, err = parseExtInf(value)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			currentLine = line.num
+
+		case "#EXT-X-KEY":
+			next, err := parseKey(value, base)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			// 同一批分片可以有多个不同 KEYFORMAT 的 #EXT-X-KEY，优先使用 identity 格式，
+			// 只有 DRM 格式时保留，由下载器判断是否支持
+			if !keyTags || usableKey(next) || !usableKey(key) {
+				key = next
+			}
+			keyTags = true
+
+		case "#EXT-X-MAP":
+			if initMap, err = parseMap(value, base); err != nil {
+				return nil, fail("%v", err)
+			}
+
+		case "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+
+		case "#EXT-X-ENDLIST":
+			playlist.EndList = true
+
+		case "#EXT-X-STREAM-INF", "#EXT-X-MEDIA":
+			return nil, fail("这是主播放列表，不是媒体播放列表")
+		}
+	}
+
+	if current != nil {
+		return nil, &ParseError{Line: currentLine, Msg: "#EXTINF 后缺少 URI"}
+	}
+
+	return playlist, nil
+}
+
+// parseExtInf 解析 "#EXTINF:<duration>,[<title>]"
+func parseExtInf(value string) (*Segment, error) {
+	durationText, title, _ := strings.Cut(value, ",")
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(durationText), 64)
+	if err != nil || duration < 0 {
+		return nil, fmt.Errorf("无效的分片时长 %q", durationText)
+	}
+
+	return &Segment{Duration: duration, Title: strings.TrimSpace(title)}, nil
+}
+
+// parseKey 解析 #EXT-X-KEY，METHOD=NONE 时返回 nil
+func parseKey(value string, base *url.URL) (*Key, error) {
+	attrs, err := parseAttributeList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	method := attrs["METHOD"]
+	switch method {
+	case "NONE":
+		return nil, nil
+	case "AES-128", "SAMPLE-AES", "SAMPLE-AES-CTR":
+	default:
+		return nil, fmt.Errorf("#EXT-X-KEY 的 METHOD 无效: %q", method)
+	}
+
+	uri, ok := attrs["URI"]
+	if !ok {
+		return nil, fmt.Errorf("#EXT-X-KEY 缺少 URI")
+	}
+
+	key := &Key{
+		Method:            method,
+		KeyFormat:         attrs["KEYFORMAT"],
+		KeyFormatVersions: attrs["KEYFORMATVERSIONS"],
+	}
+	if key.URL, err = resolveURL(base, uri); err != nil {
+		return nil, fmt.Errorf("无效的地址 %q", uri)
+	}
+
+	if key.IV, err = attrHex(attrs, "IV"); err != nil {
+		return nil, err
+	}
+	if key.IV != nil && len(key.IV) != 16 {
+		return nil, fmt.Errorf("IV 长度应为 16 字节，实际为 %d 字节", len(key.IV))
+	}
+
+	return key, nil
+}
+
+// usableKey 判断分片不加密（key 为 nil）或者使用 identity 格式的密钥
+func usableKey(key *Key) bool {
+	return key == nil || key.IsIdentity()
+}
+
+// parseMap 解析 #EXT-X-MAP
+func parseMap(value string, base *url.URL) (*Map, error) {
+	attrs, err := parseAttributeList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, ok := attrs["URI"]
+	if !ok {
+		return nil, fmt.Errorf("#EXT-X-MAP 缺少 URI")
+	}
+
+	m := &Map{ByteRange: attrs["BYTERANGE"]}
+	if m.URL, err = resolveURL(base, uri); err != nil {
+		return nil, fmt.Errorf("无效的地址 %q", uri)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,141 @@
+package m3u8
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMasterPlaylist(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="日本語",LANGUAGE="ja",DEFAULT=YES,AUTOSELECT=YES,URI="audio/ja.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",URI="/subs/en.m3u8"
+#EXT-X-STREAM-INF:RESOLUTION=1920x1080,BANDWIDTH=2000000,CODECS="avc1.640028,mp4a.40.2",AUDIO="aac",SUBTITLES="subs"
+1080p/index.m3u8?token=abc
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,FRAME-RATE=29.970
+https://cdn.example.com/720p.m3u8`
+
+	playlist, err := ParseMasterPlaylist(content, "https://example.com/hls/index.m3u8?session_id=xyz")
+	if err != nil {
+		t.Fatalf("解析主播放列表失败: %v", err)
+	}
+
+	if playlist.Version != 4 {
+		t.Errorf("版本号解析错误: %d", playlist.Version)
+	}
+
+	if len(playlist.Variants) != 2 {
+		t.Fatalf("期望解析出 2 个流，实际解析出 %d 个", len(playlist.Variants))
+	}
+	first := playlist.Variants[0]
+	if first.URL != "https://example.com/hls/1080p/index.m3u8?token=abc" {
+		t.Errorf("相对地址解析错误: %s", first.URL)
+	}
+	if first.Codecs != "avc1.640028,mp4a.40.2" || first.Resolution != "1920x1080" || first.Audio != "aac" {
+		t.Errorf("流属性解析错误: %+v", first)
+	}
+	if playlist.Variants[1].FrameRate != "29.970" {
+		t.Errorf("帧率解析错误: %s", playlist.Variants[1].FrameRate)
+	}
+
+	if len(playlist.Media) != 2 {
+		t.Fatalf("期望解析出 2 个备选流，实际解析出 %d 个", len(playlist.Media))
+	}
+	audio := playlist.Media[0]
+	if audio.Type != "AUDIO" || audio.Name != "日本語" || !audio.Default || audio.URL != "https://example.com/hls/audio/ja.m3u8" {
+		t.Errorf("音轨解析错误: %+v", audio)
+	}
+	if playlist.Media[1].URL != "https://example.com/subs/en.m3u8" {
+		t.Errorf("字幕地址解析错误: %s", playlist.Media[1].URL)
+	}
+}
+
+func TestParseMediaPlaylist(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:6.000,
+seg_100.ts
+#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/key?id=1",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:6.000,title
+seg_101.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:4.5,
+seg_102.ts
+#EXT-X-ENDLIST`
+
+	playlist, err := ParseMediaPlaylist(content, "https://example.com/hls/1080p/index.m3u8")
+	if err != nil {
+		t.Fatalf("解析媒体播放列表失败: %v", err)
+	}
+
+	if playlist.TargetDuration != 6 || playlist.MediaSequence != 100 || playlist.PlaylistType != "VOD" || !playlist.EndList {
+		t.Errorf("播放列表属性解析错误: %+v", playlist)
+	}
+
+	if len(playlist.Segments) != 3 {
+		t.Fatalf("期望解析出 3 个分片，实际解析出 %d 个", len(playlist.Segments))
+	}
+
+	seg0, seg1, seg2 := playlist.Segments[0], playlist.Segments[1], playlist.Segments[2]
+	if seg0.Sequence != 100 || seg0.URL != "https://example.com/hls/1080p/seg_100.ts" || seg0.Key != nil {
+		t.Errorf("第 1 个分片解析错误: %+v", seg0)
+	}
+	if seg0.Map == nil || seg0.Map.URL != "https://example.com/hls/1080p/init.mp4" {
+		t.Errorf("EXT-X-MAP 解析错误: %+v", seg0.Map)
+	}
+	if seg1.Key == nil || seg1.Key.Method != "AES-128" || len(seg1.Key.IV) != 16 || seg1.Title != "title" {
+		t.Errorf("第 2 个分片解析错误: %+v", seg1)
+	}
+	if seg2.Key != nil || !seg2.Discontinuity || seg2.Duration != 4.5 || seg2.Sequence != 102 {
+		t.Errorf("第 3 个分片解析错误: %+v", seg2)
+	}
+}
+
+// 同一批分片有多个 #EXT-X-KEY 时使用 identity 格式的密钥，只有 DRM 格式时保留 DRM 的密钥
+func TestParseMediaPlaylistKeyFormat(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="https://example.com/key?id=1",KEYFORMAT="identity"
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key1",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXTINF:6.000,
+seg_0.ts
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key2",KEYFORMAT="com.apple.streamingkeydelivery"
+#EXTINF:6.000,
+seg_1.ts
+#EXT-X-ENDLIST`
+
+	playlist, err := ParseMediaPlaylist(content, "https://example.com/hls/index.m3u8")
+	if err != nil {
+		t.Fatalf("解析媒体播放列表失败: %v", err)
+	}
+	if key := playlist.Segments[0].Key; key == nil || key.URL != "https://example.com/key?id=1" || !key.IsIdentity() {
+		t.Errorf("应使用 identity 格式的密钥: %+v", key)
+	}
+	if key := playlist.Segments[1].Key; key == nil || key.URL != "skd://key2" || key.IsIdentity() {
+		t.Errorf("只有 DRM 格式时应保留 DRM 的密钥: %+v", key)
+	}
+}
+
+func TestParseMediaPlaylistMalformed(t *testing.T) {
+	cases := map[string]string{
+		"缺少头":        "#EXTINF:6.0,\nseg.ts",
+		"缺少 URI":     "#EXTM3U\n#EXTINF:6.0,",
+		"无效时长":       "#EXTM3U\n#EXTINF:abc,\nseg.ts",
+		"KEY 缺少 URI": "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128\n#EXTINF:6.0,\nseg.ts",
+		"无效 IV":      "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x0102\n#EXTINF:6.0,\nseg.ts",
+		"主播放列表":      "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\na.m3u8",
+	}
+
+	for name, content := range cases {
+		_, err := ParseMediaPlaylist(content, "https://example.com/index.m3u8")
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s: 期望返回 ParseError，实际为 %v", name, err)
+		}
+	}
+}
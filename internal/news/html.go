@@ -1,6 +1,7 @@
 package news
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"io"
@@ -39,14 +40,19 @@ func determineThumbnailURL(article *Article, channelThumbnailURL string) string
 }
 
 // ProcessArticleWithOutputDir 处理文章并指定图片输出目录
-func ProcessArticleWithOutputDir(article *Article, templateHTML, outputDir string, channelThumbnailURL string) (string, error) {
+func ProcessArticleWithOutputDir(ctx context.Context, article *Article, templateHTML, outputDir string, channelThumbnailURL string) (string, error) {
+	return NewClient(client.Default()).ProcessArticleWithOutputDir(ctx, article, templateHTML, outputDir, channelThumbnailURL)
+}
+
+// ProcessArticleWithOutputDir 处理文章并指定图片输出目录，下载图片时使用 c 的平台作为 Referer
+func (c *Client) ProcessArticleWithOutputDir(ctx context.Context, article *Article, templateHTML, outputDir string, channelThumbnailURL string) (string, error) {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(templateHTML))
 	if err != nil {
 		return "", err
 	}
 
 	// 下载图片并替换URL
-	processedContents, err := downloadAndReplaceImages(article.Contents, outputDir)
+	processedContents, err := c.downloadAndReplaceImages(ctx, article.Contents, outputDir)
 	if err != nil {
 		return "", fmt.Errorf("处理图片时出错: %w", err)
 	}
@@ -54,7 +60,7 @@ func ProcessArticleWithOutputDir(article *Article, templateHTML, outputDir strin
 	// 根据布局策略确定缩略图URL并下载
 	thumbnailURL := determineThumbnailURL(article, channelThumbnailURL)
 	if thumbnailURL != "" {
-		thumbnailPath, err := downloadThumbnail(thumbnailURL, outputDir)
+		thumbnailPath, err := c.downloadThumbnail(ctx, thumbnailURL, outputDir)
 		if err != nil {
 			fmt.Printf("下载缩略图失败: %v\n", err)
 		} else {
@@ -80,7 +86,7 @@ func ProcessArticleWithOutputDir(article *Article, templateHTML, outputDir strin
 }
 
 // 下载图片并替换URL
-func downloadAndReplaceImages(contents, customOutputDir string) (string, error) {
+func (c *Client) downloadAndReplaceImages(ctx context.Context, contents, customOutputDir string) (string, error) {
 	// 先解码HTML实体
 	decodedContents := html.UnescapeString(contents)
 
@@ -100,14 +106,14 @@ func downloadAndReplaceImages(contents, customOutputDir string) (string, error)
 	}
 
 	// 创建HTTP客户端
-	client := &http.Client{
+	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
 	}
 
 	doc.Find("img").Each(func(i int, s *goquery.Selection) {
 		if src, exists := s.Attr("src"); exists {
 			// 下载图片并获取本地路径
-			localPath, err := downloadImage(client, src, outputDir)
+			localPath, err := c.downloadImage(ctx, httpClient, src, outputDir)
 			if err != nil {
 				fmt.Printf("下载图片失败 %s: %v\n", src, err)
 				return
@@ -123,19 +129,19 @@ func downloadAndReplaceImages(contents, customOutputDir string) (string, error)
 }
 
 // 下载单个图片
-func downloadImage(c *http.Client, imageURL, outputDir string) (string, error) {
+func (c *Client) downloadImage(ctx context.Context, httpClient *http.Client, imageURL, outputDir string) (string, error) {
 
 	// 创建请求
-	req, err := http.NewRequest("GET", imageURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	// 添加Referer头
-	req.Header.Set("Referer", fmt.Sprintf("https://%s/", client.CurrentPlatform.Domain))
+	req.Header.Set("Referer", fmt.Sprintf("https://%s/", c.Platform.Domain))
 
 	// 发送HTTP请求
-	resp, err := c.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("请求图片失败: %w", err)
 	}
@@ -241,23 +247,23 @@ func replaceButtonTags(contents string) string {
 }
 
 // downloadThumbnail 下载缩略图
-func downloadThumbnail(thumbnailURL, outputDir string) (string, error) {
+func (c *Client) downloadThumbnail(ctx context.Context, thumbnailURL, outputDir string) (string, error) {
 	// 创建HTTP客户端
-	c := &http.Client{
+	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
 	}
 
 	// 创建请求
-	req, err := http.NewRequest("GET", thumbnailURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", thumbnailURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	// 添加Referer头
-	req.Header.Set("Referer", fmt.Sprintf("https://%s/", client.CurrentPlatform.Domain))
+	req.Header.Set("Referer", fmt.Sprintf("https://%s/", c.Platform.Domain))
 
 	// 发送HTTP请求
-	resp, err := c.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("请求缩略图失败: %w", err)
 	}
@@ -1,9 +1,11 @@
 package news
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
+	"ncpd/internal/auth"
 	"ncpd/internal/client"
 )
 
@@ -34,6 +36,16 @@ type ArticleResponse struct {
 	} `json:"data"`
 }
 
+// Client 使用指定平台的 API 客户端获取新闻
+type Client struct {
+	*client.Client
+}
+
+// NewClient 创建使用 c 的新闻客户端，获取会员限定文章时 c.Tokens 不能为空
+func NewClient(c *client.Client) *Client {
+	return &Client{Client: c}
+}
+
 // ArticlesResponse 文章列表响应结构体
 type ArticlesResponse struct {
 	Data struct {
@@ -47,8 +59,23 @@ type ArticlesResponse struct {
 }
 
 // 返回的 article.contents 不是原文，原文需要用 GetArticle 获取
-func GetArticleList(fcSiteID int) ([]Article, error) {
-	client := client.Get()
+func GetArticleList(ctx context.Context, fcSiteID int) ([]Article, error) {
+	return NewClient(client.Default()).GetArticleList(ctx, fcSiteID)
+}
+
+// GetArticleListUntil 按发布时间从新到旧获取频道的文章，每获取一页后调用 stop，返回 true 时不再获取后面的页
+func GetArticleListUntil(ctx context.Context, fcSiteID int, stop func(page []Article) bool) ([]Article, error) {
+	return NewClient(client.Default()).GetArticleListUntil(ctx, fcSiteID, stop)
+}
+
+// GetArticleList 获取频道的所有文章，返回的 article.contents 不是原文
+func (c *Client) GetArticleList(ctx context.Context, fcSiteID int) ([]Article, error) {
+	return c.GetArticleListUntil(ctx, fcSiteID, nil)
+}
+
+// GetArticleListUntil 按发布时间从新到旧获取频道的文章，每获取一页后调用 stop，返回 true 时不再获取后面的页
+// stop 为 nil 时获取所有文章
+func (c *Client) GetArticleListUntil(ctx context.Context, fcSiteID int, stop func(page []Article) bool) ([]Article, error) {
 	page := 1
 	size := 24
 
@@ -59,7 +86,7 @@ func GetArticleList(fcSiteID int) ([]Article, error) {
 	for {
 		var articlesResponse ArticlesResponse
 
-		_, err := client.R().
+		_, err := c.R(ctx).
 			SetHeader("fc_use_device", "null").
 			SetPathParam("fcSiteId", strconv.Itoa(fcSiteID)).
 			SetPathParam("size", strconv.Itoa(size)).
@@ -89,21 +116,28 @@ func GetArticleList(fcSiteID int) ([]Article, error) {
 			break
 		}
 
+		if stop != nil && stop(articlesResponse.Data.ArticleTheme.Articles.List) {
+			fmt.Printf("第 %d 页之后的文章已经获取过，停止获取\n", page)
+			break
+		}
+
 		page++
 	}
 
 	return allArticles, nil
 }
 
-// 要带 token，不然会员内容 contents 会返回空
-func GetArticle(fcSiteID int, articleCode string, token string) (*Article, error) {
-	client := client.Get()
+// 要带 token，不然会员内容 contents 会返回空，token 由 auth.R 自动设置
+func GetArticle(ctx context.Context, fcSiteID int, articleCode string) (*Article, error) {
+	return NewClient(auth.DefaultClient()).GetArticle(ctx, fcSiteID, articleCode)
+}
 
+// GetArticle 获取文章原文，会员限定内容需要 c.Tokens
+func (c *Client) GetArticle(ctx context.Context, fcSiteID int, articleCode string) (*Article, error) {
 	var articleResponse ArticleResponse
 
-	_, err := client.R().
+	_, err := c.AuthR(ctx).
 		SetHeader("fc_use_device", "null").
-		SetAuthToken(token).
 		SetPathParam("fcSiteId", strconv.Itoa(fcSiteID)).
 		SetPathParam("articleCode", articleCode).
 		SetResult(&articleResponse).
@@ -1,75 +1,44 @@
 package news
 
 import (
+	"context"
 	"testing"
 
-	"ncpd/internal/auth"
+	"ncpd/internal/fakeapi"
 )
 
 // go test -v ./internal/news
 func TestNewsAPI(t *testing.T) {
-	fcSiteID := 387
+	c := NewClient(fakeapi.New(t).Client())
 
-	// 1. 获取文章列表
-	t.Log("🔍 正在获取文章列表...")
-	articles, err := GetArticleList(fcSiteID)
+	articles, err := c.GetArticleList(context.Background(), fakeapi.SiteID)
 	if err != nil {
 		t.Fatalf("获取文章列表失败: %v", err)
 	}
-
-	if len(articles) == 0 {
-		t.Log("获取到的文章列表为空")
-		return
+	if len(articles) != fakeapi.ArticleCount {
+		t.Fatalf("期望 %d 篇文章，实际 %d 篇", fakeapi.ArticleCount, len(articles))
 	}
-
-	t.Logf("✅ 成功获取到 %d 篇文章", len(articles))
-
-	// 2. 输出每篇文章的基本信息
-	t.Log("📋 文章列表:")
 	for i, article := range articles {
-		t.Logf("  %d. [%s] %s", i+1, article.ArticleCode, article.ArticelTitle)
-
-		// 验证文章结构
-		if article.ArticleCode == "" {
-			t.Errorf("文章 %d 的 ArticleCode 为空", i+1)
-		}
-		if article.ArticelTitle == "" {
-			t.Errorf("文章 %d 的标题为空", i+1)
+		if article.ArticleCode == "" || article.ArticelTitle == "" {
+			t.Errorf("文章 %d 信息不完整: %+v", i+1, article)
 		}
 	}
 
-	// 3. 获取第一篇文章的详细信息
-	t.Log("📄 正在获取第一篇文章的详细信息...")
-
-	// 获取 token
-	token, err := auth.GetToken()
-	if err != nil {
-		t.Fatal("获取Token失败:", err)
-	}
-
-	// 获取第一篇文章的详细信息
-	article, err := GetArticle(fcSiteID, articles[0].ArticleCode, token)
+	article, err := c.GetArticle(context.Background(), fakeapi.SiteID, articles[0].ArticleCode)
 	if err != nil {
 		t.Fatalf("获取文章详情失败: %v", err)
 	}
-
-	// 验证文章详情
-	if article.ArticelTitle == "" {
-		t.Error("文章标题不应为空")
+	if article.ArticleCode != fakeapi.ArticleCode || article.Contents == "" {
+		t.Errorf("文章详情错误: %+v", article)
 	}
 
-	if article.Contents == "" {
-		t.Error("文章内容不应为空")
+	// 没有 token 时会员限定内容为空
+	c.Tokens = nil
+	article, err = c.GetArticle(context.Background(), fakeapi.SiteID, fakeapi.ArticleCode)
+	if err != nil {
+		t.Fatalf("获取文章详情失败: %v", err)
 	}
-
-	// 4. 输出文章详情信息
-	t.Logf("✅ 成功获取文章详情:")
-	t.Logf("  标题: %s", article.ArticelTitle)
-	t.Logf("  发布时间: %s", article.PublishAt)
-	t.Logf("  内容长度: %d 字符", len(article.Contents))
-	if len(article.Contents) > 100 {
-		t.Logf("  内容预览: %s...", article.Contents[:100])
-	} else {
-		t.Logf("  内容: %s", article.Contents)
+	if article.Contents != "" {
+		t.Errorf("没有 token 时不应返回会员限定内容")
 	}
 }
@@ -0,0 +1,163 @@
+// Package nfo 生成 Kodi / Jellyfin 等媒体库使用的 NFO 元数据
+//
+// 频道对应一部剧集（tvshow.nfo），每个视频对应一集（与视频同名的 .nfo）
+package nfo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ncpd/internal/channel"
+	"ncpd/internal/video"
+)
+
+// ShowFile 频道目录中剧集元数据的文件名
+const ShowFile = "tvshow.nfo"
+
+// 频道目录中剧集的海报和背景图的文件名
+const (
+	PosterFile = "poster.jpg"
+	FanartFile = "fanart.jpg"
+)
+
+// Thumb 图片的地址，aspect 为 poster、thumb、clearlogo 等
+type Thumb struct {
+	Aspect string `xml:"aspect,attr,omitempty"`
+	URL    string `xml:",chardata"`
+}
+
+// UniqueID 内容在平台上的 ID
+type UniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr"`
+	ID      string `xml:",chardata"`
+}
+
+// Fanart 背景图
+type Fanart struct {
+	Thumbs []Thumb `xml:"thumb"`
+}
+
+// TVShow 频道的元数据，保存为频道目录中的 tvshow.nfo
+type TVShow struct {
+	XMLName  xml.Name `xml:"tvshow"`
+	Title    string   `xml:"title"`
+	Plot     string   `xml:"plot,omitempty"`
+	Studio   string   `xml:"studio,omitempty"`
+	UniqueID UniqueID `xml:"uniqueid"`
+	Thumbs   []Thumb  `xml:"thumb"`
+	Fanart   *Fanart  `xml:"fanart,omitempty"`
+}
+
+// Episode 视频的元数据，保存为与视频同名的 .nfo
+type Episode struct {
+	XMLName   xml.Name `xml:"episodedetails"`
+	Title     string   `xml:"title"`
+	ShowTitle string   `xml:"showtitle,omitempty"`
+	Plot      string   `xml:"plot,omitempty"`
+	Runtime   int      `xml:"runtime,omitempty"` // 分钟
+	Thumbs    []Thumb  `xml:"thumb"`
+	UniqueID  UniqueID `xml:"uniqueid"`
+	Aired     string   `xml:"aired,omitempty"`
+	Premiered string   `xml:"premiered,omitempty"`
+	Year      int      `xml:"year,omitempty"`
+	Studio    string   `xml:"studio,omitempty"`
+}
+
+// NewTVShow 根据频道信息生成剧集的元数据，platform 为平台的 Key
+func NewTVShow(info *channel.FanclubSiteInfo, platform string, fcSiteID int) *TVShow {
+	show := &TVShow{
+		Title:    info.FanclubSiteName,
+		Plot:     PlainText(info.Description),
+		Studio:   info.FanclubSiteName,
+		UniqueID: UniqueID{Type: platform, Default: true, ID: strconv.Itoa(fcSiteID)},
+	}
+	if info.ThumbnailImageURL != "" {
+		show.Thumbs = append(show.Thumbs, Thumb{Aspect: "poster", URL: info.ThumbnailImageURL})
+		show.Fanart = &Fanart{Thumbs: []Thumb{{URL: info.ThumbnailImageURL}}}
+	}
+	if info.FaviconURL != "" {
+		show.Thumbs = append(show.Thumbs, Thumb{Aspect: "clearlogo", URL: info.FaviconURL})
+	}
+	return show
+}
+
+// NewEpisode 根据视频详情生成一集的元数据，showTitle 为频道名，platform 为平台的 Key
+// 简介中附加播放数，媒体库没有对应的字段
+func NewEpisode(v *video.VideoDetails, showTitle string, platform string) *Episode {
+	episode := &Episode{
+		Title:     v.Title,
+		ShowTitle: showTitle,
+		Plot:      PlainText(v.Description),
+		UniqueID:  UniqueID{Type: platform, Default: true, ID: v.ContentCode},
+		Studio:    showTitle,
+	}
+	if v.ActiveVideoFilename != nil && v.ActiveVideoFilename.Length > 0 {
+		// 不足一分钟的按一分钟
+		episode.Runtime = (v.ActiveVideoFilename.Length + 59) / 60
+	}
+	if v.ThumbnailURL != "" {
+		episode.Thumbs = []Thumb{{Aspect: "thumb", URL: v.ThumbnailURL}}
+	}
+
+	// 显示日期为频道中显示的日期，没有时使用公开日期
+	date := v.DisplayDate
+	if date == "" {
+		date = v.ReleasedAt
+	}
+	if day, _, _ := strings.Cut(date, " "); len(day) == len("2006-01-02") {
+		episode.Aired, episode.Premiered = day, day
+		episode.Year, _ = strconv.Atoi(day[:4])
+	}
+
+	if v.VideoAggregateInfo != nil && v.VideoAggregateInfo.TotalViews > 0 {
+		views := fmt.Sprintf("播放数: %d", v.VideoAggregateInfo.TotalViews)
+		if episode.Plot == "" {
+			episode.Plot = views
+		} else {
+			episode.Plot += "\n\n" + views
+		}
+	}
+	return episode
+}
+
+var (
+	lineBreakTags = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	tags          = regexp.MustCompile(`<[^>]*>`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// PlainText 将视频和频道简介中的 HTML 转换为纯文本，保留换行
+func PlainText(s string) string {
+	s = lineBreakTags.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(tags.ReplaceAllString(s, ""))
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.TrimSpace(blankLines.ReplaceAllString(s, "\n\n"))
+}
+
+// Write 将元数据保存为 path，先写入临时文件再替换，避免留下不完整的文件
+func Write(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("生成 NFO 失败: %w", err)
+	}
+	data = append([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"), data...)
+	data = append(data, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("保存 NFO 失败: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("保存 NFO 失败: %w", err)
+	}
+	return nil
+}
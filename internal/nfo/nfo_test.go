@@ -0,0 +1,69 @@
+package nfo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ncpd/internal/channel"
+	"ncpd/internal/video"
+)
+
+// go test -v ./internal/nfo
+func TestEpisode(t *testing.T) {
+	v := &video.VideoDetails{
+		ContentCode:         "sm1",
+		Title:               "テスト & 動画",
+		Description:         "<p>一行目<br>二行目</p><p>&lt;三行目&gt;</p>",
+		DisplayDate:         "2024-03-12 20:00:00",
+		ThumbnailURL:        "https://example.com/thumb.jpg",
+		ActiveVideoFilename: &video.ActiveVideoFilename{Length: 3601},
+		VideoAggregateInfo:  &video.VideoAggregateInfo{TotalViews: 1234},
+	}
+	episode := NewEpisode(v, "テストチャンネル", "nicochannel")
+	if episode.Plot != "一行目\n二行目\n<三行目>\n\n播放数: 1234" {
+		t.Errorf("简介错误: %q", episode.Plot)
+	}
+	if episode.Runtime != 61 || episode.Aired != "2024-03-12" || episode.Year != 2024 {
+		t.Errorf("时长或日期错误: %+v", episode)
+	}
+
+	path := filepath.Join(t.TempDir(), "動画", "テスト.nfo")
+	if err := Write(path, episode); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`,
+		"<episodedetails>",
+		"<title>テスト &amp; 動画</title>",
+		`<uniqueid type="nicochannel" default="true">sm1</uniqueid>`,
+		`<thumb aspect="thumb">https://example.com/thumb.jpg</thumb>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("NFO 中没有 %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestTVShow(t *testing.T) {
+	show := NewTVShow(&channel.FanclubSiteInfo{
+		FanclubSiteName:   "テストチャンネル",
+		Description:       "テスト用のチャンネルです。",
+		FaviconURL:        "https://example.com/favicon.ico",
+		ThumbnailImageURL: "https://example.com/channel.jpg",
+	}, "nicochannel", 387)
+
+	if show.UniqueID.ID != "387" || show.Fanart == nil || len(show.Thumbs) != 2 || show.Thumbs[0].Aspect != "poster" {
+		t.Errorf("剧集元数据错误: %+v", show)
+	}
+
+	// 没有封面时不生成图片
+	if show := NewTVShow(&channel.FanclubSiteInfo{FanclubSiteName: "テスト"}, "nicochannel", 387); show.Fanart != nil || len(show.Thumbs) != 0 {
+		t.Errorf("没有封面时不应有图片: %+v", show)
+	}
+}
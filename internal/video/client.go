@@ -0,0 +1,89 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ncpd/internal/client"
+)
+
+// DefaultCommentsURL 弹幕 API 的地址
+const DefaultCommentsURL = "https://comm-api.sheeta.com"
+
+// Client 使用指定平台的 API 客户端获取视频信息
+type Client struct {
+	*client.Client
+	CommentsURL string // 弹幕 API 地址
+}
+
+// NewClient 创建使用 c 的视频客户端
+func NewClient(c *client.Client) *Client {
+	return &Client{Client: c, CommentsURL: DefaultCommentsURL}
+}
+
+func GetVideoList(ctx context.Context, fcSiteID int) ([]VideoDetails, error) {
+	return NewClient(client.Default()).GetVideoList(ctx, fcSiteID)
+}
+
+func GetVideoListUntil(ctx context.Context, fcSiteID int, stop func(page []VideoDetails) bool) ([]VideoDetails, error) {
+	return NewClient(client.Default()).GetVideoListUntil(ctx, fcSiteID, stop)
+}
+
+func GetVideoDetails(ctx context.Context, fcSiteID int, contentCode string) (*VideoDetails, error) {
+	return NewClient(client.Default()).GetVideoDetails(ctx, fcSiteID, contentCode)
+}
+
+func GetCommentsUserToken(ctx context.Context, videoID string) (string, error) {
+	return NewClient(client.Default()).GetCommentsUserToken(ctx, videoID)
+}
+
+func GetComments(ctx context.Context, commentsUserToken string, groupID string, startTime int) ([]Message, error) {
+	return NewClient(client.Default()).GetComments(ctx, commentsUserToken, groupID, startTime)
+}
+
+func GetAllComments(ctx context.Context, commentsUserToken string, groupId string) ([]Message, error) {
+	return NewClient(client.Default()).GetAllComments(ctx, commentsUserToken, groupId)
+}
+
+func WaitLiveStart(ctx context.Context, fcSiteID int, contentCode string, interval time.Duration, onWait func(*VideoDetails)) (*VideoDetails, error) {
+	return NewClient(client.Default()).WaitLiveStart(ctx, fcSiteID, contentCode, interval, onWait)
+}
+
+func RecordLiveChat(ctx context.Context, fcSiteID int, contentCode string, path string, options LiveChatOptions) (int, error) {
+	return NewClient(client.Default()).RecordLiveChat(ctx, fcSiteID, contentCode, path, options)
+}
+
+type SessionIDResponse struct {
+	Data struct {
+		SessionID string `json:"session_id"`
+	} `json:"data"`
+}
+
+// GetSessionID 获取视频的 session_id，需要登录，c.Tokens 不能为空
+func (c *Client) GetSessionID(ctx context.Context, videoID string) (string, error) {
+	var sessionIDResponse SessionIDResponse
+
+	// 只获取播放使用的 session_id，重复请求没有副作用，失败时可以安全地重试
+	_, err := c.AuthR(client.WithRetry(ctx)).
+		SetHeader("fc_use_device", "null").
+		SetHeader("Origin", fmt.Sprintf("https://%s", c.Platform.Domain)).
+		SetPathParam("videoId", videoID).
+		SetBody(map[string]string{}).
+		SetResult(&sessionIDResponse).
+		Post("/video_pages/{videoId}/session_ids")
+
+	if err != nil {
+		var httpErr *client.HTTPError
+		if errors.As(err, &httpErr) {
+			if httpErr.StatusCode == http.StatusForbidden {
+				return "", fmt.Errorf("状态码 %d - 会员限定内容", httpErr.StatusCode)
+			}
+		}
+		return "", err
+	}
+
+	return sessionIDResponse.Data.SessionID, nil
+}
@@ -0,0 +1,28 @@
+package video
+
+import (
+	"context"
+	"testing"
+
+	"ncpd/internal/fakeapi"
+)
+
+// go test -v ./internal/video -run TestGetSessionID
+func TestGetSessionID(t *testing.T) {
+	fake := fakeapi.New(t)
+	c := NewClient(fake.Client())
+
+	sessionID, err := c.GetSessionID(context.Background(), fakeapi.VideoCode)
+	if err != nil {
+		t.Fatalf("获取 sessionID 失败: %v", err)
+	}
+	if sessionID != fakeapi.SessionID {
+		t.Errorf("期望 sessionID %s，实际 %s", fakeapi.SessionID, sessionID)
+	}
+
+	// 没有 token 时服务器返回 401
+	c.Tokens = nil
+	if _, err := c.GetSessionID(context.Background(), fakeapi.VideoCode); err == nil {
+		t.Error("没有 token 时应返回错误")
+	}
+}
@@ -1,6 +1,7 @@
 package video
 
 import (
+	"context"
 	"sort"
 	"strconv"
 	"time"
@@ -8,6 +9,9 @@ import (
 	"ncpd/internal/client"
 )
 
+// commentsPageSize GetComments 每次最多获取的弹幕数
+const commentsPageSize = 120
+
 type CommentsUserTokenResponse struct {
 	Data struct {
 		AccessToken string `json:"access_token"`
@@ -29,11 +33,10 @@ type Message struct {
 	UpdatedAt        time.Time `json:"updated_at"`          // 更新时间
 }
 
-func GetCommentsUserToken(videoID string) (string, error) {
-	client := client.Get()
-
+// GetCommentsUserToken 获取读取弹幕使用的 token
+func (c *Client) GetCommentsUserToken(ctx context.Context, videoID string) (string, error) {
 	var commentsUserTokenResponse CommentsUserTokenResponse
-	_, err := client.R().
+	_, err := c.R(ctx).
 		SetPathParam("videoId", videoID).
 		SetResult(&commentsUserTokenResponse).
 		Get("/video_pages/{videoId}/comments_user_token")
@@ -45,22 +48,20 @@ func GetCommentsUserToken(videoID string) (string, error) {
 	return commentsUserTokenResponse.Data.AccessToken, nil
 }
 
-func GetComments(commentsUserToken string, groupID string, startTime int) ([]Message, error) {
-	client := client.Get()
-
-	limit := 120
-
+// GetComments 获取从 startTime 开始的一批弹幕
+func (c *Client) GetComments(ctx context.Context, commentsUserToken string, groupID string, startTime int) ([]Message, error) {
 	var commentsResponse []Message
-	_, err := client.R().
+	// 只读取弹幕，失败时可以安全地重试，避免一次临时错误中断整个分页
+	_, err := c.R(client.WithRetry(ctx)).
 		SetHeader("content-type", "application/json").
 		SetPathParam("startTime", strconv.Itoa(startTime)).
-		SetPathParam("limit", strconv.Itoa(limit)).
+		SetPathParam("limit", strconv.Itoa(commentsPageSize)).
 		SetBody(map[string]string{
 			"token":    commentsUserToken,
 			"group_id": groupID,
 		}).
 		SetResult(&commentsResponse).
-		Post("https://comm-api.sheeta.com/messages.history?oldest_playback_time={startTime}&sort_direction=asc&limit={limit}&inclusive=true")
+		Post(c.CommentsURL + "/messages.history?oldest_playback_time={startTime}&sort_direction=asc&limit={limit}&inclusive=true")
 
 	if err != nil {
 		return nil, err
@@ -69,14 +70,15 @@ func GetComments(commentsUserToken string, groupID string, startTime int) ([]Mes
 	return commentsResponse, nil
 }
 
-func GetAllComments(commentsUserToken string, groupId string) ([]Message, error) {
+// GetAllComments 获取视频的所有弹幕，按 PlaybackTime 排序
+func (c *Client) GetAllComments(ctx context.Context, commentsUserToken string, groupId string) ([]Message, error) {
 	msgSet := make(map[string]Message)
 	startTime := 0
 	count := 0
 
 	for {
 		// 获取一批评论
-		comments, err := GetComments(commentsUserToken, groupId, startTime)
+		comments, err := c.GetComments(ctx, commentsUserToken, groupId, startTime)
 		if err != nil {
 			return nil, err
 		}
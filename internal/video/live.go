@@ -0,0 +1,45 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLiveFinished 表示生放送已经结束，只能下载アーカイブ
+var ErrLiveFinished = errors.New("生放送已经结束")
+
+// IsLive 判断是否为正在进行的生放送，即已经开始并且还没有结束
+func (v *VideoDetails) IsLive() bool {
+	return v.LiveStartedAt != nil && v.LiveFinishedAt == nil
+}
+
+// WaitLiveStart 等待生放送开始，每隔 interval 检查一次，开始后返回最新的视频详情
+// 直播已经结束时返回 ErrLiveFinished；onWait 在每次检查到直播还没有开始时调用，可为空
+func (c *Client) WaitLiveStart(ctx context.Context, fcSiteID int, contentCode string, interval time.Duration, onWait func(*VideoDetails)) (*VideoDetails, error) {
+	for {
+		details, err := c.GetVideoDetails(ctx, fcSiteID, contentCode)
+		if err != nil {
+			return nil, fmt.Errorf("获取视频详情失败: %w", err)
+		}
+		if details.LiveFinishedAt != nil {
+			return nil, ErrLiveFinished
+		}
+		if details.LiveStartedAt != nil {
+			return details, nil
+		}
+		if details.LiveScheduledStartAt == nil {
+			return nil, fmt.Errorf("视频 %s 不是生放送", contentCode)
+		}
+
+		if onWait != nil {
+			onWait(details)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ncpd/internal/fakeapi"
+)
+
+// go test -v ./internal/video -run TestWaitLiveStart
+func TestWaitLiveStart(t *testing.T) {
+	fake := fakeapi.New(t)
+	c := NewClient(fake.Client())
+	fake.ScheduleLive()
+
+	// 第二次检查时直播开始
+	var waits int
+	details, err := c.WaitLiveStart(context.Background(), fakeapi.SiteID, fakeapi.LiveCode, 10*time.Millisecond, func(d *VideoDetails) {
+		waits++
+		if d.LiveScheduledStartAt == nil {
+			t.Error("等待时应返回预定开始时间")
+		}
+		fake.StartLive()
+	})
+	if err != nil {
+		t.Fatalf("等待直播开始失败: %v", err)
+	}
+	if waits != 1 || !details.IsLive() {
+		t.Errorf("期望等待 1 次后直播开始，实际等待 %d 次，直播中: %v", waits, details.IsLive())
+	}
+
+	fake.FinishLive()
+	if _, err := c.WaitLiveStart(context.Background(), fakeapi.SiteID, fakeapi.LiveCode, time.Millisecond, nil); !errors.Is(err, ErrLiveFinished) {
+		t.Errorf("已结束的直播应返回 ErrLiveFinished，实际 %v", err)
+	}
+	if _, err := c.WaitLiveStart(context.Background(), fakeapi.SiteID, fakeapi.VideoCode, time.Millisecond, nil); err == nil {
+		t.Error("不是生放送的视频应返回错误")
+	}
+}
@@ -0,0 +1,211 @@
+package video
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// LiveChatOptions 录制直播弹幕的参数，零值表示使用默认值
+type LiveChatOptions struct {
+	PollInterval   time.Duration // 获取新弹幕的间隔，默认 5 秒
+	StatusInterval time.Duration // 检查直播是否结束的间隔，默认 1 分钟
+	OnMessage      func(Message) // 每记录一条新弹幕时调用，可以为空
+}
+
+const (
+	defaultLivePollInterval   = 5 * time.Second
+	defaultLiveStatusInterval = time.Minute
+	maxLivePollFailures       = 5 // 连续获取失败超过该次数时停止录制
+)
+
+func (o LiveChatOptions) withDefaults() LiveChatOptions {
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultLivePollInterval
+	}
+	if o.StatusInterval <= 0 {
+		o.StatusInterval = defaultLiveStatusInterval
+	}
+	return o
+}
+
+// liveChat 正在录制的直播弹幕
+type liveChat struct {
+	client    *Client
+	token     string
+	groupID   string
+	seen      map[string]bool // 已经写入文件的弹幕 ID
+	startTime int             // 下一次获取弹幕的 oldest_playback_time
+}
+
+// RecordLiveChat 在直播进行中实时录制弹幕，按 ID 去重后追加到 JSONL 文件 path 中，每行一条 Message
+// 弹幕在获取到时立即写入，之后被管理员删除的弹幕也会保留；文件已存在时跳过已经记录的弹幕继续录制
+// 直播结束后再获取一次剩余的弹幕并返回，ctx 取消时返回 ctx.Err()；recorded 为本次新记录的条数
+func (c *Client) RecordLiveChat(ctx context.Context, fcSiteID int, contentCode string, path string, options LiveChatOptions) (recorded int, err error) {
+	options = options.withDefaults()
+
+	details, err := c.GetVideoDetails(ctx, fcSiteID, contentCode)
+	if err != nil {
+		return 0, fmt.Errorf("获取视频详情失败: %w", err)
+	}
+	if !details.IsLive() {
+		return 0, fmt.Errorf("视频 %s 不是正在进行的生放送", contentCode)
+	}
+	if details.VideoCommentSetting == nil || details.VideoCommentSetting.CommentGroupID == "" {
+		return 0, fmt.Errorf("视频没有评论设置或评论组ID为空")
+	}
+
+	token, err := c.GetCommentsUserToken(ctx, contentCode)
+	if err != nil {
+		return 0, fmt.Errorf("获取评论用户token失败: %w", err)
+	}
+
+	chat := &liveChat{client: c, token: token, groupID: details.VideoCommentSetting.CommentGroupID}
+	file, err := chat.open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	ticker := time.NewTicker(options.PollInterval)
+	defer ticker.Stop()
+	lastStatus := time.Now()
+	finished := false
+	failures := 0
+
+	for {
+		messages, err := chat.fetch(ctx)
+		for _, message := range messages {
+			if err := writeLiveMessage(file, message); err != nil {
+				return recorded, fmt.Errorf("写入弹幕失败: %w", err)
+			}
+			chat.seen[message.ID] = true
+			recorded++
+			if options.OnMessage != nil {
+				options.OnMessage(message)
+			}
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return recorded, ctx.Err()
+			}
+			failures++
+			if failures > maxLivePollFailures {
+				return recorded, fmt.Errorf("获取弹幕失败: %w", err)
+			}
+			// token 可能已经过期，下一次使用新的 token
+			if token, err := c.GetCommentsUserToken(ctx, contentCode); err == nil {
+				chat.token = token
+			}
+		} else {
+			failures = 0
+			if finished {
+				return recorded, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return recorded, ctx.Err()
+		case <-ticker.C:
+		}
+
+		// 直播结束后还要再获取一次，才能拿到结束前最后发送的弹幕
+		if !finished && time.Since(lastStatus) >= options.StatusInterval {
+			lastStatus = time.Now()
+			if details, err := c.GetVideoDetails(ctx, fcSiteID, contentCode); err == nil && !details.IsLive() {
+				finished = true
+			}
+		}
+	}
+}
+
+// open 打开用于追加的 JSONL 文件，读取已经记录的弹幕，从最后一条弹幕的时间点继续获取
+func (l *liveChat) open(path string) (*os.File, error) {
+	l.seen = make(map[string]bool)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开弹幕文件失败: %w", err)
+	}
+
+	// 上次录制中断时最后一行可能不完整，跳过无法解析的行
+	var lastByte byte
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lastByte = line[len(line)-1]
+			var message Message
+			if json.Unmarshal(line, &message) == nil && message.ID != "" {
+				l.seen[message.ID] = true
+				l.startTime = max(l.startTime, message.PlaybackTime)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("读取弹幕文件失败: %w", err)
+		}
+	}
+
+	// 保证新的弹幕从新的一行开始
+	if lastByte != 0 && lastByte != '\n' {
+		if _, err := file.Write([]byte{'\n'}); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("写入弹幕失败: %w", err)
+		}
+	}
+	return file, nil
+}
+
+// fetch 获取 startTime 之后还没有记录的弹幕，一次返回的弹幕达到上限时继续获取下一批
+func (l *liveChat) fetch(ctx context.Context) ([]Message, error) {
+	var messages []Message
+	pending := make(map[string]bool)
+
+	for {
+		comments, err := l.client.GetComments(ctx, l.token, l.groupID, l.startTime)
+		if err != nil {
+			return messages, err
+		}
+
+		newCount := 0
+		for _, comment := range comments {
+			if l.seen[comment.ID] || pending[comment.ID] {
+				continue
+			}
+			pending[comment.ID] = true
+			messages = append(messages, comment)
+			newCount++
+		}
+		if len(comments) == 0 {
+			return messages, nil
+		}
+
+		// 因为 inclusive=true 所以同一时间点的弹幕会再次返回，由 seen 去重
+		nextStartTime := comments[len(comments)-1].PlaybackTime
+		done := len(comments) < commentsPageSize || (nextStartTime == l.startTime && newCount == 0)
+		l.startTime = nextStartTime
+		if done {
+			return messages, nil
+		}
+	}
+}
+
+// writeLiveMessage 将一条弹幕作为一行 JSON 写入 w
+func writeLiveMessage(w io.Writer, message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
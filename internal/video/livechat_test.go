@@ -0,0 +1,163 @@
+package video
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ncpd/internal/fakeapi"
+)
+
+// readLiveChat 读取 JSONL 文件中的弹幕 ID
+func readLiveChat(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开弹幕文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("无效的一行 %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+// waitMessage 等待录制到 id 对应的弹幕
+func waitMessage(t *testing.T, received <-chan Message, id string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-received:
+			if message.ID == id {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("等待弹幕 %s 超时", id)
+		}
+	}
+}
+
+// go test -v ./internal/video -run TestRecordLiveChat
+func TestRecordLiveChat(t *testing.T) {
+	fake := fakeapi.New(t)
+	c := NewClient(fake.Client())
+	c.CommentsURL = fake.CommentsURL()
+	path := filepath.Join(t.TempDir(), "live_chat.jsonl")
+
+	received := make(chan Message, 10)
+	options := LiveChatOptions{
+		PollInterval:   10 * time.Millisecond,
+		StatusInterval: 10 * time.Millisecond,
+		OnMessage:      func(m Message) { received <- m },
+	}
+
+	fake.PostLiveMessage("live-1", "こんばんは", 0)
+	fake.PostLiveMessage("live-2", "わこつ", 1)
+
+	done := make(chan error, 1)
+	var recorded int
+	go func() {
+		var err error
+		recorded, err = c.RecordLiveChat(context.Background(), fakeapi.SiteID, fakeapi.LiveCode, path, options)
+		done <- err
+	}()
+	waitMessage(t, received, "live-2")
+
+	// 录制之后被删除的弹幕仍然保留
+	fake.PostLiveMessage("live-3", "荒らし", 5)
+	waitMessage(t, received, "live-3")
+	fake.DeleteLiveMessage("live-3")
+	fake.PostLiveMessage("live-4", "888", 5)
+
+	// 直播结束前最后发送的弹幕也会被记录
+	fake.PostLiveMessage("live-5", "おつ", 7200)
+	fake.FinishLive()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("录制弹幕失败: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("直播结束后应停止录制")
+	}
+
+	expected := []string{"live-1", "live-2", "live-3", "live-4", "live-5"}
+	if recorded != len(expected) {
+		t.Errorf("期望记录 %d 条，实际 %d 条", len(expected), recorded)
+	}
+	ids := readLiveChat(t, path)
+	if len(ids) != len(expected) {
+		t.Fatalf("期望文件中有 %v，实际 %v", expected, ids)
+	}
+	for i, id := range ids {
+		if id != expected[i] {
+			t.Errorf("第 %d 条弹幕期望 %s，实际 %s", i+1, expected[i], id)
+		}
+	}
+
+	// 直播已经结束
+	if _, err := c.RecordLiveChat(context.Background(), fakeapi.SiteID, fakeapi.LiveCode, path, options); err == nil {
+		t.Error("已结束的直播应返回错误")
+	}
+	if _, err := c.RecordLiveChat(context.Background(), fakeapi.SiteID, fakeapi.VideoCode, path, options); err == nil {
+		t.Error("不是生放送的视频应返回错误")
+	}
+}
+
+// 文件已存在时跳过已经记录的弹幕，最后一行不完整时从新的一行开始
+func TestRecordLiveChatResume(t *testing.T) {
+	fake := fakeapi.New(t)
+	c := NewClient(fake.Client())
+	c.CommentsURL = fake.CommentsURL()
+	path := filepath.Join(t.TempDir(), "live_chat.jsonl")
+
+	fake.PostLiveMessage("live-1", "こんばんは", 0)
+	fake.PostLiveMessage("live-2", "わこつ", 3)
+	if err := os.WriteFile(path, []byte(`{"id":"live-1","playback_time":0}`+"\n"+`{"id":"li`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan Message, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	var recorded int
+	go func() {
+		var err error
+		recorded, err = c.RecordLiveChat(ctx, fakeapi.SiteID, fakeapi.LiveCode, path, LiveChatOptions{
+			PollInterval: 10 * time.Millisecond,
+			OnMessage:    func(m Message) { received <- m },
+		})
+		done <- err
+	}()
+	waitMessage(t, received, "live-2")
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后应返回 context.Canceled，实际 %v", err)
+	}
+	if recorded != 1 {
+		t.Errorf("期望新记录 1 条，实际 %d 条", recorded)
+	}
+
+	data, _ := os.ReadFile(path)
+	expected := `{"id":"live-1","playback_time":0}` + "\n" + `{"id":"li` + "\n"
+	if got := string(data); len(got) <= len(expected) || got[:len(expected)] != expected {
+		t.Errorf("已有的内容不应被修改:\n%s", got)
+	}
+}
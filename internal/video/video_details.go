@@ -1,9 +1,8 @@
 package video
 
 import (
+	"context"
 	"strconv"
-
-	"ncpd/internal/client"
 )
 
 type VideoDetailsResponse struct {
@@ -85,12 +84,11 @@ type VideoStream struct {
 	AuthenticatedURL string `json:"authenticated_url"`
 }
 
-func GetVideoDetails(fcSiteID int, contentCode string) (*VideoDetails, error) {
-	client := client.Get()
-
+// GetVideoDetails 获取视频的详细信息
+func (c *Client) GetVideoDetails(ctx context.Context, fcSiteID int, contentCode string) (*VideoDetails, error) {
 	var response VideoDetailsResponse
 
-	_, err := client.R().
+	_, err := c.R(ctx).
 		SetHeader("fc_site_id", strconv.Itoa(fcSiteID)).
 		SetHeader("fc_use_device", "null").
 		SetPathParam("contentCode", contentCode).
@@ -1,10 +1,9 @@
 package video
 
 import (
+	"context"
 	"fmt"
 	"strconv"
-
-	"ncpd/internal/client"
 )
 
 type VideoPagesResponse struct {
@@ -16,9 +15,14 @@ type VideoPagesResponse struct {
 	} `json:"data"`
 }
 
-func GetVideoList(fcSiteID int) ([]VideoDetails, error) {
-	client := client.Get()
+// GetVideoList 获取频道的所有视频
+func (c *Client) GetVideoList(ctx context.Context, fcSiteID int) ([]VideoDetails, error) {
+	return c.GetVideoListUntil(ctx, fcSiteID, nil)
+}
 
+// GetVideoListUntil 按显示日期从新到旧获取频道的视频，每获取一页后调用 stop，返回 true 时不再获取后面的页
+// stop 为 nil 时获取所有视频
+func (c *Client) GetVideoListUntil(ctx context.Context, fcSiteID int, stop func(page []VideoDetails) bool) ([]VideoDetails, error) {
 	// 这个地址返回的视频信息不全，获取更详细的信息需要使用 GetVideoDetails
 	var allVideos []VideoDetails
 	page := 1
@@ -29,7 +33,7 @@ func GetVideoList(fcSiteID int) ([]VideoDetails, error) {
 	for {
 		var response VideoPagesResponse
 
-		resp, err := client.R().
+		resp, err := c.R(ctx).
 			SetHeader("fc_use_device", "null").
 			SetPathParam("fcSiteId", strconv.Itoa(fcSiteID)).
 			SetPathParam("size", strconv.Itoa(size)).
@@ -62,6 +66,11 @@ func GetVideoList(fcSiteID int) ([]VideoDetails, error) {
 			break
 		}
 
+		if stop != nil && stop(response.Data.VideoPages.List) {
+			fmt.Printf("第 %d 页之后的视频已经获取过，停止获取\n", page)
+			break
+		}
+
 		page++
 	}
 
@@ -1,34 +1,46 @@
 package video
 
 import (
+	"context"
 	"testing"
+
+	"ncpd/internal/fakeapi"
 )
 
 // go test -v ./internal/video -run TestGetVideoList
 func TestGetVideoList(t *testing.T) {
-	fcSiteID := 387
+	c := NewClient(fakeapi.New(t).Client())
 
-	t.Log("🔍 正在获取视频列表...")
-	videoList, err := GetVideoList(fcSiteID)
+	// 每页 10 个，需要请求两页
+	videoList, err := c.GetVideoList(context.Background(), fakeapi.SiteID)
 	if err != nil {
 		t.Fatalf("获取视频列表失败: %v", err)
 	}
+	if len(videoList) != fakeapi.VideoCount {
+		t.Fatalf("期望 %d 个视频，实际 %d 个", fakeapi.VideoCount, len(videoList))
+	}
+	if videoList[0].ContentCode != fakeapi.VideoCode || videoList[0].ActiveVideoFilename == nil {
+		t.Errorf("视频信息错误: %+v", videoList[0])
+	}
 
-	if len(videoList) == 0 {
-		t.Log("获取到的视频列表为空")
-		return
+	if _, err := c.GetVideoList(context.Background(), 999); err == nil {
+		t.Error("不存在的频道应返回错误")
 	}
+}
 
-	t.Logf("✅ 成功获取到 %d 个视频", len(videoList))
+// 第一页之后停止获取
+func TestGetVideoListUntil(t *testing.T) {
+	c := NewClient(fakeapi.New(t).Client())
 
-	// 输出视频列表信息
-	t.Log("📋 视频列表:")
-	for i, video := range videoList {
-		t.Logf("  %d. [%s] %s", i+1, video.ContentCode, video.Title)
-		t.Logf("     显示日期: %s", video.DisplayDate)
-		t.Logf("     发布时间: %s", video.ReleasedAt)
-		t.Logf("     总观看数: %d", video.VideoAggregateInfo.TotalViews)
-		t.Logf("     评论数: %d", video.VideoAggregateInfo.NumberOfComments)
-		t.Logf("     视频长度: %d 秒", video.ActiveVideoFilename.Length)
+	var pages int
+	videoList, err := c.GetVideoListUntil(context.Background(), fakeapi.SiteID, func(page []VideoDetails) bool {
+		pages++
+		return true
+	})
+	if err != nil {
+		t.Fatalf("获取视频列表失败: %v", err)
+	}
+	if pages != 1 || len(videoList) != 10 {
+		t.Errorf("期望获取 1 页 10 个视频，实际 %d 页 %d 个", pages, len(videoList))
 	}
 }